@@ -0,0 +1,159 @@
+// Command esbuild-py runs the bindings as a long-lived process, for
+// environments that can't load the shared library but shouldn't pay for
+// starting a process on every call.
+//
+//	esbuild-py --stdio
+//
+// serves length-prefixed JSON-RPC requests on stdin and writes the
+// responses to stdout, until stdin is closed.
+//
+//	esbuild-py --serve-socket /path.sock
+//
+// serves the same protocol on each connection to a Unix domain socket, so
+// that several processes share one warm service, until it's interrupted.
+// On Windows, the path may also be the name of a named pipe, such as
+// `\\.\pipe\esbuild-py`.
+//
+//	esbuild-py --serve-http 127.0.0.1:8123
+//
+// serves the builds and transforms as an HTTP JSON API, for clients in
+// other languages and remote build farms, until it's interrupted.
+//
+//	esbuild-py --serve-grpc 127.0.0.1:8124
+//
+// serves them as the gRPC service of internal/daemon/esbuildpb, along with
+// streams of rebuild events, until it's interrupted.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/keller-mark/esbuild-py/internal/daemon"
+	"github.com/keller-mark/esbuild-py/internal/runner"
+)
+
+func main() {
+	stdio := flag.Bool("stdio", false, "serve JSON-RPC requests on stdin and stdout")
+	socket := flag.String("serve-socket", "", "serve JSON-RPC requests on a Unix domain socket or Windows named pipe at this `path`")
+	httpAddr := flag.String("serve-http", "", "serve the HTTP JSON API at this `address`, e.g. 127.0.0.1:8123")
+	grpcAddr := flag.String("serve-grpc", "", "serve the gRPC service at this `address`, e.g. 127.0.0.1:8124")
+	httpToken := flag.String("http-token", "", "require this bearer `token` from HTTP and gRPC clients, instead of $ESBUILD_PY_HTTP_TOKEN")
+	flag.Parse()
+	if *httpToken == "" {
+		// Unlike a flag, the environment isn't visible to other users.
+		*httpToken = os.Getenv("ESBUILD_PY_HTTP_TOKEN")
+	}
+	modes := 0
+	for _, enabled := range []bool{*stdio, *socket != "", *httpAddr != "", *grpcAddr != ""} {
+		if enabled {
+			modes++
+		}
+	}
+	if modes != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch {
+	case *stdio:
+		err = serveStdio()
+	case *socket != "":
+		err = serveSocket(*socket)
+	case *httpAddr != "":
+		err = serveHTTP(*httpAddr, *httpToken)
+	default:
+		err = serveGRPC(*grpcAddr, *httpToken)
+	}
+	runner.DisposeAllContexts()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "esbuild-py: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// serveStdio serves the requests read from stdin until it's closed.
+func serveStdio() error {
+	// Stdout carries the frames of the protocol, so anything else printed
+	// there would corrupt them.
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	return daemon.Serve(context.Background(), os.Stdin, out)
+}
+
+// serveSocket serves the connections to a Unix domain socket or a named
+// pipe until the process is interrupted or terminated, then removes it.
+func serveSocket(path string) error {
+	ln, err := daemon.Listen(path)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-interrupted()
+		ln.Close()
+	}()
+	return daemon.ServeListener(context.Background(), ln)
+}
+
+// serveHTTP serves the HTTP JSON API until the process is interrupted or
+// terminated, then waits for the requests being served to finish.
+func serveHTTP(addr string, token string) error {
+	ln, err := daemon.ListenTCP(addr, token)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: daemon.NewHTTPHandler(token)}
+	shutdown := make(chan error, 1)
+	go func() {
+		<-interrupted()
+		shutdown <- server.Shutdown(context.Background())
+	}()
+	if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-shutdown
+}
+
+// grpcDrainTimeout is how long the gRPC server waits for running calls to
+// finish when it's stopped, since Watch calls only end when their clients
+// cancel them.
+const grpcDrainTimeout = 10 * time.Second
+
+// serveGRPC serves the gRPC service until the process is interrupted or
+// terminated, then waits a while for the running calls to finish.
+func serveGRPC(addr string, token string) error {
+	ln, err := daemon.ListenTCP(addr, token)
+	if err != nil {
+		return err
+	}
+	server := daemon.NewGRPCServer(token)
+	stopped := make(chan struct{})
+	go func() {
+		<-interrupted()
+		timer := time.AfterFunc(grpcDrainTimeout, server.Stop)
+		server.GracefulStop()
+		timer.Stop()
+		close(stopped)
+	}()
+	if err := server.Serve(ln); err != nil {
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+// interrupted returns a channel that receives the signal interrupting or
+// terminating the process.
+func interrupted() <-chan os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	return signals
+}
@@ -1,88 +1,630 @@
 package main
 
+/*
+#include <stdlib.h>
+
+typedef void (*completion_callback)(unsigned long long id, char *result, size_t length);
+
+static inline void call_completion_callback(completion_callback callback, unsigned long long id, char *result, size_t length) {
+	callback(id, result, length);
+}
+
+typedef void (*watch_callback)(unsigned long long handle, char *event, size_t length);
+
+static inline void call_watch_callback(watch_callback callback, unsigned long long handle, char *event, size_t length) {
+	callback(handle, event, length);
+}
+
+typedef void (*plugin_callback)(unsigned long long id, char *call, size_t length);
+
+static inline void call_plugin_callback(plugin_callback callback, unsigned long long id, char *call, size_t length) {
+	callback(id, call, length);
+}
+*/
+import "C"
+
 import (
-	"C"
+	"bytes"
+	"context"
 	"encoding/json"
+	"runtime"
+	"runtime/debug"
+	"time"
+	"unsafe"
 
 	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/jobs"
+	"github.com/keller-mark/esbuild-py/internal/runner"
 	"github.com/keller-mark/esbuild-py/internal/shared"
 )
 
 // This file provides the Go bindings for the esbuild API that are called from
 // Python using ctypes.
 
-// --- Transform-specific Structures ---
+//export transform
+// transform is the C-exported function that wraps esbuild's Transform API.
+// The length of the returned JSON is stored in resultLength, so that the
+// result can be read without relying on a NUL terminator.
+func transform(requestJSON *C.char, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(runner.Transform(context.Background(), []byte(C.GoString(requestJSON)), shared.EncodingJSON), resultLength)
+}
 
-// TransformRequest is used to unmarshal the JSON from Python for the transform API.
-// We use this intermediate struct because the `Loader` field in `api.TransformOptions`
-// is an enum, not a string, and requires manual mapping.
-type TransformRequest struct {
-	Code    string `json:"code"`
-	Options struct {
-		Loader string `json:"loader"`
-	} `json:"options"`
+//export build
+// build is the C-exported function that wraps esbuild's Build API.
+func build(requestJSON *C.char, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(runner.Build(context.Background(), []byte(C.GoString(requestJSON)), shared.EncodingJSON), resultLength)
 }
 
-//export transform
-func transform(requestJSON *C.char) *C.char {
-	goRequestJSON := C.GoString(requestJSON)
-	var req TransformRequest
-	if err := json.Unmarshal([]byte(goRequestJSON), &req); err != nil {
-		// On failure, create a response with the parsing error.
-		response := shared.NewApiResponse("", []api.Message{{Text: "Failed to parse request JSON: " + err.Error()}}, nil)
-		responseBytes, _ := json.Marshal(response)
-		return C.CString(string(responseBytes))
+//export transform_bytes
+// transform_bytes is like transform, but reads the request directly from a
+// buffer of the given length instead of a NUL-terminated string, which avoids
+// an extra copy of large sources on the Python side.
+func transform_bytes(data *C.char, length C.size_t, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(runner.Transform(context.Background(), requestBytes(data, length), shared.EncodingJSON), resultLength)
+}
+
+//export build_bytes
+// build_bytes is like build, but reads the request from a buffer of the given
+// length.
+func build_bytes(data *C.char, length C.size_t, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(runner.Build(context.Background(), requestBytes(data, length), shared.EncodingJSON), resultLength)
+}
+
+//export transform_encoded
+// transform_encoded is like transform_bytes, but the request and response use
+// the given encoding (0 for JSON, 1 for MessagePack). Other encodings are
+// rejected with an error response in JSON.
+func transform_encoded(data *C.char, length C.size_t, encoding C.int, resultLength *C.size_t) (result *C.char) {
+	enc, msg := shared.ParseEncoding(int(encoding))
+	if msg != nil {
+		return newResult(shared.NewApiResponse("", []api.Message{*msg}, nil), resultLength)
+	}
+	defer recoverEncodedResult(&result, enc, resultLength)
+	return newEncodedResult(runner.Transform(context.Background(), requestBytes(data, length), enc), enc, resultLength)
+}
+
+//export build_encoded
+// build_encoded is like build_bytes, but the request and response use the
+// given encoding (0 for JSON, 1 for MessagePack). Other encodings are
+// rejected with an error response in JSON.
+func build_encoded(data *C.char, length C.size_t, encoding C.int, resultLength *C.size_t) (result *C.char) {
+	enc, msg := shared.ParseEncoding(int(encoding))
+	if msg != nil {
+		return newResult(shared.NewApiResponse("", []api.Message{*msg}, nil), resultLength)
 	}
+	defer recoverEncodedResult(&result, enc, resultLength)
+	return newEncodedResult(runner.Build(context.Background(), requestBytes(data, length), enc), enc, resultLength)
+}
+
+//export context_create
+// context_create creates an esbuild build context from a JSON build request.
+// The response holds the context's handle in `context`, which is passed to
+// the other context functions. Rebuilding a context only redoes the work
+// affected by changed files, which is much faster than a cold build.
+func context_create(data *C.char, length C.size_t, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(runner.CreateContext(requestBytes(data, length), shared.EncodingJSON), resultLength)
+}
+
+//export context_rebuild
+// context_rebuild builds a context again and returns the same response as
+// build.
+func context_rebuild(handle C.ulonglong, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(runner.RebuildContext(context.Background(), uint64(handle)), resultLength)
+}
 
-	realOptions := api.TransformOptions{
-		Loader: shared.MapStringToLoader(req.Options.Loader),
+//export context_dispose
+// context_dispose stops a context's watcher and server and frees everything
+// it holds. Returns 0 on success and -1 if the handle is unknown.
+func context_dispose(handle C.ulonglong) (status C.int) {
+	defer recoverStatus(&status, -1)
+	if err := runner.DisposeContext(uint64(handle)); err != nil {
+		return -1
 	}
+	return 0
+}
 
-	result := api.Transform(req.Code, realOptions)
+//export context_serve
+// context_serve starts a dev server for a context, taking a JSON object with
+// the optional `host`, `port`, `servedir`, `fallback`, `proxy`, `headers`
+// and `liveReload` settings, and the `keyfile` and `certfile` to serve over
+// HTTPS. The response's `serve` field holds the hosts and port the server is
+// listening on.
+func context_serve(handle C.ulonglong, data *C.char, length C.size_t, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(runner.ServeContext(uint64(handle), requestBytes(data, length)), resultLength)
+}
 
-	// Use the shared constructor to create a well-formed response.
-	response := shared.NewApiResponse(string(result.Code), result.Errors, result.Warnings)
+//export serve_stop
+// serve_stop shuts down the dev server of a context, freeing its port, while
+// keeping the context itself. Returns 0 on success and -1 if the handle is
+// unknown or the context isn't being served.
+func serve_stop(handle C.ulonglong) (status C.int) {
+	defer recoverStatus(&status, -1)
+	if err := runner.StopServing(uint64(handle)); err != nil {
+		return -1
+	}
+	return 0
+}
 
-	responseBytes, err := json.Marshal(response)
+//export serve_poll
+// serve_poll returns the next entry of the request log of a context's dev
+// server as JSON, with the `method`, `path`, `status` and `timeMs` of the
+// request, or NULL if no request arrives within the timeout. A negative
+// timeout waits indefinitely.
+func serve_poll(handle C.ulonglong, timeoutMs C.longlong, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	entry, err := runner.PollServeLog(uint64(handle), pollTimeout(timeoutMs))
 	if err != nil {
-		// This is an internal error, but we still try to return it as a JSON error.
-		errResponse := shared.NewApiResponse("", []api.Message{{Text: "Failed to marshal response JSON: " + err.Error()}}, nil)
-		responseBytes, _ = json.Marshal(errResponse)
-		return C.CString(string(responseBytes))
+		return newResult(shared.NewApiResponse("", []api.Message{{Text: err.Error()}}, nil), resultLength)
+	}
+	if entry == nil {
+		*resultLength = 0
+		return nil
 	}
+	return newResult(entry, resultLength)
+}
 
-	return C.CString(string(responseBytes))
+//export dev
+// dev starts a dev server with live reload for a context and watches it, so
+// that pages reload whenever an input changes. The response's `serve` field
+// holds the hosts and port the server is listening on.
+func dev(handle C.ulonglong, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(runner.DevContext(uint64(handle)), resultLength)
 }
 
-//export build
-// build is the C-exported function that wraps esbuild's Build API.
-func build(requestJSON *C.char) *C.char {
-	goRequestJSON := C.GoString(requestJSON)
-	var options api.BuildOptions
-	if err := json.Unmarshal([]byte(goRequestJSON), &options); err != nil {
-		response := shared.NewApiResponse("", []api.Message{{Text: "Failed to parse build request JSON: " + err.Error()}}, nil)
-		responseBytes, _ := json.Marshal(response)
-		return C.CString(string(responseBytes))
+//export context_watch
+// context_watch builds a context and then rebuilds it whenever one of its
+// input files changes, until context_unwatch or context_dispose is called.
+// Returns 0 on success and -1 if the handle is unknown or the context is
+// already being watched.
+func context_watch(handle C.ulonglong) (status C.int) {
+	defer recoverStatus(&status, -1)
+	if err := runner.WatchContext(uint64(handle)); err != nil {
+		return -1
+	}
+	return 0
+}
+
+//export context_unwatch
+// context_unwatch stops watching a context. Returns 0 on success and -1 if
+// the handle is unknown or the context isn't being watched.
+func context_unwatch(handle C.ulonglong) (status C.int) {
+	defer recoverStatus(&status, -1)
+	if err := runner.UnwatchContext(uint64(handle)); err != nil {
+		return -1
+	}
+	return 0
+}
+
+//export watch_poll
+// watch_poll returns the next rebuild event of a watched context as JSON,
+// with whether the build succeeded, its duration, the output files that
+// changed, and its errors and warnings. Events are queued until they are
+// polled. If none happens within the timeout, NULL is returned; a negative
+// timeout waits indefinitely.
+func watch_poll(handle C.ulonglong, timeoutMs C.longlong, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	event, err := runner.PollWatchEvent(uint64(handle), pollTimeout(timeoutMs))
+	if err != nil {
+		return newResult(shared.NewApiResponse("", []api.Message{{Text: err.Error()}}, nil), resultLength)
+	}
+	if event == nil {
+		*resultLength = 0
+		return nil
+	}
+	return newResult(event, resultLength)
+}
+
+//export set_watch_callback
+// set_watch_callback registers a C function that is called with the context
+// handle and JSON event of every rebuild of a watched context, including the
+// input files that changed, instead of queueing the events for watch_poll.
+// Like the completion callback, it runs on a Go thread and takes ownership
+// of the event, which must be released with free_result. Passing NULL
+// unregisters it. Returns 0 on success and -1 on failure.
+func set_watch_callback(callback C.watch_callback) (status C.int) {
+	defer recoverStatus(&status, -1)
+	if callback == nil {
+		runner.SetWatchHandler(nil)
+		return 0
+	}
+	runner.SetWatchHandler(func(id uint64, event shared.WatchEvent) {
+		var resultLength C.size_t
+		result := callbackResult(event, &resultLength)
+		C.call_watch_callback(callback, C.ulonglong(id), result, resultLength)
+	})
+	return 0
+}
+
+//export set_plugin_callback
+// set_plugin_callback registers a C function that is called with an ID and
+// a JSON description of every call of a hook declared by the `plugins` of a
+// build request. The build waits until the call is answered with
+// plugin_respond, which may happen before the callback returns or later from
+// another thread. Like the completion callback, it runs on a Go thread and
+// takes ownership of the call, which must be released with free_result.
+// Passing NULL unregisters it. Returns 0 on success and -1 on failure.
+func set_plugin_callback(callback C.plugin_callback) (status C.int) {
+	defer recoverStatus(&status, -1)
+	if callback == nil {
+		runner.SetPluginCallback(nil)
+		return 0
+	}
+	runner.SetPluginCallback(func(id uint64, call shared.PluginCall) {
+		var callLength C.size_t
+		data := callbackResult(call, &callLength)
+		C.call_plugin_callback(callback, C.ulonglong(id), data, callLength)
+	})
+	return 0
+}
+
+//export plugin_respond
+// plugin_respond answers a hook call with a JSON result, as returned by the
+// hook in the JavaScript API, or an empty object to let the next plugin
+// handle it. Returns 0 on success and -1 if the call ID is unknown.
+func plugin_respond(id C.ulonglong, data *C.char, length C.size_t) (status C.int) {
+	defer recoverStatus(&status, -1)
+	if err := runner.RespondPluginCall(uint64(id), copyRequestBytes(data, length)); err != nil {
+		return -1
+	}
+	return 0
+}
+
+//export plugin_resolve
+// plugin_resolve resolves a path with esbuild's resolver on behalf of a
+// Python plugin, like `build.resolve` in the JavaScript API. It takes the
+// `build` of a hook call and a JSON object with the `path` and the optional
+// `importer`, `namespace`, `resolveDir`, `kind`, `pluginData` and `with`.
+// It's meant to be called while answering a hook call, since the build must
+// still be running.
+func plugin_resolve(build C.ulonglong, data *C.char, length C.size_t, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(runner.PluginResolve(uint64(build), requestBytes(data, length)), resultLength)
+}
+
+//export list_contexts
+// list_contexts returns a JSON array describing every live context: its
+// handle, its state (idle, building, watching or serving) and a summary of
+// its options. It helps to track down contexts that were never disposed.
+func list_contexts(resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(runner.ListContexts(), resultLength)
+}
+
+// requestBytes wraps a request buffer owned by the caller without copying it.
+// The slice is only valid for the duration of the exported call, which is
+// fine since decoding the JSON copies everything that is kept. Unlike
+// C.GoBytes, which takes a C int, it keeps the whole size_t length; a length
+// that doesn't fit in an int makes unsafe.Slice panic, which the exports
+// recover from as an error.
+func requestBytes(data *C.char, length C.size_t) []byte {
+	if length == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(data)), int(length))
+}
+
+// copyRequestBytes copies a request buffer owned by the caller, for the
+// exports that keep the request after they return.
+func copyRequestBytes(data *C.char, length C.size_t) []byte {
+	return bytes.Clone(requestBytes(data, length))
+}
+
+//export submit_transform
+// submit_transform starts a transform in the background and immediately
+// returns a request ID, whose response is collected with poll_result or
+// wait_result, or 0 if the request couldn't be submitted. Unlike
+// transform_bytes, the request is copied, so the buffer may be released as
+// soon as the call returns.
+func submit_transform(data *C.char, length C.size_t) (id C.ulonglong) {
+	defer recoverStatus(&id, 0)
+	requestData := copyRequestBytes(data, length)
+	return C.ulonglong(jobs.Default.Submit(func(ctx context.Context) any {
+		return runner.Recovered(func() *shared.ApiResponse {
+			return runner.Transform(ctx, requestData, shared.EncodingJSON)
+		})
+	}))
+}
+
+//export submit_build
+// submit_build starts a build in the background and immediately returns a
+// request ID, like submit_transform.
+func submit_build(data *C.char, length C.size_t) (id C.ulonglong) {
+	defer recoverStatus(&id, 0)
+	requestData := copyRequestBytes(data, length)
+	return C.ulonglong(jobs.Default.Submit(func(ctx context.Context) any {
+		return runner.Recovered(func() *shared.ApiResponse {
+			return runner.Build(ctx, requestData, shared.EncodingJSON)
+		})
+	}))
+}
+
+//export poll_result
+// poll_result returns the response of a submitted request if it has
+// finished, or NULL if it's still running. A response can only be collected
+// once, after which the request ID is no longer valid.
+func poll_result(id C.ulonglong, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	response, done, err := jobs.Default.Poll(uint64(id))
+	return jobResult(response, done, err, resultLength)
+}
+
+//export wait_result
+// wait_result blocks until a submitted request has finished and returns its
+// response, like poll_result. A negative timeout waits indefinitely; NULL is
+// returned if the timeout expires first.
+func wait_result(id C.ulonglong, timeoutMs C.longlong, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	response, done, err := jobs.Default.Wait(uint64(id), pollTimeout(timeoutMs))
+	return jobResult(response, done, err, resultLength)
+}
+
+//export cancel
+// cancel aborts a submitted request. A cancelled build stops as soon as
+// possible and its response reports the cancellation; it must still be
+// collected with poll_result or wait_result. Returns 0 on success and -1 if
+// the request ID is unknown.
+func cancel(id C.ulonglong) (status C.int) {
+	defer recoverStatus(&status, -1)
+	if err := jobs.Default.Cancel(uint64(id)); err != nil {
+		return -1
+	}
+	return 0
+}
+
+//export set_completion_callback
+// set_completion_callback registers a C function (e.g. a ctypes CFUNCTYPE)
+// that is called with the request ID and response of every submitted request
+// when it finishes, so event loops don't need to poll. The callback runs on a
+// Go thread and takes ownership of the response, which must be released with
+// free_result. Passing NULL unregisters it. Returns 0 on success and -1 on
+// failure.
+func set_completion_callback(callback C.completion_callback) (status C.int) {
+	defer recoverStatus(&status, -1)
+	if callback == nil {
+		jobs.Default.SetCompletionHandler(nil)
+		return 0
 	}
+	jobs.Default.SetCompletionHandler(func(id uint64, response any) {
+		var resultLength C.size_t
+		result := callbackResult(response, &resultLength)
+		C.call_completion_callback(callback, C.ulonglong(id), result, resultLength)
+	})
+	return 0
+}
+
+// pollTimeout converts a timeout in milliseconds from Python, where a
+// negative value means waiting indefinitely.
+func pollTimeout(timeoutMs C.longlong) time.Duration {
+	if timeoutMs < 0 {
+		return -1
+	}
+	return time.Duration(timeoutMs) * time.Millisecond
+}
 
-	// For build, esbuild defaults to bundling if an outfile is specified.
-	// We will explicitly set it to true to be clear and consistent.
-	options.Bundle = true
-	options.Write = true
+// jobResult converts the outcome of polling or waiting for a job into the
+// value returned to Python.
+func jobResult(response any, done bool, err error, resultLength *C.size_t) *C.char {
+	if err != nil {
+		return newResult(shared.NewApiResponse("", []api.Message{{Text: err.Error()}}, nil), resultLength)
+	}
+	if !done {
+		*resultLength = 0
+		return nil
+	}
+	return newResult(response, resultLength)
+}
 
-	result := api.Build(options)
+//export transform_many
+// transform_many runs a JSON array of `{name, code, options}` transforms
+// concurrently on a pool of worker goroutines, and returns their responses
+// keyed by name. This saves a round trip through ctypes per file when
+// transpiling whole directories.
+func transform_many(data *C.char, length C.size_t, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	entries, err := shared.DecodeTransformBatch(requestBytes(data, length))
+	if err != nil {
+		return newResult(shared.NewBatchErrorResponse([]api.Message{shared.NewRequestError("Failed to parse batch request JSON: " + err.Error())}), resultLength)
+	}
+	response := shared.RunTransformBatch(entries, runtime.NumCPU(), func(req shared.TransformRequest) *shared.ApiResponse {
+		return runner.Recovered(func() *shared.ApiResponse {
+			return runner.ExecuteTransform(context.Background(), req)
+		})
+	})
+	return newResult(response, resultLength)
+}
 
-	// Use the shared constructor. The code is empty as it's written to a file.
-	response := shared.NewApiResponse("", result.Errors, result.Warnings)
+// newResult serializes a response as JSON into memory allocated with
+// C.malloc and stores its length in resultLength. The result must be
+// released with free_result.
+func newResult(response any, resultLength *C.size_t) *C.char {
+	return newEncodedResult(response, shared.EncodingJSON, resultLength)
+}
 
-	responseBytes, err := json.Marshal(response)
+// newEncodedResult is like newResult, but serializes the response in the
+// given encoding.
+func newEncodedResult(response any, encoding shared.Encoding, resultLength *C.size_t) *C.char {
+	responseBytes, err := encoding.Marshal(response)
 	if err != nil {
-		errResponse := shared.NewApiResponse("", []api.Message{{Text: "Failed to marshal build response JSON: " + err.Error()}}, nil)
-		responseBytes, _ = json.Marshal(errResponse)
-		return C.CString(string(responseBytes))
+		// This is an internal error, but we still try to return it as an error response.
+		errResponse := shared.NewApiResponse("", []api.Message{{Text: "Failed to marshal response: " + err.Error()}}, nil)
+		responseBytes, _ = encoding.Marshal(errResponse)
 	}
 
-	return C.CString(string(responseBytes))
+	*resultLength = C.size_t(len(responseBytes))
+	return (*C.char)(C.CBytes(responseBytes))
+}
+
+//export protocol_version
+// protocol_version returns the version of the protocol spoken by this
+// library, so the Python wrapper can detect a mismatched build and fail with
+// a clear message instead of sending options that are silently ignored.
+func protocol_version() C.int {
+	return C.int(shared.ProtocolVersion)
+}
+
+//export configure
+// configure changes settings of the embedded runtime from a JSON object,
+// e.g. `{"concurrency": 2}` to let at most two builds or transforms run at
+// the same time. It returns the resulting configuration as JSON.
+func configure(data *C.char, length C.size_t, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	var config shared.Config
+	if err := json.Unmarshal(requestBytes(data, length), &config); err != nil {
+		return newResult(shared.NewApiResponse("", []api.Message{shared.NewRequestError("Failed to parse configuration JSON: " + err.Error())}, nil), resultLength)
+	}
+	return newResult(runner.Configure(config), resultLength)
+}
+
+//export set_max_threads
+// set_max_threads limits the number of OS threads executing Go code at the
+// same time, and with it the CPU used by the embedded runtime. It returns
+// the previous limit, or -1 on failure; a value below 1 leaves the limit
+// unchanged.
+func set_max_threads(n C.int) (previous C.int) {
+	defer recoverStatus(&previous, -1)
+	return C.int(runtime.GOMAXPROCS(int(n)))
+}
+
+//export set_memory_limit
+// set_memory_limit sets a soft limit in bytes on the memory used by the Go
+// runtime, making the garbage collector work harder as the limit is
+// approached. It returns the previous limit, or -1 on failure; a negative
+// value leaves the limit unchanged.
+func set_memory_limit(limit C.longlong) (previous C.longlong) {
+	defer recoverStatus(&previous, -1)
+	return C.longlong(debug.SetMemoryLimit(int64(limit)))
+}
+
+//export stats
+// stats returns JSON with the heap usage of the Go runtime, the number of
+// running and queued requests, and the number of builds and transforms
+// served so far, for monitoring the embedded runtime.
+func stats(resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(runner.Stats(), resultLength)
+}
+
+//export esbuild_shutdown
+// esbuild_shutdown prepares the embedded runtime for the interpreter exiting.
+// New builds and transforms are rejected with a cancelled response, and
+// running ones get drainTimeoutMs milliseconds to finish before they are
+// cancelled (a negative timeout waits indefinitely). All contexts are
+// disposed. Returns 0 if everything finished in time and -1 otherwise. The
+// library can't be used after shutting down. It isn't named `shutdown`, which
+// would interpose the POSIX function of the same name for the whole process.
+func esbuild_shutdown(drainTimeoutMs C.longlong) (status C.int) {
+	defer recoverStatus(&status, -1)
+	ctx := context.Background()
+	if drainTimeoutMs >= 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(drainTimeoutMs)*time.Millisecond)
+		defer cancel()
+	}
+
+	if err := jobs.DefaultLimiter.Shutdown(ctx); err != nil {
+		jobs.Default.CancelAll()
+		status = -1
+	}
+	runner.DisposeAllContexts()
+	debug.FreeOSMemory()
+	return status
+}
+
+//export version
+// version returns the versions of the embedded esbuild library and of these
+// bindings as JSON, for compatibility checks and bug reports.
+func version(resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(shared.NewVersionInfo(), resultLength)
+}
+
+//export capabilities
+// capabilities returns JSON describing the supported commands, loaders,
+// formats, targets and other option values, so the Python wrapper can
+// validate options before calling into Go.
+func capabilities(resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(shared.NewCapabilities(shared.Commands), resultLength)
+}
+
+//export analyze_metafile
+// analyze_metafile takes a JSON object with the `metafile` of a build and
+// the `verbose` and `color` flags, and returns a response whose `analysis`
+// is the human-readable breakdown of the bundle printed by
+// `esbuild --analyze`.
+func analyze_metafile(data *C.char, length C.size_t, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	var req shared.AnalyzeMetafileRequest
+	if err := json.Unmarshal(requestBytes(data, length), &req); err != nil {
+		return newResult(shared.NewApiResponse("", []api.Message{shared.NewRequestError("Failed to parse analyze request JSON: " + err.Error())}, nil), resultLength)
+	}
+	return newResult(shared.AnalyzeMetafile(req), resultLength)
+}
+
+//export format_messages
+// format_messages takes a JSON object with a list of `messages` from a
+// response, their `kind`, and the `color` and `terminalWidth` settings, and
+// returns a response whose `formatted` list holds each message rendered the
+// way esbuild prints it.
+func format_messages(data *C.char, length C.size_t, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	var req shared.FormatMessagesRequest
+	if err := json.Unmarshal(requestBytes(data, length), &req); err != nil {
+		return newResult(shared.NewApiResponse("", []api.Message{shared.NewRequestError("Failed to parse format request JSON: " + err.Error())}, nil), resultLength)
+	}
+	return newResult(shared.FormatMessages(req), resultLength)
+}
+
+// recoverResult must be deferred by every exported function that returns a
+// result. It converts a panic into an internal error response, since an
+// unrecovered panic would take down the entire Python process.
+func recoverResult(result **C.char, resultLength *C.size_t) {
+	if recovered := recover(); recovered != nil {
+		*result = newResult(shared.NewPanicResponse(recovered, debug.Stack()), resultLength)
+	}
+}
+
+// recoverEncodedResult is like recoverResult, for functions whose response
+// uses the given encoding. It can't share code with recoverResult since
+// recover only works when called directly by the deferred function.
+func recoverEncodedResult(result **C.char, encoding shared.Encoding, resultLength *C.size_t) {
+	if recovered := recover(); recovered != nil {
+		*result = newEncodedResult(shared.NewPanicResponse(recovered, debug.Stack()), encoding, resultLength)
+	}
+}
+
+// recoverStatus must be deferred by every exported function that returns a
+// status code or a number instead of a result. It converts a panic into the
+// given failure value, for the same reason as recoverResult.
+func recoverStatus[T C.int | C.longlong | C.ulonglong](status *T, failure T) {
+	if recover() != nil {
+		*status = failure
+	}
+}
+
+// callbackResult serializes the argument of a callback like newResult, but
+// passes a panic on to the callback as an internal error response, since the
+// callbacks run on goroutines of their own where nothing else would recover
+// it.
+func callbackResult(response any, resultLength *C.size_t) (result *C.char) {
+	defer recoverResult(&result, resultLength)
+	return newResult(response, resultLength)
+}
+
+//export free_result
+// free_result releases a result returned by one of the exported functions.
+// Every result must be passed back here once Python has read it, since the
+// memory is allocated with C.malloc and is not managed by either runtime.
+func free_result(result *C.char) {
+	C.free(unsafe.Pointer(result))
 }
 
 // main is required for the 'go build' command, but it's not used
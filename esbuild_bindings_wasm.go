@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"runtime/debug"
+
 	"github.com/evanw/esbuild/pkg/api"
 
 	"github.com/keller-mark/esbuild-py/internal/shared"
@@ -19,15 +21,16 @@ import (
 type IntermediateRequest struct {
 	Command string `json:"command"`
 	Input   string `json:"input"`
-	BuildOptions struct {
-		EntryPoints []string
-		Outfile string
-	}
-	TransformOptions struct {
-		Loader string `json:"loader"`
-	} `json:"options"`
+	BuildOptions shared.BuildRequest
+	TransformOptions shared.TransformOptionsRequest `json:"options"`
+	AnalyzeOptions shared.AnalyzeMetafileRequest `json:"analyze"`
+	FormatOptions shared.FormatMessagesRequest `json:"format"`
 }
 
+// wasmCommands lists the commands served by the WASM module, which only
+// runs one build or transform per instance.
+var wasmCommands = []string{"build", "transform", "version", "capabilities", "analyze_metafile", "format_messages"}
+
 // Response defines the structure of the JSON response sent back to Python.
 type Response struct {
 	Code  string `json:"code"`
@@ -35,6 +38,15 @@ type Response struct {
 }
 
 func main() {
+	// Report panics as an internal error response, like the native bindings.
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			responseBytes, _ := json.Marshal(shared.NewPanicResponse(recovered, debug.Stack()))
+			fmt.Print(string(responseBytes))
+			os.Exit(1)
+		}
+	}()
+
 	// Read all input from stdin. This will be the JSON payload.
 	inputBytes, err := io.ReadAll(os.Stdin)
 	if err != nil {
@@ -54,16 +66,28 @@ func main() {
 	// Execute the requested command.
 	switch req.Command {
 	case "build":
-		options := api.BuildOptions{
-			Bundle: true,
-			Write: true,
-			Outfile: req.BuildOptions.Outfile,
-			EntryPoints: req.BuildOptions.EntryPoints,
-		}
-		result := api.Build(options)
+		warnings := req.BuildOptions.UnknownOptionWarnings()
+		options, errors := req.BuildOptions.ToBuildOptions()
+		options.Bundle = true
 
-		// Use the shared constructor. The code is empty as it's written to a file.
-		response := shared.NewApiResponse("", result.Errors, result.Warnings)
+		var response *shared.ApiResponse
+		if len(errors) > 0 {
+			response = shared.NewApiResponse("", errors, warnings)
+		} else {
+			result := api.Build(options)
+
+			// Use the shared constructor. The code is empty as it's either written
+			// to a file or returned in the output files.
+			response = shared.NewApiResponse("", result.Errors, append(warnings, result.Warnings...))
+			response.EntryPoints = options.EntryPoints
+			if !options.Write {
+				response.OutputFiles = shared.NewOutputFiles(result.OutputFiles)
+			}
+			if options.Metafile {
+				response.Metafile = result.Metafile
+			}
+			response.FilterMessages(req.BuildOptions.LogLevel, req.BuildOptions.LogLimit, req.BuildOptions.LogOverride)
+		}
 
 		responseBytes, err := json.Marshal(response)
 		if err != nil {
@@ -78,14 +102,42 @@ func main() {
 			fmt.Print(string(responseBytes))
 			os.Exit(0)
 		}
+	case "analyze_metafile":
+		responseBytes, err := json.Marshal(shared.AnalyzeMetafile(req.AnalyzeOptions))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling JSON response: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(string(responseBytes))
+		os.Exit(0)
+	case "format_messages":
+		responseBytes, err := json.Marshal(shared.FormatMessages(req.FormatOptions))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling JSON response: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(string(responseBytes))
+		os.Exit(0)
+	case "version", "capabilities":
+		var info any = shared.NewVersionInfo()
+		if req.Command == "capabilities" {
+			info = shared.NewCapabilities(wasmCommands)
+		}
+		responseBytes, err := json.Marshal(info)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling JSON response: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(string(responseBytes))
+		os.Exit(0)
 	case "transform":
-		// Manually construct the real esbuild options, mapping the string loader.
-		realOptions := api.TransformOptions{
-			Loader: shared.MapStringToLoader(req.TransformOptions.Loader),
+		// Construct the real esbuild options, mapping the string enums.
+		realOptions, errors := req.TransformOptions.ToTransformOptions()
+		result := api.TransformResult{Errors: errors}
+		if len(errors) == 0 {
+			result = api.Transform(req.Input, realOptions)
 		}
 
-		result := api.Transform(req.Input, realOptions)
-
 		// Consolidate multiple errors into a single string.
 		if len(result.Errors) > 0 {
 			errorMsg := ""
@@ -0,0 +1,257 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: esbuild.proto
+
+package esbuildpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Esbuild_Transform_FullMethodName = "/esbuild_py.v1.Esbuild/Transform"
+	Esbuild_Build_FullMethodName     = "/esbuild_py.v1.Esbuild/Build"
+	Esbuild_Watch_FullMethodName     = "/esbuild_py.v1.Esbuild/Watch"
+	Esbuild_Version_FullMethodName   = "/esbuild_py.v1.Esbuild/Version"
+)
+
+// EsbuildClient is the client API for Esbuild service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Esbuild runs esbuild's transforms and builds with the same options as the
+// Python API and the native library.
+type EsbuildClient interface {
+	// Transform transforms the code of a single file.
+	Transform(ctx context.Context, in *TransformRequest, opts ...grpc.CallOption) (*Response, error)
+	// Build bundles the entry points of the options.
+	Build(ctx context.Context, in *BuildRequest, opts ...grpc.CallOption) (*Response, error)
+	// Watch builds the entry points of the options, then rebuilds them
+	// whenever one of their inputs changes, streaming an event after each
+	// build until the call is cancelled.
+	Watch(ctx context.Context, in *BuildRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error)
+	// Version returns the versions of esbuild and of the bindings.
+	Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionInfo, error)
+}
+
+type esbuildClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEsbuildClient(cc grpc.ClientConnInterface) EsbuildClient {
+	return &esbuildClient{cc}
+}
+
+func (c *esbuildClient) Transform(ctx context.Context, in *TransformRequest, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Esbuild_Transform_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *esbuildClient) Build(ctx context.Context, in *BuildRequest, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Esbuild_Build_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *esbuildClient) Watch(ctx context.Context, in *BuildRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Esbuild_ServiceDesc.Streams[0], Esbuild_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BuildRequest, WatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Esbuild_WatchClient = grpc.ServerStreamingClient[WatchEvent]
+
+func (c *esbuildClient) Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VersionInfo)
+	err := c.cc.Invoke(ctx, Esbuild_Version_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EsbuildServer is the server API for Esbuild service.
+// All implementations must embed UnimplementedEsbuildServer
+// for forward compatibility.
+//
+// Esbuild runs esbuild's transforms and builds with the same options as the
+// Python API and the native library.
+type EsbuildServer interface {
+	// Transform transforms the code of a single file.
+	Transform(context.Context, *TransformRequest) (*Response, error)
+	// Build bundles the entry points of the options.
+	Build(context.Context, *BuildRequest) (*Response, error)
+	// Watch builds the entry points of the options, then rebuilds them
+	// whenever one of their inputs changes, streaming an event after each
+	// build until the call is cancelled.
+	Watch(*BuildRequest, grpc.ServerStreamingServer[WatchEvent]) error
+	// Version returns the versions of esbuild and of the bindings.
+	Version(context.Context, *VersionRequest) (*VersionInfo, error)
+	mustEmbedUnimplementedEsbuildServer()
+}
+
+// UnimplementedEsbuildServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEsbuildServer struct{}
+
+func (UnimplementedEsbuildServer) Transform(context.Context, *TransformRequest) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Transform not implemented")
+}
+func (UnimplementedEsbuildServer) Build(context.Context, *BuildRequest) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Build not implemented")
+}
+func (UnimplementedEsbuildServer) Watch(*BuildRequest, grpc.ServerStreamingServer[WatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedEsbuildServer) Version(context.Context, *VersionRequest) (*VersionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
+}
+func (UnimplementedEsbuildServer) mustEmbedUnimplementedEsbuildServer() {}
+func (UnimplementedEsbuildServer) testEmbeddedByValue()                 {}
+
+// UnsafeEsbuildServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EsbuildServer will
+// result in compilation errors.
+type UnsafeEsbuildServer interface {
+	mustEmbedUnimplementedEsbuildServer()
+}
+
+func RegisterEsbuildServer(s grpc.ServiceRegistrar, srv EsbuildServer) {
+	// If the following call pancis, it indicates UnimplementedEsbuildServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Esbuild_ServiceDesc, srv)
+}
+
+func _Esbuild_Transform_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransformRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EsbuildServer).Transform(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Esbuild_Transform_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EsbuildServer).Transform(ctx, req.(*TransformRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Esbuild_Build_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BuildRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EsbuildServer).Build(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Esbuild_Build_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EsbuildServer).Build(ctx, req.(*BuildRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Esbuild_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BuildRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EsbuildServer).Watch(m, &grpc.GenericServerStream[BuildRequest, WatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Esbuild_WatchServer = grpc.ServerStreamingServer[WatchEvent]
+
+func _Esbuild_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VersionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EsbuildServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Esbuild_Version_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EsbuildServer).Version(ctx, req.(*VersionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Esbuild_ServiceDesc is the grpc.ServiceDesc for Esbuild service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Esbuild_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "esbuild_py.v1.Esbuild",
+	HandlerType: (*EsbuildServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Transform",
+			Handler:    _Esbuild_Transform_Handler,
+		},
+		{
+			MethodName: "Build",
+			Handler:    _Esbuild_Build_Handler,
+		},
+		{
+			MethodName: "Version",
+			Handler:    _Esbuild_Version_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Esbuild_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "esbuild.proto",
+}
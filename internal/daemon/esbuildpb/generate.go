@@ -0,0 +1,5 @@
+// Package esbuildpb holds the protobuf messages and gRPC service generated
+// from esbuild.proto.
+package esbuildpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative esbuild.proto
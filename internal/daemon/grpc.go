@@ -0,0 +1,226 @@
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/keller-mark/esbuild-py/internal/daemon/esbuildpb"
+	"github.com/keller-mark/esbuild-py/internal/runner"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// watchPollInterval is how often a Watch call checks whether its client is
+// gone while waiting for the next rebuild.
+const watchPollInterval = 250 * time.Millisecond
+
+// NewGRPCServer creates a gRPC server for the Esbuild service defined in
+// esbuildpb/esbuild.proto. If token isn't empty, calls must carry it as an
+// `authorization: Bearer` metadata entry.
+func NewGRPCServer(token string) *grpc.Server {
+	var options []grpc.ServerOption
+	if token != "" {
+		expected := []byte("Bearer " + token)
+		authorize := func(ctx context.Context) error {
+			md, _ := metadata.FromIncomingContext(ctx)
+			for _, value := range md.Get("authorization") {
+				if subtle.ConstantTimeCompare([]byte(value), expected) == 1 {
+					return nil
+				}
+			}
+			return status.Error(codes.Unauthenticated, "Missing or invalid bearer token")
+		}
+		options = append(options,
+			grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if err := authorize(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := authorize(stream.Context()); err != nil {
+					return err
+				}
+				return handler(srv, stream)
+			}),
+		)
+	}
+	server := grpc.NewServer(options...)
+	esbuildpb.RegisterEsbuildServer(server, grpcService{})
+	return server
+}
+
+// grpcService implements the Esbuild service with the same code as the
+// other APIs, converting its requests to their JSON form.
+type grpcService struct {
+	esbuildpb.UnimplementedEsbuildServer
+}
+
+func (grpcService) Transform(ctx context.Context, req *esbuildpb.TransformRequest) (*esbuildpb.Response, error) {
+	request, err := json.Marshal(map[string]any{
+		"code":    req.GetCode(),
+		"options": req.GetOptions().AsMap(),
+	})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return newGRPCResponse(runner.Recovered(func() *shared.ApiResponse {
+		return runner.Transform(ctx, request, shared.EncodingJSON)
+	}))
+}
+
+func (grpcService) Build(ctx context.Context, req *esbuildpb.BuildRequest) (*esbuildpb.Response, error) {
+	request, err := json.Marshal(req.GetOptions().AsMap())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return newGRPCResponse(runner.Recovered(func() *shared.ApiResponse {
+		return runner.Build(ctx, request, shared.EncodingJSON)
+	}))
+}
+
+// Watch creates a context from the build options and watches it, sending
+// its rebuild events until the client cancels the call, which disposes the
+// context.
+func (grpcService) Watch(req *esbuildpb.BuildRequest, stream esbuildpb.Esbuild_WatchServer) error {
+	request, err := json.Marshal(req.GetOptions().AsMap())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	created := runner.CreateContext(request, shared.EncodingJSON)
+	if len(created.Errors) > 0 {
+		texts := make([]string, 0, len(created.Errors))
+		for _, msg := range created.Errors {
+			texts = append(texts, msg.Text)
+		}
+		return status.Error(codes.InvalidArgument, strings.Join(texts, "\n"))
+	}
+	id := created.Context
+	defer runner.DisposeContext(id)
+	if err := runner.WatchContext(id); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	for {
+		event, err := runner.PollWatchEvent(id, watchPollInterval)
+		if err != nil {
+			return status.Error(codes.Aborted, err.Error())
+		}
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if event == nil {
+			continue
+		}
+		if err := stream.Send(&esbuildpb.WatchEvent{
+			Success:        event.Success,
+			DurationMs:     event.DurationMs,
+			ChangedFiles:   event.ChangedFiles,
+			ChangedOutputs: event.ChangedOutputs,
+			Errors:         newGRPCMessages(event.Errors),
+			Warnings:       newGRPCMessages(event.Warnings),
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+func (grpcService) Version(ctx context.Context, req *esbuildpb.VersionRequest) (*esbuildpb.VersionInfo, error) {
+	info := shared.NewVersionInfo()
+	return &esbuildpb.VersionInfo{
+		Esbuild:  info.Esbuild,
+		Bindings: info.Bindings,
+		Protocol: int32(info.Protocol),
+	}, nil
+}
+
+// grpcResponseFields are the fields of the JSON response that have their
+// own field in esbuildpb.Response, rather than being in its details.
+var grpcResponseFields = []string{"code", "errors", "warnings", "outputFiles", "metafile", "timings"}
+
+// newGRPCResponse converts a response to its protobuf form.
+func newGRPCResponse(response *shared.ApiResponse) (*esbuildpb.Response, error) {
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to marshal response: "+err.Error())
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, status.Error(codes.Internal, "Failed to marshal response: "+err.Error())
+	}
+	for _, name := range grpcResponseFields {
+		delete(fields, name)
+	}
+	details, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to marshal response: "+err.Error())
+	}
+
+	converted := &esbuildpb.Response{
+		Code:     response.Code,
+		Errors:   newGRPCMessages(response.Errors),
+		Warnings: newGRPCMessages(response.Warnings),
+		Metafile: response.Metafile,
+		Details:  details,
+	}
+	for _, file := range response.OutputFiles {
+		converted.OutputFiles = append(converted.OutputFiles, &esbuildpb.OutputFile{
+			Path: file.Path,
+			Hash: file.Hash,
+			Text: file.Text,
+		})
+	}
+	if timings := response.Timings; timings != nil {
+		converted.Timings = &esbuildpb.Timings{
+			ValidateMs: timings.ValidateMs,
+			QueueMs:    timings.QueueMs,
+			EsbuildMs:  timings.EsbuildMs,
+			ProcessMs:  timings.ProcessMs,
+			TotalMs:    timings.TotalMs,
+		}
+	}
+	return converted, nil
+}
+
+// newGRPCMessages converts messages to their protobuf form.
+func newGRPCMessages(messages []shared.Message) []*esbuildpb.Message {
+	converted := make([]*esbuildpb.Message, 0, len(messages))
+	for _, msg := range messages {
+		notes := make([]*esbuildpb.Note, 0, len(msg.Notes))
+		for _, note := range msg.Notes {
+			notes = append(notes, &esbuildpb.Note{Text: note.Text, Location: newGRPCLocation(note.Location)})
+		}
+		converted = append(converted, &esbuildpb.Message{
+			Id:         msg.ID,
+			PluginName: msg.PluginName,
+			Text:       msg.Text,
+			Location:   newGRPCLocation(msg.Location),
+			Notes:      notes,
+		})
+	}
+	return converted
+}
+
+// newGRPCLocation converts a location to its protobuf form.
+func newGRPCLocation(location *shared.Location) *esbuildpb.Location {
+	if location == nil {
+		return nil
+	}
+	return &esbuildpb.Location{
+		File:       location.File,
+		Namespace:  location.Namespace,
+		Line:       int32(location.Line),
+		Column:     int32(location.Column),
+		Length:     int32(location.Length),
+		LineText:   location.LineText,
+		Suggestion: location.Suggestion,
+	}
+}
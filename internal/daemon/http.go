@@ -0,0 +1,116 @@
+package daemon
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/keller-mark/esbuild-py/internal/runner"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// NewHTTPHandler serves the bindings as a JSON API: `POST /transform` and
+// `POST /build` take the same JSON requests as the native library and
+// respond with the same JSON, and `GET /version` returns the versions.
+// Builds and transforms are cancelled if the client disconnects. If token
+// isn't empty, requests must carry it as an `Authorization: Bearer` header.
+// Otherwise their `Host` must be a loopback name, so that a web page can't
+// reach the API through DNS rebinding. Either way, POST requests must be
+// `application/json`, which browsers can't send across origins without a
+// CORS preflight that the API doesn't answer.
+func NewHTTPHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/transform", func(w http.ResponseWriter, r *http.Request) {
+		serveRequest(w, r, func(body []byte) *shared.ApiResponse {
+			return runner.Transform(r.Context(), body, shared.EncodingJSON)
+		})
+	})
+	mux.HandleFunc("/build", func(w http.ResponseWriter, r *http.Request) {
+		serveRequest(w, r, func(body []byte) *shared.ApiResponse {
+			return runner.Build(r.Context(), body, shared.EncodingJSON)
+		})
+	})
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, shared.NewVersionInfo())
+	})
+	if token == "" {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isLoopbackHost(r.Host) {
+				http.Error(w, "Forbidden host", http.StatusForbidden)
+				return
+			}
+			mux.ServeHTTP(w, r)
+		})
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// serveRequest reads the JSON request in the body of a POST request and
+// writes the response of serve to it.
+func serveRequest(w http.ResponseWriter, r *http.Request, serve func(body []byte) *shared.ApiResponse) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxFrameSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read the request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, runner.Recovered(func() *shared.ApiResponse {
+		return serve(body)
+	}))
+}
+
+// isLoopbackHost reports whether the `Host` of a request, with or without a
+// port, is `localhost` or a loopback IP address.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, response any) {
+	payload, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to marshal response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
@@ -0,0 +1,67 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveHTTP serves a request to NewHTTPHandler(token) and returns the status.
+func serveHTTP(token string, r *http.Request) int {
+	w := httptest.NewRecorder()
+	NewHTTPHandler(token).ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestHTTPContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        int
+	}{
+		{"application/json", http.StatusOK},
+		{"application/json; charset=utf-8", http.StatusOK},
+		{"", http.StatusUnsupportedMediaType},
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:8123/transform", strings.NewReader(`{"code": "let x = 1"}`))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		if got := serveHTTP("", r); got != test.want {
+			t.Errorf("Content-Type %q: status = %d, want %d", test.contentType, got, test.want)
+		}
+	}
+}
+
+func TestHTTPHost(t *testing.T) {
+	tests := []struct {
+		host  string
+		token string
+		want  int
+	}{
+		{"127.0.0.1:8123", "", http.StatusOK},
+		{"127.0.0.2", "", http.StatusOK},
+		{"localhost:8123", "", http.StatusOK},
+		{"LOCALHOST", "", http.StatusOK},
+		{"[::1]:8123", "", http.StatusOK},
+		{"[::1]", "", http.StatusOK},
+		{"attacker.example:8123", "", http.StatusForbidden},
+		{"localhost.attacker.example", "", http.StatusForbidden},
+		{"192.168.1.2:8123", "", http.StatusForbidden},
+		{"", "", http.StatusForbidden},
+		{"attacker.example:8123", "secret", http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/version", nil)
+		r.Host = test.host
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		if got := serveHTTP(test.token, r); got != test.want {
+			t.Errorf("Host %q with token %q: status = %d, want %d", test.host, test.token, got, test.want)
+		}
+	}
+}
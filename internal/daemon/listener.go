@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ServeListener serves each connection accepted by ln with Serve, so that
+// several clients share the daemon along with its contexts and caches. Once
+// ln is closed, it closes the connections and returns nil.
+func ServeListener(ctx context.Context, ln net.Listener) error {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		conns = make(map[net.Conn]bool)
+	)
+	defer func() {
+		mu.Lock()
+		for conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		conns[conn] = true
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := Serve(ctx, conn, conn); err != nil && !errors.Is(err, net.ErrClosed) {
+				fmt.Fprintf(os.Stderr, "esbuild-py: %v\n", err)
+			}
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// Listen listens on a Windows named pipe if address is the name of one,
+// such as `\\.\pipe\esbuild-py`, and on a Unix domain socket otherwise.
+func Listen(address string) (net.Listener, error) {
+	if strings.HasPrefix(address, `\\.\pipe\`) {
+		return ListenPipe(address)
+	}
+	return ListenUnix(address)
+}
+
+// ListenUnix listens on a Unix domain socket at path, which only the
+// current user may connect to. A socket left behind by a daemon that
+// didn't shut down cleanly is replaced, but any other file is kept.
+func ListenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and isn't a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another daemon is listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return listenPrivate(path)
+}
+
+// ListenTCP listens on a TCP address for the HTTP API or the gRPC service.
+// Builds read and write files wherever their options point, so without a
+// token it only listens on loopback addresses, which other machines can't
+// reach.
+func ListenTCP(address string, token string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		if addr, ok := ln.Addr().(*net.TCPAddr); !ok || !addr.IP.IsLoopback() {
+			ln.Close()
+			return nil, fmt.Errorf("refusing to serve %s without a token, as it isn't a loopback address; set $ESBUILD_PY_HTTP_TOKEN or --http-token", address)
+		}
+	}
+	return ln, nil
+}
@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestListenTCP(t *testing.T) {
+	tests := []struct {
+		address string
+		token   string
+		refused bool
+	}{
+		{"127.0.0.1:0", "", false},
+		{"localhost:0", "", false},
+		{"0.0.0.0:0", "", true},
+		{":0", "", true},
+		{"0.0.0.0:0", "secret", false},
+	}
+	for _, test := range tests {
+		ln, err := ListenTCP(test.address, test.token)
+		if test.refused {
+			if err == nil || !strings.Contains(err.Error(), "without a token") {
+				t.Errorf("ListenTCP(%q, %q) = %v, want it refused", test.address, test.token, err)
+			}
+		} else if err != nil {
+			t.Errorf("ListenTCP(%q, %q) = %v", test.address, test.token, err)
+		}
+		if ln != nil {
+			ln.Close()
+		}
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes aren't enforced on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "esbuild-py.sock")
+	ln, err := ListenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("socket mode = %v, want %v", mode, os.FileMode(0o600))
+	}
+	if _, err := ListenUnix(path); err == nil || !strings.Contains(err.Error(), "another daemon") {
+		t.Errorf("ListenUnix on a socket in use = %v, want it refused", err)
+	}
+}
@@ -0,0 +1,165 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/runner"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// method serves the requests of one JSON-RPC method. Its result is
+// serialized as the `result` of the response, while an *Error becomes the
+// `error` of the response.
+type method func(ctx context.Context, params json.RawMessage) (any, error)
+
+// methods maps the JSON-RPC methods to the functions of the native library
+// they mirror. Their params and results are the requests and responses of
+// these functions.
+var methods = map[string]method{
+	"transform": func(ctx context.Context, params json.RawMessage) (any, error) {
+		return runner.Transform(ctx, params, shared.EncodingJSON), nil
+	},
+	"build": func(ctx context.Context, params json.RawMessage) (any, error) {
+		return runner.Build(ctx, params, shared.EncodingJSON), nil
+	},
+	"transform_many": func(ctx context.Context, params json.RawMessage) (any, error) {
+		entries, err := shared.DecodeTransformBatch(params)
+		if err != nil {
+			return shared.NewBatchErrorResponse([]api.Message{shared.NewRequestError("Failed to parse batch request JSON: " + err.Error())}), nil
+		}
+		return shared.RunTransformBatch(entries, runtime.NumCPU(), func(req shared.TransformRequest) *shared.ApiResponse {
+			return runner.Recovered(func() *shared.ApiResponse {
+				return runner.ExecuteTransform(ctx, req)
+			})
+		}), nil
+	},
+	"context_create": func(ctx context.Context, params json.RawMessage) (any, error) {
+		return runner.CreateContext(params, shared.EncodingJSON), nil
+	},
+	"context_rebuild": func(ctx context.Context, params json.RawMessage) (any, error) {
+		id, err := contextID(params)
+		if err != nil {
+			return nil, err
+		}
+		return runner.RebuildContext(ctx, id), nil
+	},
+	"context_dispose": func(ctx context.Context, params json.RawMessage) (any, error) {
+		id, err := contextID(params)
+		if err != nil {
+			return nil, err
+		}
+		if err := runner.DisposeContext(id); err != nil {
+			return nil, &Error{Code: InvalidParams, Message: err.Error()}
+		}
+		return struct{}{}, nil
+	},
+	"list_contexts": func(ctx context.Context, params json.RawMessage) (any, error) {
+		return runner.ListContexts(), nil
+	},
+	"configure": func(ctx context.Context, params json.RawMessage) (any, error) {
+		var config shared.Config
+		if err := decodeParams(params, &config); err != nil {
+			return nil, err
+		}
+		return runner.Configure(config), nil
+	},
+	"analyze_metafile": func(ctx context.Context, params json.RawMessage) (any, error) {
+		var req shared.AnalyzeMetafileRequest
+		if err := decodeParams(params, &req); err != nil {
+			return nil, err
+		}
+		return shared.AnalyzeMetafile(req), nil
+	},
+	"format_messages": func(ctx context.Context, params json.RawMessage) (any, error) {
+		var req shared.FormatMessagesRequest
+		if err := decodeParams(params, &req); err != nil {
+			return nil, err
+		}
+		return shared.FormatMessages(req), nil
+	},
+	"stats": func(ctx context.Context, params json.RawMessage) (any, error) {
+		return runner.Stats(), nil
+	},
+	"version": func(ctx context.Context, params json.RawMessage) (any, error) {
+		return shared.NewVersionInfo(), nil
+	},
+}
+
+// The capabilities method lists the methods themselves, so it can only be
+// added once the table exists.
+func init() {
+	methods["capabilities"] = func(ctx context.Context, params json.RawMessage) (any, error) {
+		return shared.NewCapabilities(methodNames()), nil
+	}
+}
+
+// methodNames lists the methods served by the daemon, including `cancel`,
+// which is handled by the session rather than dispatched.
+func methodNames() []string {
+	names := []string{"cancel"}
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dispatch serves a request with the function of its method. A panic is
+// converted into an internal error response, as in the native library.
+func Dispatch(ctx context.Context, req Request) (response Response) {
+	response = Response{JSONRPC: "2.0", ID: req.ID}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			response.Result = shared.NewPanicResponse(recovered, debug.Stack())
+			response.Error = nil
+		}
+	}()
+
+	serve, ok := methods[req.Method]
+	if !ok {
+		response.Error = &Error{Code: MethodNotFound, Message: fmt.Sprintf("Unknown method %q", req.Method)}
+		return response
+	}
+	result, err := serve(ctx, req.Params)
+	if err != nil {
+		rpcErr, ok := err.(*Error)
+		if !ok {
+			rpcErr = &Error{Code: InvalidParams, Message: err.Error()}
+		}
+		response.Error = rpcErr
+		return response
+	}
+	response.Result = result
+	return response
+}
+
+// decodeParams decodes the params of a request into v.
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{Code: InvalidParams, Message: "Failed to parse params: " + err.Error()}
+	}
+	return nil
+}
+
+// contextID decodes the `{"id": handle}` params of the context methods.
+func contextID(params json.RawMessage) (uint64, error) {
+	var req struct {
+		ID *uint64 `json:"id"`
+	}
+	if err := decodeParams(params, &req); err != nil {
+		return 0, err
+	}
+	if req.ID == nil {
+		return 0, &Error{Code: InvalidParams, Message: "Missing context id"}
+	}
+	return *req.ID, nil
+}
@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		params string
+		code   int
+	}{
+		{"version", "version", "", 0},
+		{"transform", "transform", `{"code": "let x: number = 1", "options": {"loader": "ts"}}`, 0},
+		{"unknown method", "transfrom", "", MethodNotFound},
+		{"invalid params", "format_messages", `[1]`, InvalidParams},
+		{"missing context id", "context_rebuild", `{}`, InvalidParams},
+		{"unknown context", "context_dispose", `{"id": 123456789}`, InvalidParams},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := Dispatch(context.Background(), Request{ID: json.RawMessage(`7`), Method: test.method, Params: json.RawMessage(test.params)})
+			if string(response.ID) != "7" {
+				t.Errorf("id = %s, want 7", response.ID)
+			}
+			switch {
+			case test.code == 0 && response.Error != nil:
+				t.Errorf("error = %v", response.Error)
+			case test.code == 0 && response.Result == nil:
+				t.Errorf("no result")
+			case test.code != 0 && (response.Error == nil || response.Error.Code != test.code):
+				t.Errorf("error = %v, want code %d", response.Error, test.code)
+			}
+		})
+	}
+}
+
+func TestDispatchTransform(t *testing.T) {
+	var result struct {
+		Code   string `json:"code"`
+		Errors []any  `json:"errors"`
+	}
+	dispatchResult(t, "transform", `{"code": "let x: number = 1", "options": {"loader": "ts"}}`, &result)
+	if result.Code != "let x = 1;\n" || len(result.Errors) != 0 {
+		t.Errorf("result = %+v", result)
+	}
+	dispatchResult(t, "transform", `{"code": "let x: number =", "options": {"loader": "ts"}}`, &result)
+	if len(result.Errors) != 1 {
+		t.Errorf("a syntax error isn't in the result: %+v", result)
+	}
+}
+
+func TestDispatchContexts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.js"), []byte("console.log(1)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	request, _ := json.Marshal(map[string]any{"entryPoints": []string{"main.js"}, "outdir": "dist", "absWorkingDir": dir, "write": false})
+	var created struct {
+		Context uint64 `json:"context"`
+		Errors  []any  `json:"errors"`
+	}
+	dispatchResult(t, "context_create", string(request), &created)
+	if created.Context == 0 || len(created.Errors) != 0 {
+		t.Fatalf("context_create = %+v", created)
+	}
+	id, _ := json.Marshal(map[string]uint64{"id": created.Context})
+
+	var rebuilt struct {
+		Errors      []any `json:"errors"`
+		OutputFiles []any `json:"outputFiles"`
+	}
+	dispatchResult(t, "context_rebuild", string(id), &rebuilt)
+	if len(rebuilt.Errors) != 0 || len(rebuilt.OutputFiles) != 1 {
+		t.Errorf("context_rebuild = %+v", rebuilt)
+	}
+	dispatchResult(t, "context_dispose", string(id), &struct{}{})
+	if response := Dispatch(context.Background(), Request{Method: "context_dispose", Params: id}); response.Error == nil {
+		t.Errorf("a disposed context can be disposed again")
+	}
+}
+
+// dispatchResult dispatches a request and decodes its result into v.
+func dispatchResult(t *testing.T, method string, params string, v any) {
+	t.Helper()
+	response := Dispatch(context.Background(), Request{ID: json.RawMessage(`1`), Method: method, Params: json.RawMessage(params)})
+	if response.Error != nil {
+		t.Fatalf("%s: %v", method, response.Error)
+	}
+	payload, err := json.Marshal(response.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		t.Fatal(err)
+	}
+}
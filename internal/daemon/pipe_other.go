@@ -0,0 +1,13 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"errors"
+	"net"
+)
+
+// ListenPipe fails, since named pipes only exist on Windows.
+func ListenPipe(name string) (net.Listener, error) {
+	return nil, errors.New("named pipes are only supported on Windows")
+}
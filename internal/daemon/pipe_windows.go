@@ -0,0 +1,202 @@
+//go:build windows
+
+package daemon
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeBufferSize is the size of the input and output buffers of each
+// instance of a named pipe.
+const pipeBufferSize = 64 << 10
+
+// ListenPipe listens on a Windows named pipe such as `\\.\pipe\esbuild-py`.
+// Only local clients may connect, and by the default security of named
+// pipes, only the current user and administrators may write to it. It fails
+// if another daemon is listening on the same pipe.
+func ListenPipe(name string) (net.Listener, error) {
+	handle, err := createPipe(name, true)
+	if err != nil {
+		if err == windows.ERROR_ACCESS_DENIED {
+			return nil, errors.New("another daemon is listening on " + name)
+		}
+		return nil, &os.PathError{Op: "listen", Path: name, Err: err}
+	}
+	return &pipeListener{name: name, next: handle}, nil
+}
+
+// createPipe creates an instance of a named pipe for overlapped I/O, so
+// that a connection can be read and written at the same time, and pending
+// operations can be cancelled when it's closed.
+func createPipe(name string, first bool) (windows.Handle, error) {
+	path, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	mode := uint32(windows.PIPE_TYPE_BYTE | windows.PIPE_READMODE_BYTE | windows.PIPE_WAIT | windows.PIPE_REJECT_REMOTE_CLIENTS)
+	return windows.CreateNamedPipe(path, flags, mode, windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, nil)
+}
+
+// overlappedIO starts an I/O operation on handle and waits for it to
+// finish, returning the number of bytes transferred.
+func overlappedIO(handle windows.Handle, start func(done *uint32, o *windows.Overlapped) error) (uint32, error) {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(event)
+
+	var done uint32
+	o := windows.Overlapped{HEvent: event}
+	if err := start(&done, &o); err != nil && err != windows.ERROR_IO_PENDING {
+		return 0, err
+	}
+	err = windows.GetOverlappedResult(handle, &o, &done, true)
+	return done, err
+}
+
+// pipeListener accepts the connections to a named pipe. Each one is made
+// to an instance of the pipe, so a new instance is created for the next
+// client as soon as one connects.
+type pipeListener struct {
+	name string
+
+	mu        sync.Mutex
+	next      windows.Handle
+	accepting bool
+	closed    bool
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	handle := l.next
+	l.accepting = true
+	l.mu.Unlock()
+
+	_, err := overlappedIO(handle, func(done *uint32, o *windows.Overlapped) error {
+		return windows.ConnectNamedPipe(handle, o)
+	})
+	if err == windows.ERROR_PIPE_CONNECTED {
+		// The client connected before ConnectNamedPipe was called.
+		err = nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.accepting = false
+	if l.closed {
+		windows.CloseHandle(handle)
+		return nil, net.ErrClosed
+	}
+	if err != nil {
+		return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: pipeAddr(l.name), Err: err}
+	}
+	next, err := createPipe(l.name, false)
+	if err != nil {
+		windows.CloseHandle(handle)
+		return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: pipeAddr(l.name), Err: err}
+	}
+	l.next = next
+	return &pipeConn{handle: handle, name: l.name}, nil
+}
+
+// Close stops accepting connections. A pending Accept is cancelled and
+// releases the instance it waits on itself.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return net.ErrClosed
+	}
+	l.closed = true
+	if l.accepting {
+		return windows.CancelIoEx(l.next, nil)
+	}
+	return windows.CloseHandle(l.next)
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.name)
+}
+
+// pipeConn is a connection to an instance of a named pipe.
+type pipeConn struct {
+	handle windows.Handle
+	name   string
+	closed atomic.Bool
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n, err := overlappedIO(c.handle, func(done *uint32, o *windows.Overlapped) error {
+		return windows.ReadFile(c.handle, b, done, o)
+	})
+	return int(n), c.mapError("read", err)
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := overlappedIO(c.handle, func(done *uint32, o *windows.Overlapped) error {
+			return windows.WriteFile(c.handle, b[written:], done, o)
+		})
+		written += int(n)
+		if err != nil {
+			return written, c.mapError("write", err)
+		}
+	}
+	return written, nil
+}
+
+// mapError converts the errors of the pipe to those of net.Conn: the
+// client disconnecting ends the stream being read, and operations
+// cancelled by Close fail with net.ErrClosed.
+func (c *pipeConn) mapError(op string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case c.closed.Load():
+		return net.ErrClosed
+	case op == "read" && (err == windows.ERROR_BROKEN_PIPE || err == windows.ERROR_PIPE_NOT_CONNECTED):
+		return io.EOF
+	}
+	return &net.OpError{Op: op, Net: "pipe", Addr: pipeAddr(c.name), Err: err}
+}
+
+func (c *pipeConn) Close() error {
+	if c.closed.Swap(true) {
+		return net.ErrClosed
+	}
+	windows.CancelIoEx(c.handle, nil)
+	return windows.CloseHandle(c.handle)
+}
+
+func (c *pipeConn) LocalAddr() net.Addr                { return pipeAddr(c.name) }
+func (c *pipeConn) RemoteAddr() net.Addr               { return pipeAddr(c.name) }
+func (c *pipeConn) SetDeadline(t time.Time) error      { return os.ErrNoDeadline }
+func (c *pipeConn) SetReadDeadline(t time.Time) error  { return os.ErrNoDeadline }
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return os.ErrNoDeadline }
+
+// pipeAddr is the address of a named pipe, i.e. its name.
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
@@ -0,0 +1,152 @@
+// Package daemon serves the bindings as JSON-RPC over a stream of
+// length-prefixed frames, so that a long-lived process can stand in for the
+// shared library where it can't be loaded.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Serve reads requests from r and serves each one concurrently, writing
+// its response to w as soon as it's done, so that a slow build doesn't hold
+// up the transforms sent after it. Clients match the responses to their
+// requests by ID. Once r ends between two frames, Serve waits for the
+// running requests and returns nil; if reading fails, it cancels them and
+// returns the error.
+func Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s := &session{w: w, running: make(map[string]context.CancelFunc)}
+	defer s.wg.Wait()
+	for {
+		payload, err := ReadFrame(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			cancel()
+			return err
+		}
+
+		var req Request
+		if err := json.Unmarshal(payload, &req); err != nil {
+			s.respond(Response{JSONRPC: "2.0", Error: &Error{Code: ParseError, Message: "Failed to parse request JSON: " + err.Error()}})
+			continue
+		}
+		switch req.Method {
+		case "":
+			s.respond(Response{JSONRPC: "2.0", ID: req.ID, Error: &Error{Code: InvalidRequest, Message: "Missing method"}})
+		case "cancel":
+			if response := s.cancel(req); !req.notification() {
+				s.respond(response)
+			}
+		default:
+			s.start(ctx, req)
+		}
+	}
+}
+
+// session holds the state of the requests read from one stream.
+type session struct {
+	wg sync.WaitGroup
+
+	writeMu  sync.Mutex
+	w        io.Writer
+	writeErr error
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+// start serves a request in the background. Requests with an ID can be
+// cancelled until they're done; another request can't reuse the ID until
+// then. Notifications are served without a response.
+func (s *session) start(ctx context.Context, req Request) {
+	ctx, cancel := context.WithCancel(ctx)
+	key := string(req.ID)
+	hasID := req.ID != nil && key != "null"
+	if hasID {
+		s.mu.Lock()
+		_, duplicate := s.running[key]
+		if !duplicate {
+			s.running[key] = cancel
+		}
+		s.mu.Unlock()
+		if duplicate {
+			cancel()
+			s.respond(Response{JSONRPC: "2.0", ID: req.ID, Error: &Error{Code: InvalidRequest, Message: fmt.Sprintf("Request %s is already running", key)}})
+			return
+		}
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		response := Dispatch(ctx, req)
+		if hasID {
+			s.mu.Lock()
+			delete(s.running, key)
+			s.mu.Unlock()
+		}
+		if !req.notification() {
+			s.respond(response)
+		}
+	}()
+}
+
+// cancel serves a `cancel` request, whose `{"id": id}` params name a
+// running request. The cancelled request still gets its response, with
+// `"kind": "cancelled"` unless it was about to finish anyway.
+func (s *session) cancel(req Request) Response {
+	response := Response{JSONRPC: "2.0", ID: req.ID}
+	var params struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if err := decodeParams(req.Params, &params); err != nil {
+		response.Error = err.(*Error)
+		return response
+	}
+	if params.ID == nil {
+		response.Error = &Error{Code: InvalidParams, Message: "Missing request id"}
+		return response
+	}
+
+	s.mu.Lock()
+	cancel, ok := s.running[string(params.ID)]
+	s.mu.Unlock()
+	if !ok {
+		response.Error = &Error{Code: InvalidParams, Message: fmt.Sprintf("Request %s isn't running", params.ID)}
+		return response
+	}
+	cancel()
+	response.Result = struct{}{}
+	return response
+}
+
+// respond writes a response as a frame. Responses are written one at a
+// time, and not at all after a write failed.
+func (s *session) respond(response Response) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.writeErr == nil {
+		s.writeErr = writeResponse(s.w, response)
+	}
+}
+
+// writeResponse writes a response as a frame.
+func writeResponse(w io.Writer, response Response) error {
+	payload, err := json.Marshal(response)
+	if err != nil {
+		payload, err = json.Marshal(Response{JSONRPC: "2.0", ID: response.ID, Error: &Error{Code: InternalError, Message: "Failed to marshal response: " + err.Error()}})
+		if err != nil {
+			return err
+		}
+	}
+	return WriteFrame(w, payload)
+}
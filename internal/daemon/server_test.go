@@ -0,0 +1,115 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// serveFrames serves the given requests as one stream and returns the
+// responses by ID, each ID's in the order they were written.
+func serveFrames(t *testing.T, requests ...string) map[string][]Response {
+	t.Helper()
+	var in, out bytes.Buffer
+	for _, request := range requests {
+		if err := WriteFrame(&in, []byte(request)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Serve(context.Background(), &in, &out); err != nil {
+		t.Fatal(err)
+	}
+	responses := make(map[string][]Response)
+	for {
+		payload, err := ReadFrame(&out)
+		if err == io.EOF {
+			return responses
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var response Response
+		if err := json.Unmarshal(payload, &response); err != nil {
+			t.Fatal(err)
+		}
+		responses[string(response.ID)] = append(responses[string(response.ID)], response)
+	}
+}
+
+// addBlockingMethod adds a `block` method, which runs until it's cancelled,
+// so that the requests after it find it running.
+func addBlockingMethod(t *testing.T) {
+	methods["block"] = func(ctx context.Context, params json.RawMessage) (any, error) {
+		<-ctx.Done()
+		return "cancelled", nil
+	}
+	t.Cleanup(func() { delete(methods, "block") })
+}
+
+func TestServeNotifications(t *testing.T) {
+	responses := serveFrames(t,
+		`{"jsonrpc": "2.0", "method": "version"}`,
+		`{"jsonrpc": "2.0", "method": "cancel", "params": {"id": 7}}`,
+		`{"jsonrpc": "2.0", "id": null, "method": "version"}`,
+		`{"jsonrpc": "2.0", "id": 1, "method": "version"}`,
+	)
+	if len(responses) != 2 {
+		t.Fatalf("got responses for %d IDs, want 2: %v", len(responses), responses)
+	}
+	for _, id := range []string{"null", "1"} {
+		if r := responses[id]; len(r) != 1 || r[0].Error != nil {
+			t.Errorf("responses %s = %+v", id, r)
+		}
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	responses := serveFrames(t,
+		`{"jsonrpc": "2.0", "id": 1, "method": `,
+		`{"jsonrpc": "2.0", "id": 2}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "cancel", "params": {"id": 42}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "cancel", "params": {}}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "nope"}`,
+	)
+	for id, code := range map[string]int{"null": ParseError, "2": InvalidRequest, "3": InvalidParams, "4": InvalidParams, "5": MethodNotFound} {
+		if r := responses[id]; len(r) != 1 || r[0].Error == nil || r[0].Error.Code != code {
+			t.Errorf("responses %s = %+v, want an error with code %d", id, r, code)
+		}
+	}
+}
+
+func TestServeCancel(t *testing.T) {
+	addBlockingMethod(t)
+	responses := serveFrames(t,
+		`{"jsonrpc": "2.0", "id": "a", "method": "block"}`,
+		`{"jsonrpc": "2.0", "id": "b", "method": "cancel", "params": {"id": "a"}}`,
+	)
+	if r := responses[`"a"`]; len(r) != 1 || r[0].Error != nil || r[0].Result != "cancelled" {
+		t.Errorf("the blocked request wasn't cancelled: %+v", r)
+	}
+	if r := responses[`"b"`]; len(r) != 1 || r[0].Error != nil {
+		t.Errorf("cancel = %+v", r)
+	}
+}
+
+func TestServeDuplicateID(t *testing.T) {
+	addBlockingMethod(t)
+	responses := serveFrames(t,
+		`{"jsonrpc": "2.0", "id": 1, "method": "block"}`,
+		`{"jsonrpc": "2.0", "id": 1, "method": "version"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "cancel", "params": {"id": 1}}`,
+	)
+	r := responses["1"]
+	if len(r) != 2 || r[0].Error == nil || r[0].Error.Code != InvalidRequest {
+		t.Errorf("a running request's ID was reused: %+v", r)
+	}
+	var cancelled bool
+	for _, response := range r {
+		cancelled = cancelled || response.Result == "cancelled"
+	}
+	if !cancelled {
+		t.Errorf("the blocked request wasn't cancelled: %+v", r)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package daemon
+
+import (
+	"net"
+	"os"
+)
+
+// listenPrivate creates the socket at path and restricts it to the owner,
+// as far as the platform honours file modes, since there is no umask.
+func listenPrivate(path string) (net.Listener, error) {
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
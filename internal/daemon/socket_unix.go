@@ -0,0 +1,18 @@
+//go:build unix
+
+package daemon
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenPrivate creates the socket at path with the umask masking every
+// permission but the owner's read and write ones, so that no other user can
+// connect before it could be chmod'ed. The umask is process-wide, but
+// ListenUnix runs at startup, before the daemon creates any other file.
+func listenPrivate(path string) (net.Listener, error) {
+	umask := syscall.Umask(0o177)
+	defer syscall.Umask(umask)
+	return net.Listen("unix", path)
+}
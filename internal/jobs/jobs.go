@@ -0,0 +1,159 @@
+// Package jobs runs operations in the background on behalf of Python, so
+// that callers can submit a build, keep the Python thread free, and collect
+// the response later using the job's ID.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Job is a single operation running in the background.
+type Job struct {
+	ID uint64
+
+	done   chan struct{}
+	result any
+	cancel context.CancelFunc
+}
+
+// Registry tracks the jobs that have been submitted but whose results have
+// not been collected yet.
+type Registry struct {
+	mu     sync.Mutex
+	nextID uint64
+	jobs   map[uint64]*Job
+
+	// onComplete, if set, receives the result of every job as soon as it
+	// finishes, instead of the result being kept for Poll and Wait.
+	onComplete func(id uint64, result any)
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{jobs: make(map[uint64]*Job)}
+}
+
+// Default is the registry used by the exported functions of the bindings.
+var Default = NewRegistry()
+
+// Submit starts run in a new goroutine and returns the ID of the job. The
+// value returned by run becomes the job's result.
+func (r *Registry) Submit(run func(ctx context.Context) any) uint64 {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.mu.Lock()
+	r.nextID++
+	job := &Job{
+		ID:     r.nextID,
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	r.jobs[job.ID] = job
+	r.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		job.result = run(ctx)
+
+		r.mu.Lock()
+		onComplete := r.onComplete
+		if onComplete != nil {
+			delete(r.jobs, job.ID)
+		}
+		r.mu.Unlock()
+
+		close(job.done)
+		if onComplete != nil {
+			onComplete(job.ID, job.result)
+		}
+	}()
+	return job.ID
+}
+
+// SetCompletionHandler registers a function that receives the result of each
+// job when it finishes. Results delivered this way can't be collected with
+// Poll or Wait. Passing nil restores the default behavior for jobs that
+// finish afterwards.
+func (r *Registry) SetCompletionHandler(onComplete func(id uint64, result any)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onComplete = onComplete
+}
+
+// Poll returns the result of a job if it has finished, in which case the job
+// is removed from the registry. The boolean is false while it's still
+// running.
+func (r *Registry) Poll(id uint64) (any, bool, error) {
+	job, err := r.get(id)
+	if err != nil {
+		return nil, false, err
+	}
+	select {
+	case <-job.done:
+		return r.collect(job), true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// Wait blocks until a job has finished and returns its result, like Poll.
+// A negative timeout waits indefinitely; if the timeout expires first, the
+// boolean is false and the job keeps running.
+func (r *Registry) Wait(id uint64, timeout time.Duration) (any, bool, error) {
+	job, err := r.get(id)
+	if err != nil {
+		return nil, false, err
+	}
+	if timeout < 0 {
+		<-job.done
+		return r.collect(job), true, nil
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-job.done:
+		return r.collect(job), true, nil
+	case <-timer.C:
+		return nil, false, nil
+	}
+}
+
+// Cancel cancels the context of a running job. The job's result is still
+// delivered as usual once it has stopped.
+func (r *Registry) Cancel(id uint64) error {
+	job, err := r.get(id)
+	if err != nil {
+		return err
+	}
+	job.cancel()
+	return nil
+}
+
+// CancelAll cancels the contexts of all running jobs.
+func (r *Registry) CancelAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		job.cancel()
+	}
+}
+
+func (r *Registry) get(id uint64) (*Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown request ID %d", id)
+	}
+	return job, nil
+}
+
+func (r *Registry) collect(job *Job) any {
+	r.mu.Lock()
+	delete(r.jobs, job.ID)
+	r.mu.Unlock()
+	return job.result
+}
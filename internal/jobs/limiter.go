@@ -0,0 +1,135 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned by Acquire once the limiter has been shut down.
+var ErrClosed = errors.New("the esbuild runtime has been shut down")
+
+// Limiter caps how many operations run at the same time. Unlike a buffered
+// channel, its limit can be changed while operations are running.
+type Limiter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	active  int
+	waiting int
+	closed  bool
+}
+
+// NewLimiter creates a limiter allowing limit concurrent operations, where
+// a limit of zero or less means no limit.
+func NewLimiter(limit int) *Limiter {
+	l := &Limiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// DefaultLimiter limits the builds and transforms run by the bindings. It
+// is unlimited until configured otherwise.
+var DefaultLimiter = NewLimiter(0)
+
+// Acquire blocks until an operation may start, or until ctx is done or the
+// limiter is shut down. Every
+// successful Acquire must be paired with a call to Release.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	// Wake up the waiting loop below when the context is cancelled.
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.cond.Broadcast()
+	})
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waiting++
+	defer func() { l.waiting-- }()
+	for !l.closed && l.limit > 0 && l.active >= l.limit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.cond.Wait()
+	}
+	if l.closed {
+		return ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.active++
+	return nil
+}
+
+// Release marks an operation started with Acquire as finished.
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.cond.Broadcast()
+}
+
+// Do runs fn once the limiter allows it, or returns the context's error if
+// ctx is done first.
+func (l *Limiter) Do(ctx context.Context, fn func()) error {
+	if err := l.Acquire(ctx); err != nil {
+		return err
+	}
+	defer l.Release()
+	fn()
+	return nil
+}
+
+// SetLimit changes the number of concurrent operations allowed. Operations
+// that are already running are not affected.
+func (l *Limiter) SetLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.cond.Broadcast()
+}
+
+// Limit returns the current limit, where zero means no limit.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit < 0 {
+		return 0
+	}
+	return l.limit
+}
+
+// Counts returns the number of running operations and of operations waiting
+// to start.
+func (l *Limiter) Counts() (active, waiting int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active, l.waiting
+}
+
+// Shutdown stops new operations from starting, including those already
+// waiting, and then waits until the running ones have finished or ctx is
+// done. The limiter can't be used again afterwards.
+func (l *Limiter) Shutdown(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.cond.Broadcast()
+	})
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.cond.Broadcast()
+	for l.active > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.cond.Wait()
+	}
+	return nil
+}
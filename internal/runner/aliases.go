@@ -0,0 +1,65 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// skipAliasPatterns marks the resolutions of rewritten paths, so that a
+// rewritten path isn't rewritten again.
+type skipAliasPatterns struct{}
+
+// aliasPatternsPlugin rewrites the imports matching the regular expressions
+// of `aliasPatterns`, which unlike esbuild's `alias` option can match part of
+// a path and use capture groups in the replacement. The first matching
+// pattern wins, and the rewritten path is resolved from the importing file.
+func aliasPatternsPlugin(aliases []shared.AliasPatternRequest) (api.Plugin, []api.Message) {
+	var errors []api.Message
+	patterns := make([]*regexp.Regexp, 0, len(aliases))
+	replacements := make([]string, 0, len(aliases))
+	alternatives := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		pattern, err := regexp.Compile(alias.Pattern)
+		if err != nil {
+			errors = append(errors, shared.NewOptionsError(
+				fmt.Sprintf("The alias pattern %q is not a valid Go regular expression: %v", alias.Pattern, err),
+				"Go regular expressions don't support lookarounds or backreferences."))
+			continue
+		}
+		patterns = append(patterns, pattern)
+		replacements = append(replacements, alias.Replacement)
+		alternatives = append(alternatives, "(?:"+alias.Pattern+")")
+	}
+
+	return api.Plugin{
+		Name: "esbuild-py:alias-patterns",
+		Setup: func(build api.PluginBuild) {
+			if len(alternatives) == 0 {
+				return
+			}
+			build.OnResolve(api.OnResolveOptions{Filter: strings.Join(alternatives, "|")}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				if _, ok := args.PluginData.(skipAliasPatterns); ok {
+					return api.OnResolveResult{}, nil
+				}
+				for i, pattern := range patterns {
+					if !pattern.MatchString(args.Path) {
+						continue
+					}
+					return onResolveResult(build.Resolve(pattern.ReplaceAllString(args.Path, replacements[i]), api.ResolveOptions{
+						Importer:   args.Importer,
+						Namespace:  args.Namespace,
+						ResolveDir: args.ResolveDir,
+						Kind:       args.Kind,
+						PluginData: skipAliasPatterns{},
+						With:       args.With,
+					})), nil
+				}
+				return api.OnResolveResult{}, nil
+			})
+		},
+	}, errors
+}
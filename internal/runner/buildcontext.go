@@ -0,0 +1,293 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// BuildContext is a long-lived esbuild build context created from Python.
+// esbuild keeps the parsed module graph between rebuilds, which makes them
+// much faster than cold builds.
+type BuildContext struct {
+	ID uint64
+
+	request  shared.BuildRequest
+	options  api.BuildOptions
+	warnings []api.Message
+	plugins  *pluginScope
+
+	mu       sync.Mutex
+	esbuild  api.BuildContext
+	building int
+	watcher  *watcher
+	server   *server
+
+	// The state of the inputs and the hashes of the outputs of the last
+	// build, for the rebuild stats.
+	lastInputs  map[string]fileStamp
+	lastOutputs map[string]string
+
+	// idleTimer disposes the context after `disposeAfterIdleMs`.
+	idleTimer *time.Timer
+}
+
+// touch records that the context was used, postponing its disposal when
+// idle.
+func (c *BuildContext) touch() {
+	if c.request.DisposeAfterIdleMs <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	idleTime := time.Duration(c.request.DisposeAfterIdleMs) * time.Millisecond
+	if c.idleTimer == nil {
+		c.idleTimer = time.AfterFunc(idleTime, c.disposeIfIdle)
+	} else {
+		c.idleTimer.Reset(idleTime)
+	}
+}
+
+// disposeIfIdle disposes the context unless it's busy building, watching or
+// serving, in which case the timer starts over.
+func (c *BuildContext) disposeIfIdle() {
+	if c.state() != shared.ContextIdle {
+		c.touch()
+		return
+	}
+	DisposeContext(c.ID)
+}
+
+// state reports what the context is currently doing. A context that is
+// rebuilding is reported as building even while it is watching or serving.
+func (c *BuildContext) state() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.building > 0:
+		return shared.ContextBuilding
+	case c.server != nil:
+		return shared.ContextServing
+	case c.watcher != nil:
+		return shared.ContextWatching
+	default:
+		return shared.ContextIdle
+	}
+}
+
+// setBuilding records the start (+1) or end (-1) of a rebuild.
+func (c *BuildContext) setBuilding(delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.building += delta
+}
+
+// info summarizes the context for list_contexts.
+func (c *BuildContext) info() shared.ContextInfo {
+	entryPoints := c.options.EntryPoints
+	if entryPoints == nil {
+		entryPoints = make([]string, 0)
+	}
+	return shared.ContextInfo{
+		ID:          c.ID,
+		State:       c.state(),
+		EntryPoints: entryPoints,
+		Outfile:     c.options.Outfile,
+		Outdir:      c.options.Outdir,
+		Format:      c.request.Format,
+		Platform:    c.request.Platform,
+		Write:       c.options.Write,
+	}
+}
+
+var (
+	contextsMu    sync.Mutex
+	nextContextID uint64
+	contexts      = make(map[uint64]*BuildContext)
+)
+
+// CreateContext decodes a build request and creates a build context for it.
+// The response carries the handle of the new context, or the errors that
+// prevented it from being created.
+func CreateContext(requestData []byte, encoding shared.Encoding) *shared.ApiResponse {
+	var req shared.BuildRequest
+	if err := encoding.Unmarshal(requestData, &req); err != nil {
+		return shared.NewApiResponse("", []api.Message{shared.NewRequestError("Failed to parse build request " + encoding.String() + ": " + err.Error())}, nil)
+	}
+	plugins := newPluginScope()
+	options, warnings, failed := prepareBuild(req, plugins)
+	if failed != nil {
+		plugins.close()
+		return failed
+	}
+	buildCtx, ctxErr := api.Context(options)
+	if ctxErr != nil {
+		plugins.close()
+		return shared.NewApiResponse("", ctxErr.Errors, warnings)
+	}
+
+	contextsMu.Lock()
+	nextContextID++
+	c := &BuildContext{
+		ID:       nextContextID,
+		request:  req,
+		options:  options,
+		warnings: warnings,
+		plugins:  plugins,
+		esbuild:  buildCtx,
+	}
+	contexts[c.ID] = c
+	contextsMu.Unlock()
+	c.touch()
+
+	response := shared.NewApiResponse("", nil, warnings)
+	response.Context = c.ID
+	return response
+}
+
+// RebuildContext runs a build in an existing context.
+func RebuildContext(ctx context.Context, id uint64) *shared.ApiResponse {
+	c, err := getContext(id)
+	if err != nil {
+		return shared.NewApiResponse("", []api.Message{{Text: err.Error()}}, nil)
+	}
+	response, _ := c.rebuild(ctx)
+	c.touch()
+	return response
+}
+
+// rebuild runs a build in the context, keeping track of its state and
+// adding the rebuild stats to the response.
+func (c *BuildContext) rebuild(ctx context.Context) (*shared.ApiResponse, api.BuildResult) {
+	c.setBuilding(1)
+	defer c.setBuilding(-1)
+
+	c.mu.Lock()
+	buildCtx := c.esbuild
+	before := make(map[string]fileStamp, len(c.lastInputs))
+	for path := range c.lastInputs {
+		before[path] = stampFile(path)
+	}
+	c.mu.Unlock()
+
+	start := time.Now()
+	response, result := rebuild(ctx, buildCtx, c.plugins, &c.request, c.options, c.warnings)
+	if response.Kind != "" {
+		return response, result
+	}
+	stats := &shared.RebuildStats{DurationMs: time.Since(start).Milliseconds()}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	inputs := make(map[string]fileStamp)
+	for _, path := range c.inputPaths(result) {
+		stamp, ok := before[path]
+		if !ok {
+			stamp = stampFile(path)
+		}
+		if last, ok := c.lastInputs[path]; !ok || last != stamp {
+			stats.ModulesParsed++
+		}
+		inputs[path] = stamp
+	}
+	var changed []string
+	changed, c.lastOutputs = changedOutputs(result.OutputFiles, c.lastOutputs)
+	stats.OutputsWritten = len(changed)
+	c.server.notifyChanged(c, changed)
+	c.lastInputs = inputs
+	response.Stats = stats
+	return response, result
+}
+
+// ListContexts describes all live contexts, ordered by handle.
+func ListContexts() []shared.ContextInfo {
+	contextsMu.Lock()
+	live := make([]*BuildContext, 0, len(contexts))
+	for _, c := range contexts {
+		live = append(live, c)
+	}
+	contextsMu.Unlock()
+
+	sort.Slice(live, func(i, j int) bool { return live[i].ID < live[j].ID })
+	infos := make([]shared.ContextInfo, 0, len(live))
+	for _, c := range live {
+		infos = append(infos, c.info())
+	}
+	return infos
+}
+
+// DisposeContext stops a context's watcher and server, if any, and frees
+// the module graph it holds. The handle is invalid afterwards.
+func DisposeContext(id uint64) error {
+	contextsMu.Lock()
+	c, ok := contexts[id]
+	delete(contexts, id)
+	contextsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown context handle %d", id)
+	}
+	c.dispose()
+	return nil
+}
+
+// dispose stops watching and releases the esbuild context.
+func (c *BuildContext) dispose() {
+	c.mu.Lock()
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+	buildCtx := c.esbuild
+	c.server.close()
+	c.mu.Unlock()
+	c.Unwatch()
+	// Abandoning the hook calls first, since disposing waits for the build
+	// in progress.
+	c.plugins.close()
+	buildCtx.Dispose()
+}
+
+// reset replaces the esbuild context with a new one created from the same
+// options, which is the only way to stop esbuild's dev server. The module
+// graph is lost, so the next build is a cold one.
+func (c *BuildContext) reset() error {
+	buildCtx, ctxErr := api.Context(c.options)
+	if ctxErr != nil {
+		return ctxErr
+	}
+	c.mu.Lock()
+	previous := c.esbuild
+	c.esbuild = buildCtx
+	c.server.close()
+	c.server = nil
+	c.lastInputs = nil
+	c.mu.Unlock()
+	previous.Dispose()
+	return nil
+}
+
+// DisposeAllContexts disposes every live context.
+func DisposeAllContexts() {
+	contextsMu.Lock()
+	disposed := contexts
+	contexts = make(map[uint64]*BuildContext)
+	contextsMu.Unlock()
+	for _, c := range disposed {
+		c.dispose()
+	}
+}
+
+func getContext(id uint64) (*BuildContext, error) {
+	contextsMu.Lock()
+	defer contextsMu.Unlock()
+	c, ok := contexts[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown context handle %d", id)
+	}
+	c.touch()
+	return c, nil
+}
@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// builtinPlugins creates the plugins implementing options of the build
+// request that esbuild doesn't have, so that common plugin use cases don't
+// need a Python plugin. They run before Python plugins.
+func builtinPlugins(req shared.BuildRequest) ([]api.Plugin, []api.Message) {
+	var plugins []api.Plugin
+	var errors []api.Message
+	add := func(plugin api.Plugin, pluginErrors []api.Message) {
+		plugins = append(plugins, plugin)
+		errors = append(errors, pluginErrors...)
+	}
+
+	if len(req.VirtualFiles) > 0 {
+		add(virtualFilesPlugin(req.VirtualFiles))
+	}
+	if len(req.ExternalPatterns) > 0 {
+		add(externalPatternsPlugin(req.ExternalPatterns))
+	}
+	if len(req.AliasPatterns) > 0 {
+		add(aliasPatternsPlugin(req.AliasPatterns))
+	}
+	if req.NodeBuiltins != "" && req.Platform != "node" {
+		add(nodeBuiltinsPlugin(req.NodeBuiltins))
+	}
+	if req.TsconfigPaths != "" {
+		add(tsconfigPathsPlugin(req.TsconfigPaths, req.AbsWorkingDir))
+	}
+	if req.CSSModules != nil {
+		add(cssModulesPlugin(*req.CSSModules, req.AbsWorkingDir))
+	}
+	if req.CSSAssets != nil {
+		add(cssAssetsPlugin(*req.CSSAssets))
+	}
+	var transforms []sourceTransform
+	if req.GlobImports {
+		transforms = append(transforms, globImportsTransform(req.AbsWorkingDir))
+	}
+	if req.Workers {
+		transforms = append(transforms, workersTransform)
+		add(workersPlugin())
+	}
+	if len(transforms) > 0 {
+		add(sourceTransformsPlugin(transforms, req.Loader))
+	}
+	if req.ImportSuffixes {
+		add(importSuffixesPlugin())
+	}
+	if extensions := shared.PluginLoaderMap(req.Loader); len(extensions) > 0 {
+		add(pluginLoadersPlugin(extensions))
+	}
+	if len(req.ImportMap) > 0 && string(req.ImportMap) != "null" {
+		add(importMapPlugin(req.ImportMap, req.AbsWorkingDir))
+	}
+	if req.HTTPImports != nil {
+		add(httpImportsPlugin(*req.HTTPImports))
+	}
+	return plugins, errors
+}
@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"os"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// cssAssetNamespace is the namespace of the files referenced by `url()` in
+// CSS, which are loaded as assets whatever the loader of their extension.
+const cssAssetNamespace = "css-asset"
+
+// defaultInlineLimit is the size in bytes under which CSS assets are
+// inlined by default, as in Vite.
+const defaultInlineLimit = 4096
+
+// skipCSSAssets marks the resolutions of the files referenced by `url()`.
+type skipCSSAssets struct{}
+
+// cssAssetsPlugin loads the files referenced by `url()` in CSS as data URLs
+// if they are smaller than the inline limit, and otherwise emits them as
+// assets with hashed names, whose URL replaces the reference.
+func cssAssetsPlugin(req shared.CSSAssetsRequest) (api.Plugin, []api.Message) {
+	inlineLimit := defaultInlineLimit
+	if req.InlineLimit != nil {
+		inlineLimit = *req.InlineLimit
+	}
+	return api.Plugin{
+		Name: "esbuild-py:css-assets",
+		Setup: func(build api.PluginBuild) {
+			build.OnResolve(api.OnResolveOptions{Filter: ".*"}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				if args.Kind != api.ResolveCSSURLToken {
+					return api.OnResolveResult{}, nil
+				}
+				if _, ok := args.PluginData.(skipCSSAssets); ok {
+					return api.OnResolveResult{}, nil
+				}
+				resolved := build.Resolve(args.Path, api.ResolveOptions{
+					Importer:   args.Importer,
+					Namespace:  args.Namespace,
+					ResolveDir: args.ResolveDir,
+					Kind:       args.Kind,
+					PluginData: skipCSSAssets{},
+					With:       args.With,
+				})
+				result := onResolveResult(resolved)
+				if len(resolved.Errors) == 0 && !resolved.External && resolved.Namespace == "file" {
+					result.Namespace = cssAssetNamespace
+				}
+				return result, nil
+			})
+			build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: cssAssetNamespace}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+				data, err := os.ReadFile(args.Path)
+				if err != nil {
+					return api.OnLoadResult{}, err
+				}
+				contents := string(data)
+				loader := api.LoaderFile
+				if len(data) < inlineLimit {
+					loader = api.LoaderDataURL
+				}
+				return api.OnLoadResult{Contents: &contents, Loader: loader, WatchFiles: []string{args.Path}}, nil
+			})
+		},
+	}, nil
+}
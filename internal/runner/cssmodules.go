@@ -0,0 +1,585 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// cssModuleNamespace is the namespace of the JS modules exporting the class
+// names of the CSS modules imported from JS.
+const cssModuleNamespace = "css-module"
+
+var (
+	cssIdentRe       = regexp.MustCompile(`^-?[_a-zA-Z\x{80}-\x{10FFFF}][-_a-zA-Z0-9\x{80}-\x{10FFFF}]*`)
+	cssScopeRe       = regexp.MustCompile(`^:(global|local)\b`)
+	cssComposesRe    = regexp.MustCompile(`^\s*composes\s*:\s*([\s\S]*?)\s*$`)
+	cssComposesFrom  = regexp.MustCompile(`^([\s\S]*?)\s+from\s+(global|"[^"]*"|'[^']*')$`)
+	cssPlaceholderRe = regexp.MustCompile(`\[(name|local|hash)\]`)
+	cssNameCharsRe   = regexp.MustCompile(`[^-_a-zA-Z0-9]`)
+	jsIdentifierRe   = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+)
+
+// cssModules scopes the class names of the CSS modules of a build.
+type cssModules struct {
+	extensions []string
+	pattern    string
+	workingDir string
+}
+
+func newCSSModules(req shared.CSSModulesRequest, workingDir string) (*cssModules, []api.Message) {
+	m := &cssModules{extensions: req.Extensions, pattern: req.Pattern, workingDir: workingDir}
+	if len(m.extensions) == 0 {
+		m.extensions = []string{".module.css"}
+	}
+	if m.pattern == "" {
+		m.pattern = "[name]_[local]"
+	}
+	if m.workingDir == "" {
+		m.workingDir, _ = os.Getwd()
+	}
+	if !strings.Contains(m.pattern, "[local]") && !strings.Contains(m.pattern, "[hash]") {
+		return m, []api.Message{shared.NewOptionsError(
+			fmt.Sprintf("The CSS modules pattern %q contains neither [local] nor [hash]", m.pattern),
+			"Without them, all the class names of a module are scoped to the same name.")}
+	}
+	return m, nil
+}
+
+// isModule tells whether a file is a CSS module.
+func (m *cssModules) isModule(file string) bool {
+	for _, ext := range m.extensions {
+		if strings.HasSuffix(file, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter matches the paths of CSS modules.
+func (m *cssModules) filter() string {
+	quoted := make([]string, 0, len(m.extensions))
+	for _, ext := range m.extensions {
+		quoted = append(quoted, regexp.QuoteMeta(ext))
+	}
+	return `(` + strings.Join(quoted, "|") + `)$`
+}
+
+// scopedName applies the pattern to a local class name of a file.
+func (m *cssModules) scopedName(file string, local string) string {
+	base := filepath.Base(file)
+	for _, ext := range m.extensions {
+		if strings.HasSuffix(base, ext) {
+			base = strings.TrimSuffix(base, ext)
+			break
+		}
+	}
+	rel, err := filepath.Rel(m.workingDir, file)
+	if err != nil {
+		rel = file
+	}
+	sum := sha256.Sum256([]byte(filepath.ToSlash(rel) + "\x00" + local))
+	name := cssPlaceholderRe.ReplaceAllStringFunc(m.pattern, func(placeholder string) string {
+		switch placeholder {
+		case "[name]":
+			return cssNameCharsRe.ReplaceAllString(base, "_")
+		case "[local]":
+			return local
+		}
+		return hex.EncodeToString(sum[:])[:8]
+	})
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// cssModule is a CSS module whose class names were scoped.
+type cssModule struct {
+	css string
+
+	// exports maps the local class names to the class names they stand
+	// for, which are their scoped name followed by those they compose.
+	exports map[string]string
+
+	// dependencies are the CSS modules composed from.
+	dependencies []string
+}
+
+// cssComposition is a class composed by a rule: a local class if file and
+// global are empty.
+type cssComposition struct {
+	name   string
+	file   string
+	global bool
+}
+
+// load reads a CSS module and scopes its class names. The files being
+// loaded are tracked to report circular compositions.
+func (m *cssModules) load(file string, loading map[string]bool) (*cssModule, error) {
+	if loading[file] {
+		return nil, fmt.Errorf("%s composes from itself", file)
+	}
+	loading[file] = true
+	defer delete(loading, file)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := &cssModuleScoper{modules: m, file: file, scoped: make(map[string]string), compositions: make(map[string][]cssComposition)}
+	css, err := s.scope(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	module := &cssModule{css: css, exports: make(map[string]string, len(s.scoped))}
+	imported := make(map[string]*cssModule)
+	for _, composition := range s.compositions {
+		for _, c := range composition {
+			if c.file == "" || imported[c.file] != nil {
+				continue
+			}
+			other, err := m.load(c.file, loading)
+			if err != nil {
+				return nil, err
+			}
+			imported[c.file] = other
+			module.dependencies = append(module.dependencies, c.file)
+		}
+	}
+	sort.Strings(module.dependencies)
+
+	var export func(local string, visiting map[string]bool) (string, error)
+	export = func(local string, visiting map[string]bool) (string, error) {
+		if visiting[local] {
+			return "", fmt.Errorf("the class %q composes itself", local)
+		}
+		visiting[local] = true
+		defer delete(visiting, local)
+		names := []string{s.scoped[local]}
+		for _, c := range s.compositions[local] {
+			switch {
+			case c.global:
+				names = append(names, c.name)
+			case c.file != "":
+				name, ok := imported[c.file].exports[c.name]
+				if !ok {
+					return "", fmt.Errorf("the class %q isn't defined in %s", c.name, c.file)
+				}
+				names = append(names, name)
+			default:
+				if _, ok := s.scoped[c.name]; !ok {
+					return "", fmt.Errorf("the class %q isn't defined", c.name)
+				}
+				name, err := export(c.name, visiting)
+				if err != nil {
+					return "", err
+				}
+				names = append(names, name)
+			}
+		}
+		return strings.Join(names, " "), nil
+	}
+	for local := range s.scoped {
+		names, err := export(local, make(map[string]bool))
+		if err != nil {
+			return nil, err
+		}
+		module.exports[local] = names
+	}
+	return module, nil
+}
+
+// cssModuleScoper rewrites the selectors of a CSS module.
+type cssModuleScoper struct {
+	modules      *cssModules
+	file         string
+	scoped       map[string]string
+	compositions map[string][]cssComposition
+}
+
+// scope rewrites the class selectors of the rules of a stylesheet, and
+// removes its `composes` declarations.
+func (s *cssModuleScoper) scope(source string) (string, error) {
+	var out strings.Builder
+	// classes holds the class of each enclosing rule whose selector is a
+	// single class, which may compose others.
+	var classes []string
+	start, depth := 0, 0
+	for i := 0; i < len(source); i++ {
+		switch c := source[i]; c {
+		case '/':
+			if strings.HasPrefix(source[i:], "/*") {
+				end := strings.Index(source[i+2:], "*/")
+				if end < 0 {
+					i = len(source)
+				} else {
+					i += end + 3
+				}
+			}
+		case '"', '\'':
+			i = skipCSSString(source, i) - 1
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case '{':
+			if depth > 0 {
+				continue
+			}
+			prelude, class := s.prelude(source[start:i])
+			out.WriteString(prelude)
+			out.WriteByte(c)
+			classes = append(classes, class)
+			start = i + 1
+		case ';', '}':
+			if depth > 0 {
+				continue
+			}
+			segment := source[start:i]
+			if m := cssComposesRe.FindStringSubmatch(segment); m != nil && len(classes) > 0 {
+				if err := s.composes(classes[len(classes)-1], m[1]); err != nil {
+					return "", err
+				}
+				if c == '}' {
+					out.WriteByte(c)
+				}
+			} else {
+				out.WriteString(segment)
+				out.WriteByte(c)
+			}
+			if c == '}' && len(classes) > 0 {
+				classes = classes[:len(classes)-1]
+			}
+			start = i + 1
+		}
+	}
+	if start < len(source) {
+		out.WriteString(source[start:])
+	}
+	return out.String(), nil
+}
+
+// prelude rewrites the prelude of a rule, and returns the class it
+// selects if its selector is a single class. At-rules are left alone.
+func (s *cssModuleScoper) prelude(prelude string) (string, string) {
+	trimmed := strings.TrimSpace(stripCSSComments(prelude))
+	if strings.HasPrefix(trimmed, "@") {
+		return prelude, ""
+	}
+	class := ""
+	if strings.HasPrefix(trimmed, ".") && cssIdentRe.FindString(trimmed[1:]) == trimmed[1:] {
+		class = trimmed[1:]
+	}
+	return s.selector(prelude), class
+}
+
+// selector scopes the classes of a selector, except within `:global(...)`
+// or after `:global`, up to the next comma.
+func (s *cssModuleScoper) selector(selector string) string {
+	var b strings.Builder
+	global := false
+	for i := 0; i < len(selector); {
+		c := selector[i]
+		rest := selector[i:]
+		switch {
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest) - 4
+			}
+			b.WriteString(rest[:end+4])
+			i += end + 4
+		case c == '"' || c == '\'':
+			end := skipCSSString(selector, i)
+			b.WriteString(selector[i:end])
+			i = end
+		case c == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			b.WriteString(rest[:end+1])
+			i += end + 1
+		case c == ',':
+			global = false
+			b.WriteByte(c)
+			i++
+		case cssScopeRe.MatchString(rest):
+			keyword := cssScopeRe.FindString(rest)
+			if strings.HasPrefix(rest[len(keyword):], "(") {
+				open := i + len(keyword)
+				end := matchingParen(selector, open)
+				inner := selector[open+1 : end]
+				if keyword == ":global" {
+					b.WriteString(inner)
+				} else {
+					b.WriteString(s.selector(inner))
+				}
+				i = end + 1
+				if i > len(selector) {
+					i = len(selector)
+				}
+				continue
+			}
+			global = keyword == ":global"
+			i += len(keyword)
+			for i < len(selector) && (selector[i] == ' ' || selector[i] == '\t' || selector[i] == '\n') {
+				i++
+			}
+		case c == '.' && cssIdentRe.MatchString(rest[1:]):
+			name := cssIdentRe.FindString(rest[1:])
+			if global {
+				b.WriteString("." + name)
+			} else {
+				b.WriteString("." + s.local(name))
+			}
+			i += 1 + len(name)
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// local returns the scoped name of a local class.
+func (s *cssModuleScoper) local(name string) string {
+	scoped, ok := s.scoped[name]
+	if !ok {
+		scoped = s.modules.scopedName(s.file, name)
+		s.scoped[name] = scoped
+	}
+	return scoped
+}
+
+// composes records the classes composed by the rule of a class, given as
+// `composes: a b`, `composes: a from global` or
+// `composes: a from "./other.module.css"`.
+func (s *cssModuleScoper) composes(class string, value string) error {
+	if class == "" {
+		return fmt.Errorf("\"composes\" is only allowed in rules whose selector is a single class")
+	}
+	names, from := value, ""
+	if m := cssComposesFrom.FindStringSubmatch(value); m != nil {
+		names, from = m[1], m[2]
+	}
+	for _, name := range strings.Fields(names) {
+		composition := cssComposition{name: name}
+		switch {
+		case from == "global":
+			composition.global = true
+		case from != "":
+			path := from[1 : len(from)-1]
+			if !isRelativePath(path) {
+				return fmt.Errorf("can't compose from %q, which isn't a relative path", path)
+			}
+			composition.file = filepath.Join(filepath.Dir(s.file), filepath.FromSlash(path))
+		default:
+			s.local(name)
+		}
+		s.compositions[class] = append(s.compositions[class], composition)
+	}
+	return nil
+}
+
+// stripCSSComments removes the comments of CSS source.
+func stripCSSComments(source string) string {
+	for {
+		start := strings.Index(source, "/*")
+		if start < 0 {
+			return source
+		}
+		end := strings.Index(source[start+2:], "*/")
+		if end < 0 {
+			return source[:start]
+		}
+		source = source[:start] + source[start+2+end+2:]
+	}
+}
+
+// skipCSSString returns the index following the string starting at i.
+func skipCSSString(source string, i int) int {
+	quote := source[i]
+	for j := i + 1; j < len(source); j++ {
+		switch source[j] {
+		case '\\':
+			j++
+		case quote, '\n':
+			return j + 1
+		}
+	}
+	return len(source)
+}
+
+// matchingParen returns the index of the parenthesis closing the one at
+// open, or the end of the source.
+func matchingParen(source string, open int) int {
+	depth := 0
+	for i := open; i < len(source); i++ {
+		switch source[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(source)
+}
+
+// cssModulesPlugin scopes the class names of the CSS modules, and imports
+// them from JS as a module whose default export maps the local class names
+// to the scoped ones, each of them also being a named export. The scoped
+// names are made from a pattern, so that templates rendered outside of the
+// bundle can refer to them.
+func cssModulesPlugin(req shared.CSSModulesRequest, workingDir string) (api.Plugin, []api.Message) {
+	modules, errors := newCSSModules(req, workingDir)
+	return api.Plugin{
+		Name: "esbuild-py:css-modules",
+		Setup: func(build api.PluginBuild) {
+			build.OnResolve(api.OnResolveOptions{Filter: modules.filter()}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				switch args.Kind {
+				case api.ResolveJSImportStatement, api.ResolveJSRequireCall, api.ResolveJSDynamicImport:
+				default:
+					return api.OnResolveResult{}, nil
+				}
+				if _, ok := args.PluginData.(skipCSSModules); ok || args.Namespace == cssModuleNamespace {
+					return api.OnResolveResult{}, nil
+				}
+				resolved := build.Resolve(args.Path, api.ResolveOptions{
+					Importer:   args.Importer,
+					Namespace:  args.Namespace,
+					ResolveDir: args.ResolveDir,
+					Kind:       args.Kind,
+					PluginData: skipCSSModules{},
+					With:       args.With,
+				})
+				if len(resolved.Errors) > 0 || resolved.External || resolved.Namespace != "file" {
+					return onResolveResult(resolved), nil
+				}
+				return api.OnResolveResult{Path: resolved.Path, Namespace: cssModuleNamespace}, nil
+			})
+			build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: cssModuleNamespace}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+				module, err := modules.load(args.Path, make(map[string]bool))
+				if err != nil {
+					return api.OnLoadResult{}, err
+				}
+				contents := cssModuleJS(args.Path, module)
+				return api.OnLoadResult{
+					Contents:   &contents,
+					Loader:     api.LoaderJS,
+					ResolveDir: filepath.Dir(args.Path),
+					WatchFiles: append([]string{args.Path}, module.dependencies...),
+				}, nil
+			})
+			build.OnLoad(api.OnLoadOptions{Filter: modules.filter(), Namespace: "file"}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+				module, err := modules.load(args.Path, make(map[string]bool))
+				if err != nil {
+					return api.OnLoadResult{}, err
+				}
+				return api.OnLoadResult{
+					Contents:   &module.css,
+					Loader:     api.LoaderCSS,
+					WatchFiles: module.dependencies,
+				}, nil
+			})
+		},
+	}, errors
+}
+
+// skipCSSModules marks the resolutions of CSS modules imported from JS.
+type skipCSSModules struct{}
+
+// cssModuleJS generates the JS module of a CSS module, which imports its
+// stylesheet and those it composes from.
+func cssModuleJS(file string, module *cssModule) string {
+	var b strings.Builder
+	for _, dependency := range module.dependencies {
+		b.WriteString("import " + strconv.Quote(filepath.ToSlash(dependency)) + ";\n")
+	}
+	b.WriteString("import " + strconv.Quote(filepath.ToSlash(file)) + ";\n")
+
+	locals := make([]string, 0, len(module.exports))
+	for local := range module.exports {
+		locals = append(locals, local)
+	}
+	sort.Strings(locals)
+	var named []string
+	b.WriteString("const classes = {")
+	for i, local := range locals {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n  " + strconv.Quote(local) + ": " + strconv.Quote(module.exports[local]))
+		if jsIdentifierRe.MatchString(local) && local != "default" {
+			named = append(named, local)
+		}
+	}
+	b.WriteString("\n};\nexport default classes;\n")
+	for i, local := range named {
+		fmt.Fprintf(&b, "const __class_%d = classes[%s];\n", i, strconv.Quote(local))
+	}
+	if len(named) > 0 {
+		b.WriteString("export {")
+		for i, local := range named {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, " __class_%d as %s", i, local)
+		}
+		b.WriteString(" };\n")
+	}
+	return b.String()
+}
+
+// cssModuleNames returns the scoped class names of the CSS modules among
+// the inputs listed in a metafile, by path relative to the working
+// directory.
+func cssModuleNames(metafile string, req shared.CSSModulesRequest, workingDir string) map[string]map[string]string {
+	var parsed struct {
+		Inputs map[string]json.RawMessage `json:"inputs"`
+	}
+	if err := json.Unmarshal([]byte(metafile), &parsed); err != nil {
+		return nil
+	}
+	modules, errors := newCSSModules(req, workingDir)
+	if len(errors) > 0 {
+		return nil
+	}
+	names := make(map[string]map[string]string)
+	for input := range parsed.Inputs {
+		path := strings.TrimPrefix(input, cssModuleNamespace+":")
+		if strings.Contains(path, ":") && !filepath.IsAbs(path) || !modules.isModule(path) {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(modules.workingDir, path)
+		}
+		module, err := modules.load(path, make(map[string]bool))
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(modules.workingDir, path)
+		if err != nil {
+			rel = path
+		}
+		names[filepath.ToSlash(rel)] = module.exports
+	}
+	return names
+}
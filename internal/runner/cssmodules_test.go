@@ -0,0 +1,188 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+func TestCSSModulesScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		css     string
+		exports map[string]string
+	}{
+		{
+			name:    "local classes",
+			source:  ".a { color: red } .a.b, .c > .d {}",
+			css:     ".x_a { color: red } .x_a.x_b, .x_c > .x_d {}",
+			exports: map[string]string{"a": "x_a", "b": "x_b", "c": "x_c", "d": "x_d"},
+		},
+		{
+			name:    ":global and :local functions",
+			source:  ":global(.a) .b {} :local(.c) :global(.d.e) {}",
+			css:     ".a .x_b {} .x_c .d.e {}",
+			exports: map[string]string{"b": "x_b", "c": "x_c"},
+		},
+		{
+			name:    ":global up to the next comma",
+			source:  ":global .a .b, .c {}",
+			css:     ".a .b, .x_c {}",
+			exports: map[string]string{"c": "x_c"},
+		},
+		{
+			name:    "pseudo-classes and IDs",
+			source:  ".a:not(.b):hover {} .c::before {} #id.d {}",
+			css:     ".x_a:not(.x_b):hover {} .x_c::before {} #id.x_d {}",
+			exports: map[string]string{"a": "x_a", "b": "x_b", "c": "x_c", "d": "x_d"},
+		},
+		{
+			name:    "rules nested in @media and @supports",
+			source:  "@media (min-width: 10px) { .a { color: red } } @supports (display: grid) { .b:hover > .c {} }",
+			css:     "@media (min-width: 10px) { .x_a { color: red } } @supports (display: grid) { .x_b:hover > .x_c {} }",
+			exports: map[string]string{"a": "x_a", "b": "x_b", "c": "x_c"},
+		},
+		{
+			name:    "nested rules",
+			source:  ".a { color: red; .b { color: blue } &.c {} }",
+			css:     ".x_a { color: red; .x_b { color: blue } &.x_c {} }",
+			exports: map[string]string{"a": "x_a", "b": "x_b", "c": "x_c"},
+		},
+		{
+			name:    "class-like text in comments and strings",
+			source:  "/* .comment { } */ .a { content: \".b\" } .c[data-x='.d'] {} .e /* .f */ {}",
+			css:     "/* .comment { } */ .x_a { content: \".b\" } .x_c[data-x='.d'] {} .x_e /* .f */ {}",
+			exports: map[string]string{"a": "x_a", "c": "x_c", "e": "x_e"},
+		},
+		{
+			name:    "class-like text in declarations",
+			source:  ".a { background: url(img.b.png); font: 1.5em serif }",
+			css:     ".x_a { background: url(img.b.png); font: 1.5em serif }",
+			exports: map[string]string{"a": "x_a"},
+		},
+		{
+			name:    "keyframe names keep their name",
+			source:  "@keyframes spin { from { top: 0 } 50.5% { top: 1px } to { top: 2px } } .a { animation: spin 1s }",
+			css:     "@keyframes spin { from { top: 0 } 50.5% { top: 1px } to { top: 2px } } .x_a { animation: spin 1s }",
+			exports: map[string]string{"a": "x_a"},
+		},
+		{
+			name:    "composes local classes",
+			source:  ".base { color: red } .btn { composes: base; padding: 0 } .big { composes: btn }",
+			css:     ".x_base { color: red } .x_btn { padding: 0 } .x_big {}",
+			exports: map[string]string{"base": "x_base", "btn": "x_btn x_base", "big": "x_big x_btn x_base"},
+		},
+		{
+			name:    "composes a class without a rule",
+			source:  ".a { composes: b }",
+			css:     ".x_a {}",
+			exports: map[string]string{"a": "x_a x_b", "b": "x_b"},
+		},
+		{
+			name:    "composes global classes",
+			source:  ".btn { composes: a b from global }",
+			css:     ".x_btn {}",
+			exports: map[string]string{"btn": "x_btn a b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			module, err := loadCSSModule(t, dir, map[string]string{"x.module.css": test.source})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if module.css != test.css {
+				t.Errorf("css = %q, want %q", module.css, test.css)
+			}
+			if !reflect.DeepEqual(module.exports, test.exports) {
+				t.Errorf("exports = %v, want %v", module.exports, test.exports)
+			}
+		})
+	}
+}
+
+func TestCSSModulesComposesFromFile(t *testing.T) {
+	dir := t.TempDir()
+	module, err := loadCSSModule(t, dir, map[string]string{
+		"x.module.css":      `.btn { composes: base from "./base.module.css" }`,
+		"base.module.css":   `.base { composes: reset from './reset.module.css' }`,
+		"reset.module.css":  `.reset { margin: 0 }`,
+		"unused.module.css": `.unused {}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "x_btn base_base reset_reset"; module.exports["btn"] != want {
+		t.Errorf("btn = %q, want %q", module.exports["btn"], want)
+	}
+	want := []string{filepath.Join(dir, "base.module.css")}
+	if !reflect.DeepEqual(module.dependencies, want) {
+		t.Errorf("dependencies = %v, want %v", module.dependencies, want)
+	}
+}
+
+func TestCSSModulesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{"composes outside a single class", map[string]string{"x.module.css": ".a .b { composes: c }"}, "single class"},
+		{"composes a class another file doesn't define", map[string]string{
+			"x.module.css": `.a { composes: b from "./y.module.css" }`,
+			"y.module.css": `.c {}`,
+		}, `"b" isn't defined in`},
+		{"composes itself", map[string]string{"x.module.css": ".a { composes: b } .b { composes: a }"}, "composes itself"},
+		{"composes from a bare path", map[string]string{"x.module.css": `.a { composes: b from "pkg/b.css" }`}, "isn't a relative path"},
+		{"circular files", map[string]string{
+			"x.module.css": `.a { composes: b from "./y.module.css" }`,
+			"y.module.css": `.b { composes: a from "./x.module.css" }`,
+		}, "composes from itself"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadCSSModule(t, t.TempDir(), test.files)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("err = %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestCSSModulesPattern(t *testing.T) {
+	m, errors := newCSSModules(shared.CSSModulesRequest{Pattern: "[name]-[local]-[hash]"}, "/project")
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	name := m.scopedName("/project/src/my.button.module.css", "primary")
+	if !strings.HasPrefix(name, "my_button-primary-") || len(name) != len("my_button-primary-")+8 {
+		t.Errorf("scopedName = %q", name)
+	}
+	if other := m.scopedName("/project/src/other/my.button.module.css", "primary"); other == name {
+		t.Errorf("the hash doesn't depend on the path: %q", other)
+	}
+	if _, errors := newCSSModules(shared.CSSModulesRequest{Pattern: "[name]"}, "/project"); len(errors) != 1 {
+		t.Errorf("expected an error for a pattern without [local] or [hash], got %v", errors)
+	}
+}
+
+// loadCSSModule writes files to dir and loads x.module.css as a CSS module.
+func loadCSSModule(t *testing.T, dir string, files map[string]string) (*cssModule, error) {
+	t.Helper()
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, errors := newCSSModules(shared.CSSModulesRequest{}, dir)
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	return m.load(filepath.Join(dir, "x.module.css"), make(map[string]bool))
+}
@@ -0,0 +1,42 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// externalPatternsPlugin marks the imports matching any of the regular
+// expressions of `externalPatterns` as external, for cases that esbuild's
+// `external` option, which only supports `*` wildcards, can't express.
+func externalPatternsPlugin(patterns []string) (api.Plugin, []api.Message) {
+	var errors []api.Message
+	alternatives := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errors = append(errors, shared.NewOptionsError(
+				fmt.Sprintf("The external pattern %q is not a valid Go regular expression: %v", pattern, err),
+				"Go regular expressions don't support lookarounds or backreferences."))
+			continue
+		}
+		alternatives = append(alternatives, "(?:"+pattern+")")
+	}
+
+	return api.Plugin{
+		Name: "esbuild-py:external-patterns",
+		Setup: func(build api.PluginBuild) {
+			if len(alternatives) == 0 {
+				return
+			}
+			build.OnResolve(api.OnResolveOptions{Filter: strings.Join(alternatives, "|")}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				if args.Kind == api.ResolveEntryPoint {
+					return api.OnResolveResult{}, nil
+				}
+				return api.OnResolveResult{Path: args.Path, External: true}, nil
+			})
+		},
+	}, errors
+}
@@ -0,0 +1,224 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+var (
+	// globCallRe matches the calls of `import.meta.glob` with a literal
+	// pattern, or array of patterns, and an optional literal options object.
+	globCallRe  = regexp.MustCompile(`import\.meta\.glob(?:<[^<>()]*>)?\(\s*(` + jsStringPattern + `|\[(?:\s*(?:` + jsStringPattern + `)\s*,?)*\s*\])\s*(?:,\s*(\{[^{}]*\})\s*)?,?\s*\)`)
+	jsStringRe  = regexp.MustCompile(jsStringPattern)
+	globEagerRe = regexp.MustCompile(`\beager\s*:\s*true\b`)
+	globNameRe  = regexp.MustCompile(`\bimport\s*:\s*(` + jsStringPattern + `)`)
+	globQueryRe = regexp.MustCompile(`\bquery\s*:\s*(` + jsStringPattern + `)`)
+)
+
+// globImportsTransform expands the calls of `import.meta.glob` into an
+// object mapping the matching files to functions importing them, or to the
+// modules themselves with `{ eager: true }`, as in Vite.
+func globImportsTransform(workingDir string) sourceTransform {
+	return func(source string, file string, result *api.OnLoadResult) string {
+		if !strings.Contains(source, "import.meta.glob") {
+			return source
+		}
+		contents, watchDirs, messages := expandGlobImports(source, file, workingDir)
+		result.Errors = append(result.Errors, messages...)
+		result.WatchDirs = append(result.WatchDirs, watchDirs...)
+		return contents
+	}
+}
+
+// expandGlobImports replaces the calls of `import.meta.glob` in the source
+// of a file. The imports of eager globs are appended, since imports are
+// hoisted, and each call keeps its line breaks, so that the lines of the
+// file stay in place for source maps.
+func expandGlobImports(source string, file string, workingDir string) (string, []string, []api.Message) {
+	var out strings.Builder
+	var eagerImports strings.Builder
+	var watchDirs []string
+	var messages []api.Message
+	last := 0
+	for call, match := range globCallRe.FindAllStringSubmatchIndex(source, -1) {
+		var options string
+		if match[4] >= 0 {
+			options = source[match[4]:match[5]]
+		}
+		eager := globEagerRe.MatchString(options)
+		var name, query string
+		if m := globNameRe.FindStringSubmatch(options); m != nil {
+			name = jsStringValue(m[1])
+		}
+		if m := globQueryRe.FindStringSubmatch(options); m != nil {
+			query = jsStringValue(m[1])
+			if query != "" && !strings.HasPrefix(query, "?") {
+				query = "?" + query
+			}
+		}
+
+		var patterns []string
+		for _, literal := range jsStringRe.FindAllString(source[match[2]:match[3]], -1) {
+			patterns = append(patterns, jsStringValue(literal))
+		}
+		files, dirs, err := globImportFiles(patterns, file, workingDir)
+		if err != nil {
+			messages = append(messages, globImportError(source, file, match[0], err))
+			continue
+		}
+		watchDirs = append(watchDirs, dirs...)
+
+		var object strings.Builder
+		object.WriteString("{")
+		for i, entry := range files {
+			if i > 0 {
+				object.WriteString(", ")
+			}
+			specifier := strconv.Quote(entry.specifier + query)
+			object.WriteString(strconv.Quote(entry.key) + ": ")
+			if eager {
+				local := fmt.Sprintf("__glob_%d_%d", call, i)
+				if name == "" {
+					fmt.Fprintf(&eagerImports, "\nimport * as %s from %s;", local, specifier)
+				} else {
+					fmt.Fprintf(&eagerImports, "\nimport { %s as %s } from %s;", strconv.Quote(name), local, specifier)
+				}
+				object.WriteString(local)
+			} else if name == "" {
+				fmt.Fprintf(&object, "() => import(%s)", specifier)
+			} else {
+				fmt.Fprintf(&object, "() => import(%s).then((m) => m[%s])", specifier, strconv.Quote(name))
+			}
+		}
+		object.WriteString("}")
+
+		out.WriteString(source[last:match[0]])
+		out.WriteString(object.String())
+		out.WriteString(strings.Repeat("\n", strings.Count(source[match[0]:match[1]], "\n")))
+		last = match[1]
+	}
+	out.WriteString(source[last:])
+	out.WriteString(eagerImports.String())
+	return out.String(), watchDirs, messages
+}
+
+// globImportFile is a file matched by `import.meta.glob`, with its key in
+// the resulting object and the path it's imported with.
+type globImportFile struct {
+	key       string
+	specifier string
+}
+
+// globImportFiles returns the files matching the patterns of a call of
+// `import.meta.glob`, sorted by key, and the directories they were searched
+// in. Patterns are relative to the importing file, or to the working
+// directory if they start with "/", and those starting with "!" exclude the
+// files they match. The importing file is never included.
+func globImportFiles(patterns []string, file string, workingDir string) ([]globImportFile, []string, error) {
+	if workingDir == "" {
+		workingDir, _ = os.Getwd()
+	}
+	matched := make(map[string]globImportFile)
+	excluded := make(map[string]bool)
+	var dirs []string
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		var baseDir, rel string
+		switch {
+		case strings.HasPrefix(pattern, "/"):
+			baseDir, rel = workingDir, pattern[1:]
+		case isRelativePath(pattern):
+			baseDir, rel = filepath.Dir(file), pattern
+		default:
+			return nil, nil, fmt.Errorf("The glob pattern %q must start with \"./\", \"../\" or \"/\"", pattern)
+		}
+		matches, err := shared.ExpandGlob(rel, baseDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid glob pattern %q: %w", pattern, err)
+		}
+		if !negated {
+			dirs = append(dirs, filepath.Join(baseDir, filepath.FromSlash(globRoot(rel))))
+		}
+
+		for _, match := range matches {
+			abs := filepath.Join(baseDir, filepath.FromSlash(match))
+			if negated {
+				excluded[abs] = true
+				continue
+			}
+			entry := globImportFile{key: match, specifier: match}
+			if strings.HasPrefix(pattern, "/") {
+				entry.key = "/" + match
+				entry.specifier = filepath.ToSlash(abs)
+			} else if !strings.HasPrefix(match, "../") {
+				entry.key = "./" + match
+				entry.specifier = entry.key
+			}
+			matched[abs] = entry
+		}
+	}
+
+	files := make([]globImportFile, 0, len(matched))
+	for abs, entry := range matched {
+		if !excluded[abs] && abs != filepath.Clean(file) {
+			files = append(files, entry)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].key < files[j].key })
+	return files, dirs, nil
+}
+
+// globRoot returns the leading directories of a glob pattern that have no
+// wildcards.
+func globRoot(pattern string) string {
+	segments := strings.Split(path.Dir(pattern), "/")
+	for i, segment := range segments {
+		if strings.ContainsAny(segment, "*?[") {
+			return strings.Join(segments[:i], "/")
+		}
+	}
+	return path.Dir(pattern)
+}
+
+// globImportError reports an invalid call of `import.meta.glob` at its
+// location in the file.
+func globImportError(source string, file string, offset int, err error) api.Message {
+	line := strings.Count(source[:offset], "\n")
+	lineStart := strings.LastIndexByte(source[:offset], '\n') + 1
+	lineEnd := strings.IndexByte(source[offset:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(source)
+	} else {
+		lineEnd += offset
+	}
+	return api.Message{
+		Text: err.Error(),
+		Location: &api.Location{
+			File:     file,
+			Line:     line + 1,
+			Column:   offset - lineStart,
+			LineText: source[lineStart:lineEnd],
+		},
+	}
+}
+
+// jsStringValue returns the value of a JavaScript string literal.
+func jsStringValue(literal string) string {
+	if strings.HasPrefix(literal, `"`) {
+		if value, err := strconv.Unquote(literal); err == nil {
+			return value
+		}
+	}
+	return literal[1 : len(literal)-1]
+}
@@ -0,0 +1,173 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// httpNamespace is the namespace of the modules imported by URL.
+const httpNamespace = "http-url"
+
+// httpClient downloads the modules imported by URL.
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// httpModule is the plugin data of a module imported by URL. It holds the
+// URL the module was eventually downloaded from, after redirects, which is
+// what the module's own imports are relative to.
+type httpModule struct {
+	url string
+}
+
+// httpCacheEntry describes a downloaded module in the cache directory, next
+// to the file holding its contents.
+type httpCacheEntry struct {
+	URL         string `json:"url"`
+	ContentType string `json:"contentType"`
+}
+
+// httpImportsPlugin bundles the modules imported by `http://` or `https://`
+// URLs, as served by CDNs like esm.sh or unpkg, along with the modules they
+// import by relative or absolute path. Downloads are kept in a cache
+// directory, so each URL is only fetched once.
+func httpImportsPlugin(req shared.HTTPImportsRequest) (api.Plugin, []api.Message) {
+	cacheDir := req.CacheDir
+	if cacheDir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			userCacheDir = os.TempDir()
+		}
+		cacheDir = filepath.Join(userCacheDir, "esbuild-py", "http")
+	}
+
+	return api.Plugin{
+		Name: "esbuild-py:http-imports",
+		Setup: func(build api.PluginBuild) {
+			build.OnResolve(api.OnResolveOptions{Filter: "^https?://"}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				return api.OnResolveResult{Path: args.Path, Namespace: httpNamespace}, nil
+			})
+			build.OnResolve(api.OnResolveOptions{Filter: ".*", Namespace: httpNamespace}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				base := args.Importer
+				if module, ok := args.PluginData.(httpModule); ok {
+					base = module.url
+				}
+				baseURL, err := url.Parse(base)
+				if err != nil {
+					return api.OnResolveResult{}, nil
+				}
+				ref, err := url.Parse(args.Path)
+				if err != nil || (ref.Scheme == "" && !isRelativePath(args.Path) && !path.IsAbs(args.Path)) {
+					// Bare imports are left to the other plugins.
+					return api.OnResolveResult{}, nil
+				}
+				return api.OnResolveResult{Path: baseURL.ResolveReference(ref).String(), Namespace: httpNamespace}, nil
+			})
+			build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: httpNamespace}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+				contents, entry, err := fetchHTTPModule(cacheDir, args.Path)
+				if err != nil {
+					return api.OnLoadResult{}, err
+				}
+				text := string(contents)
+				return api.OnLoadResult{
+					Contents:   &text,
+					Loader:     httpModuleLoader(entry),
+					PluginData: httpModule{url: entry.URL},
+				}, nil
+			})
+		},
+	}, nil
+}
+
+// fetchHTTPModule returns a module imported by URL from the cache, or
+// downloads it into the cache.
+func fetchHTTPModule(cacheDir string, moduleURL string) ([]byte, httpCacheEntry, error) {
+	sum := sha256.Sum256([]byte(moduleURL))
+	cachePath := filepath.Join(cacheDir, hex.EncodeToString(sum[:]))
+
+	var entry httpCacheEntry
+	if meta, err := os.ReadFile(cachePath + ".json"); err == nil && json.Unmarshal(meta, &entry) == nil {
+		if contents, err := os.ReadFile(cachePath); err == nil {
+			return contents, entry, nil
+		}
+	}
+
+	resp, err := httpClient.Get(moduleURL)
+	if err != nil {
+		return nil, entry, fmt.Errorf("failed to download %s: %w", moduleURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, entry, fmt.Errorf("failed to download %s: %s", moduleURL, resp.Status)
+	}
+	contents, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, entry, fmt.Errorf("failed to download %s: %w", moduleURL, err)
+	}
+	entry = httpCacheEntry{URL: resp.Request.URL.String(), ContentType: resp.Header.Get("Content-Type")}
+
+	// The cache is only an optimization, so failing to write it isn't an
+	// error. Files are renamed into place so that concurrent builds never
+	// read partial files.
+	if err := os.MkdirAll(cacheDir, 0o755); err == nil {
+		meta, _ := json.Marshal(entry)
+		if writeFileAtomic(cachePath, contents) == nil {
+			writeFileAtomic(cachePath+".json", meta)
+		}
+	}
+	return contents, entry, nil
+}
+
+// httpModuleLoader picks the loader of a downloaded module from the
+// extension of its URL, or from its content type.
+func httpModuleLoader(entry httpCacheEntry) api.Loader {
+	if moduleURL, err := url.Parse(entry.URL); err == nil {
+		switch path.Ext(moduleURL.Path) {
+		case ".css":
+			return api.LoaderCSS
+		case ".json":
+			return api.LoaderJSON
+		case ".jsx":
+			return api.LoaderJSX
+		case ".ts", ".mts", ".cts":
+			return api.LoaderTS
+		case ".tsx":
+			return api.LoaderTSX
+		}
+	}
+	switch mediaType, _, _ := strings.Cut(entry.ContentType, ";"); strings.TrimSpace(mediaType) {
+	case "text/css":
+		return api.LoaderCSS
+	case "application/json":
+		return api.LoaderJSON
+	}
+	return api.LoaderJS
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,135 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// importMap is a parsed WICG import map. Relative addresses and scopes are
+// resolved against baseDir, the directory of the import map file, or the
+// working directory for an inline map. Paths starting with "/" are also
+// taken relative to baseDir, which stands for the root of the site.
+type importMap struct {
+	Imports map[string]string            `json:"imports"`
+	Scopes  map[string]map[string]string `json:"scopes"`
+
+	baseDir string
+}
+
+// skipImportMap marks the resolutions of mapped paths.
+type skipImportMap struct{}
+
+// importMapPlugin resolves bare imports through an import map, given either
+// inline as a JSON object or as the path of a JSON file, so that code
+// written for browsers with import maps bundles the same modules they load.
+// Mapped URLs are left external, unless `httpImports` is enabled.
+func importMapPlugin(raw json.RawMessage, workingDir string) (api.Plugin, []api.Message) {
+	plugin := api.Plugin{Name: "esbuild-py:import-map", Setup: func(api.PluginBuild) {}}
+	if workingDir == "" {
+		workingDir, _ = os.Getwd()
+	}
+
+	m := importMap{baseDir: workingDir}
+	data := []byte(raw)
+	var file string
+	if err := json.Unmarshal(raw, &file); err == nil {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(workingDir, file)
+		}
+		if data, err = os.ReadFile(file); err != nil {
+			return plugin, []api.Message{{Text: fmt.Sprintf("Failed to read the import map: %v", err)}}
+		}
+		m.baseDir = filepath.Dir(file)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return plugin, []api.Message{{Text: fmt.Sprintf("Failed to parse the import map: %v", err)}}
+	}
+
+	// Scopes apply to the importers under their path, the most specific one
+	// first.
+	scopes := make([]string, 0, len(m.Scopes))
+	for scope := range m.Scopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Slice(scopes, func(i, j int) bool { return len(scopes[i]) > len(scopes[j]) })
+
+	plugin.Setup = func(build api.PluginBuild) {
+		build.OnResolve(api.OnResolveOptions{Filter: ".*"}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+			if _, ok := args.PluginData.(skipImportMap); ok || isRelativePath(args.Path) || filepath.IsAbs(args.Path) {
+				return api.OnResolveResult{}, nil
+			}
+			address, ok := "", false
+			for _, scope := range scopes {
+				if strings.HasPrefix(args.Importer, m.resolvePath(scope)) {
+					if address, ok = mapSpecifier(m.Scopes[scope], args.Path); ok {
+						break
+					}
+				}
+			}
+			if !ok {
+				if address, ok = mapSpecifier(m.Imports, args.Path); !ok {
+					return api.OnResolveResult{}, nil
+				}
+			}
+
+			isURL := strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://")
+			if !isURL {
+				address = m.resolvePath(address)
+			}
+			resolved := build.Resolve(address, api.ResolveOptions{
+				Importer:   args.Importer,
+				Namespace:  args.Namespace,
+				ResolveDir: m.baseDir,
+				Kind:       args.Kind,
+				PluginData: skipImportMap{},
+				With:       args.With,
+			})
+			if isURL && len(resolved.Errors) > 0 {
+				return api.OnResolveResult{Path: address, External: true}, nil
+			}
+			return onResolveResult(resolved), nil
+		})
+	}
+	return plugin, nil
+}
+
+// resolvePath turns an address or scope of the import map into a file
+// path.
+func (m *importMap) resolvePath(address string) string {
+	if strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://") {
+		return address
+	}
+	return filepath.Join(m.baseDir, filepath.FromSlash(strings.TrimPrefix(address, "/"))) + trailingSlash(address)
+}
+
+func trailingSlash(address string) string {
+	if strings.HasSuffix(address, "/") {
+		return string(filepath.Separator)
+	}
+	return ""
+}
+
+// mapSpecifier looks up a specifier in a specifier map: an exact match, or
+// else the longest key ending with "/" that prefixes it, whose address the
+// rest of the specifier is appended to.
+func mapSpecifier(specifiers map[string]string, specifier string) (string, bool) {
+	if address, ok := specifiers[specifier]; ok {
+		return address, true
+	}
+	best := ""
+	for key := range specifiers {
+		if strings.HasSuffix(key, "/") && strings.HasPrefix(specifier, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return specifiers[best] + specifier[len(best):], true
+}
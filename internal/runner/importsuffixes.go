@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"os"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// urlNamespace is the namespace of the files imported with a `?url`
+// suffix. esbuild would append the suffix to the URL of the asset, so they
+// are kept apart by namespace instead.
+const urlNamespace = "asset-url"
+
+// skipImportSuffixes marks the resolutions of the paths without suffix.
+type skipImportSuffixes struct{}
+
+// importSuffixesPlugin loads the files imported with a `?raw` suffix as
+// text and those imported with a `?url` suffix as assets, whose URL is
+// imported, whatever their extension.
+func importSuffixesPlugin() (api.Plugin, []api.Message) {
+	return api.Plugin{
+		Name: "esbuild-py:import-suffixes",
+		Setup: func(build api.PluginBuild) {
+			build.OnResolve(api.OnResolveOptions{Filter: `\?(raw|url)$`}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				if _, ok := args.PluginData.(skipImportSuffixes); ok {
+					return api.OnResolveResult{}, nil
+				}
+				suffix := args.Path[strings.LastIndexByte(args.Path, '?'):]
+				resolved := build.Resolve(strings.TrimSuffix(args.Path, suffix), api.ResolveOptions{
+					Importer:   args.Importer,
+					Namespace:  args.Namespace,
+					ResolveDir: args.ResolveDir,
+					Kind:       args.Kind,
+					PluginData: skipImportSuffixes{},
+					With:       args.With,
+				})
+				if len(resolved.Errors) > 0 || resolved.Namespace != "file" {
+					return onResolveResult(resolved), nil
+				}
+				result := onResolveResult(resolved)
+				if suffix == "?url" {
+					result.Namespace = urlNamespace
+				} else {
+					result.Suffix = suffix
+				}
+				return result, nil
+			})
+			load := func(path string, loader api.Loader) (api.OnLoadResult, error) {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return api.OnLoadResult{}, err
+				}
+				contents := string(data)
+				return api.OnLoadResult{Contents: &contents, Loader: loader}, nil
+			}
+			build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: "file"}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+				if args.Suffix != "?raw" {
+					return api.OnLoadResult{}, nil
+				}
+				return load(args.Path, api.LoaderText)
+			})
+			build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: urlNamespace}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+				return load(args.Path, api.LoaderFile)
+			})
+		},
+	}, nil
+}
@@ -0,0 +1,129 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// defaultLiveReloadPath is the path of the live reload event stream, the
+// same as that of esbuild's own.
+const defaultLiveReloadPath = "/esbuild"
+
+// liveReload streams a `change` event to the connected browsers after each
+// rebuild that changed outputs, using server-sent events.
+type liveReload struct {
+	path string
+
+	mu          sync.Mutex
+	subscribers map[chan string]struct{}
+}
+
+func newLiveReload(path string) *liveReload {
+	if path == "" {
+		path = defaultLiveReloadPath
+	}
+	return &liveReload{path: path, subscribers: make(map[chan string]struct{})}
+}
+
+// reloadClient connects to the live reload stream and reloads the page on
+// changes. The stream is located relative to the script itself, so that it
+// also works when the script is included by a page served elsewhere.
+const reloadClient = `(() => {
+  if (typeof window === "undefined" || typeof EventSource === "undefined" || window.__esbuildPyLiveReload) return;
+  window.__esbuildPyLiveReload = true;
+  const script = document.currentScript;
+  const url = new URL(%q, script ? script.src : location.href);
+  new EventSource(url).addEventListener("change", () => location.reload());
+})();`
+
+// withReloadClient returns a copy of the options with the reload client
+// prepended to the JS outputs using the banner.
+func withReloadClient(options api.BuildOptions, path string) api.BuildOptions {
+	if path == "" {
+		path = defaultLiveReloadPath
+	}
+	banner := make(map[string]string, len(options.Banner)+1)
+	for kind, text := range options.Banner {
+		banner[kind] = text
+	}
+	banner["js"] = strings.TrimSuffix(fmt.Sprintf(reloadClient, path)+"\n"+banner["js"], "\n")
+	options.Banner = banner
+	return options
+}
+
+// ServeHTTP streams events to a browser until it disconnects.
+func (l *liveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events := make(chan string, 16)
+	l.mu.Lock()
+	l.subscribers[events] = struct{}{}
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		delete(l.subscribers, events)
+		l.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-events:
+			if _, err := fmt.Fprintf(w, "event: change\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// notify sends a change event listing the URL paths of the updated outputs.
+// Browsers that can't keep up miss the event rather than block rebuilds.
+func (l *liveReload) notify(updated []string) {
+	data, _ := json.Marshal(map[string][]string{
+		"added":   make([]string, 0),
+		"removed": make([]string, 0),
+		"updated": updated,
+	})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for events := range l.subscribers {
+		select {
+		case events <- string(data):
+		default:
+		}
+	}
+}
+
+// outputURLs maps output file paths to the URL paths they are served at,
+// relative to servedir if it's set, or to the output directory otherwise.
+func outputURLs(paths []string, servedir string, outputDir string) []string {
+	base := servedir
+	if base == "" {
+		base = outputDir
+	}
+	urls := make([]string, 0, len(paths))
+	for _, path := range paths {
+		rel, err := filepath.Rel(base, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		urls = append(urls, "/"+filepath.ToSlash(rel))
+	}
+	return urls
+}
@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// emitManifest writes the manifest of a successful build to the path given
+// by the `manifest` option, or adds it to the output files of the result if
+// nothing is written, and returns it.
+func emitManifest(result *api.BuildResult, path string, options api.BuildOptions) (map[string]string, []api.Message) {
+	manifest := shared.NewManifest(result.Metafile, options)
+	contents, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, []api.Message{{Text: fmt.Sprintf("Failed to encode the manifest: %v", err)}}
+	}
+	contents = append(contents, '\n')
+	path = filepath.Join(shared.ManifestDir(options), path)
+
+	if !options.Write {
+		sum := sha256.Sum256(contents)
+		result.OutputFiles = append(result.OutputFiles, api.OutputFile{
+			Path:     path,
+			Contents: contents,
+			Hash:     base64.RawURLEncoding.EncodeToString(sum[:9]),
+		})
+		return manifest, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, []api.Message{{Text: fmt.Sprintf("Failed to write the manifest: %v", err)}}
+	}
+	if err := os.WriteFile(path, contents, 0o644); err != nil {
+		return nil, []api.Message{{Text: fmt.Sprintf("Failed to write the manifest: %v", err)}}
+	}
+	return manifest, nil
+}
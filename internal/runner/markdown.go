@@ -0,0 +1,28 @@
+package runner
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// markdown renders CommonMark with GitHub's tables and strikethrough. Raw
+// HTML is kept, since the documents are part of the project being built
+// rather than user input.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.Table, extension.Strikethrough),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+// renderMarkdown renders a Markdown document to HTML.
+func renderMarkdown(source string) string {
+	var b bytes.Buffer
+	if err := markdown.Convert([]byte(source), &b); err != nil {
+		// Rendering to memory can't fail, but the source is better than
+		// nothing.
+		return source
+	}
+	return b.String()
+}
@@ -0,0 +1,39 @@
+package runner
+
+import "testing"
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"headings", "# Title\n\nSetext\n------\n", "<h1>Title</h1>\n<h2>Setext</h2>\n"},
+		{"paragraph and emphasis", "Some *em* and **strong** text.", "<p>Some <em>em</em> and <strong>strong</strong> text.</p>\n"},
+		{"unordered list", "- one\n- two\n", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"},
+		{"ordered list", "3. three\n4. four\n", "<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n"},
+		{"nested list", "- a\n  - b\n", "<ul>\n<li>a\n<ul>\n<li>b</li>\n</ul>\n</li>\n</ul>\n"},
+		{"code fence", "```js\nif (a < b) {}\n```\n", "<pre><code class=\"language-js\">if (a &lt; b) {}\n</code></pre>\n"},
+		{"indented code", "    x = 1\n", "<pre><code>x = 1\n</code></pre>\n"},
+		{"code span", "Use `a<b>`.", "<p>Use <code>a&lt;b&gt;</code>.</p>\n"},
+		{"inline link", "[docs](https://example.com \"Docs\")", "<p><a href=\"https://example.com\" title=\"Docs\">docs</a></p>\n"},
+		{"reference link", "[docs][1]\n\n[1]: /docs", "<p><a href=\"/docs\">docs</a></p>\n"},
+		{"autolink", "<https://example.com>", "<p><a href=\"https://example.com\">https://example.com</a></p>\n"},
+		{"image", "![alt](logo.png)", "<p><img src=\"logo.png\" alt=\"alt\"></p>\n"},
+		{"escaping", "1 < 2 & \"quotes\" \\*not em\\*", "<p>1 &lt; 2 &amp; &quot;quotes&quot; *not em*</p>\n"},
+		{"entities", "&copy; &#169;", "<p>© ©</p>\n"},
+		{"inline html", "a <kbd>Ctrl</kbd> b", "<p>a <kbd>Ctrl</kbd> b</p>\n"},
+		{"html block", "<div class=\"note\">\nhi\n</div>\n", "<div class=\"note\">\nhi\n</div>\n"},
+		{"block quote", "> quoted\n", "<blockquote>\n<p>quoted</p>\n</blockquote>\n"},
+		{"thematic break", "***\n", "<hr>\n"},
+		{"strikethrough", "~~gone~~", "<p><del>gone</del></p>\n"},
+		{"table", "| a | b |\n|:--|--:|\n| 1 | 2 |\n", "<table>\n<thead>\n<tr>\n<th style=\"text-align:left\">a</th>\n<th style=\"text-align:right\">b</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td style=\"text-align:left\">1</td>\n<td style=\"text-align:right\">2</td>\n</tr>\n</tbody>\n</table>\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := renderMarkdown(test.source); got != test.want {
+				t.Errorf("renderMarkdown(%q) = %q, want %q", test.source, got, test.want)
+			}
+		})
+	}
+}
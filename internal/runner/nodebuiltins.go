@@ -0,0 +1,121 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// nodeBuiltins lists the modules built into Node.
+var nodeBuiltins = []string{
+	"assert", "async_hooks", "buffer", "child_process", "cluster", "console",
+	"constants", "crypto", "dgram", "diagnostics_channel", "dns", "domain",
+	"events", "fs", "http", "http2", "https", "inspector", "module", "net",
+	"os", "path", "perf_hooks", "process", "punycode", "querystring",
+	"readline", "repl", "stream", "string_decoder", "sys", "timers", "tls",
+	"trace_events", "tty", "url", "util", "v8", "vm", "wasi",
+	"worker_threads", "zlib",
+}
+
+// nodePolyfills maps Node builtins to the npm packages that implement them
+// for browsers, as popularized by Browserify and webpack 4.
+var nodePolyfills = map[string]string{
+	"assert":         "assert",
+	"buffer":         "buffer",
+	"console":        "console-browserify",
+	"constants":      "constants-browserify",
+	"crypto":         "crypto-browserify",
+	"domain":         "domain-browser",
+	"events":         "events",
+	"http":           "stream-http",
+	"https":          "https-browserify",
+	"os":             "os-browserify/browser",
+	"path":           "path-browserify",
+	"process":        "process/browser",
+	"punycode":       "punycode",
+	"querystring":    "querystring-es3",
+	"stream":         "stream-browserify",
+	"string_decoder": "string_decoder",
+	"sys":            "util",
+	"timers":         "timers-browserify",
+	"tty":            "tty-browserify",
+	"url":            "url",
+	"util":           "util",
+	"vm":             "vm-browserify",
+	"zlib":           "browserify-zlib",
+}
+
+// nodeBuiltinNamespace is the namespace of the empty stand-ins for Node
+// builtins.
+const nodeBuiltinNamespace = "node-builtin"
+
+// Modes of the `nodeBuiltins` option.
+const (
+	nodeBuiltinsEmpty    = "empty"
+	nodeBuiltinsPolyfill = "polyfill"
+)
+
+// skipNodeBuiltins marks the resolutions of polyfills, whose packages often
+// have the same name as the builtin they replace.
+type skipNodeBuiltins struct{}
+
+// nodeBuiltinsPlugin lets code written for Node be bundled for browsers by
+// replacing the imports of Node builtins, with or without the `node:`
+// prefix. With "empty", they are replaced by empty modules. With
+// "polyfill", the polyfill package of each builtin is used if it's
+// installed, and an empty module with a warning otherwise.
+func nodeBuiltinsPlugin(mode string) (api.Plugin, []api.Message) {
+	if mode != nodeBuiltinsEmpty && mode != nodeBuiltinsPolyfill {
+		return api.Plugin{Name: "esbuild-py:node-builtins", Setup: func(api.PluginBuild) {}}, []api.Message{shared.NewOptionsError(
+			fmt.Sprintf("Invalid nodeBuiltins mode %q", mode),
+			"Valid modes are: empty, polyfill")}
+	}
+	// A trailing slash, as in "buffer/", refers to the npm package rather
+	// than the builtin.
+	filter := "^(node:)?(" + strings.Join(nodeBuiltins, "|") + ")(/[^/].*)?$"
+	empty := "module.exports = {}"
+
+	return api.Plugin{
+		Name: "esbuild-py:node-builtins",
+		Setup: func(build api.PluginBuild) {
+			build.OnResolve(api.OnResolveOptions{Filter: filter}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				if _, ok := args.PluginData.(skipNodeBuiltins); ok {
+					return api.OnResolveResult{}, nil
+				}
+				name := strings.TrimPrefix(args.Path, "node:")
+				if mode == nodeBuiltinsEmpty {
+					return api.OnResolveResult{Path: name, Namespace: nodeBuiltinNamespace}, nil
+				}
+
+				base, _, _ := strings.Cut(name, "/")
+				if polyfill, ok := nodePolyfills[base]; ok {
+					resolved := build.Resolve(polyfill, api.ResolveOptions{
+						Importer:   args.Importer,
+						Namespace:  args.Namespace,
+						ResolveDir: args.ResolveDir,
+						Kind:       args.Kind,
+						PluginData: skipNodeBuiltins{},
+						With:       args.With,
+					})
+					if len(resolved.Errors) == 0 {
+						return onResolveResult(resolved), nil
+					}
+				}
+				warning := api.Message{Text: fmt.Sprintf("The Node builtin %q was replaced by an empty module", name)}
+				if polyfill, ok := nodePolyfills[base]; ok {
+					warning.Notes = []api.Note{{Text: fmt.Sprintf("Install the %q package to polyfill it.", strings.Split(polyfill, "/")[0])}}
+				}
+				return api.OnResolveResult{
+					Path:      name,
+					Namespace: nodeBuiltinNamespace,
+					Warnings:  []api.Message{warning},
+				}, nil
+			})
+			build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: nodeBuiltinNamespace}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+				return api.OnLoadResult{Contents: &empty, Loader: api.LoaderJS}, nil
+			})
+		},
+	}, nil
+}
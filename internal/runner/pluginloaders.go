@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"gopkg.in/yaml.v3"
+)
+
+// pluginLoader turns the contents of a file into contents for one of
+// esbuild's loaders, given the options of the build.
+type pluginLoader func(source string, file string, options *api.BuildOptions) (string, api.Loader, error)
+
+// pluginLoaders implement the loaders that esbuild doesn't have.
+var pluginLoaders = map[string]pluginLoader{
+	"yaml":          dataLoader(parseYAML),
+	"toml":          dataLoader(func(source string) (any, error) { return parseTOML(source) }),
+	"markdown":      textLoader(func(source string) string { return source }),
+	"markdown-html": textLoader(renderMarkdown),
+	"wasm":          wasmLoader,
+}
+
+// textLoader imports a string made from the contents of a file.
+func textLoader(render func(string) string) pluginLoader {
+	return func(source string, file string, options *api.BuildOptions) (string, api.Loader, error) {
+		return render(source), api.LoaderText, nil
+	}
+}
+
+// dataLoader hands esbuild the data parsed from a file as JSON, so that it's
+// imported like a JSON file.
+func dataLoader(parse func(string) (any, error)) pluginLoader {
+	return func(source string, file string, options *api.BuildOptions) (string, api.Loader, error) {
+		value, err := parse(source)
+		if err != nil {
+			return "", api.LoaderNone, err
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", api.LoaderNone, fmt.Errorf("can't convert to JSON: %v", err)
+		}
+		return string(encoded), api.LoaderJSON, nil
+	}
+}
+
+// pluginLoadersPlugin loads the files whose extension is mapped to one of
+// the pluginLoaders in the `loader` build option.
+func pluginLoadersPlugin(extensions map[string]string) (api.Plugin, []api.Message) {
+	quoted := make([]string, 0, len(extensions))
+	for ext := range extensions {
+		quoted = append(quoted, regexp.QuoteMeta(ext))
+	}
+	sort.Strings(quoted)
+	filter := `(` + strings.Join(quoted, "|") + `)$`
+
+	return api.Plugin{
+		Name: "esbuild-py:plugin-loaders",
+		Setup: func(build api.PluginBuild) {
+			for _, name := range extensions {
+				if name == "wasm" {
+					setupWasmAssets(build)
+					break
+				}
+			}
+			build.OnLoad(api.OnLoadOptions{Filter: filter, Namespace: "file"}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+				name, ok := extensions[filepath.Ext(args.Path)]
+				if !ok {
+					return api.OnLoadResult{}, nil
+				}
+				data, err := os.ReadFile(args.Path)
+				if err != nil {
+					return api.OnLoadResult{}, err
+				}
+				contents, loader, err := pluginLoaders[name](string(data), args.Path, build.InitialOptions)
+				if err != nil {
+					return api.OnLoadResult{}, fmt.Errorf("Failed to load %s with the %q loader: %v", filepath.Base(args.Path), name, err)
+				}
+				return api.OnLoadResult{Contents: &contents, Loader: loader}, nil
+			})
+		},
+	}, nil
+}
+
+// parseYAML decodes the first document of a YAML file. Mappings with keys
+// other than strings become objects whose keys are the keys' text, as JSON
+// requires.
+func parseYAML(source string) (value any, err error) {
+	defer func() {
+		// Malformed documents may make the parser panic.
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	if err := yaml.Unmarshal([]byte(source), &value); err != nil {
+		return nil, err
+	}
+	return jsonCompatible(value), nil
+}
+
+// jsonCompatible converts the mappings decoded by the YAML parser to maps
+// with string keys.
+func jsonCompatible(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = jsonCompatible(item)
+		}
+	case map[any]any:
+		converted := make(map[string]any, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = jsonCompatible(item)
+		}
+		return converted
+	case []any:
+		for i, item := range v {
+			v[i] = jsonCompatible(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDataLoaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		loader string
+		source string
+		want   string
+	}{
+		{"empty toml", "toml", "", `{}`},
+		{"toml scalars", "toml", "title = \"app\"\nport = 8080\nratio = 0.5\ndebug = true", `{"debug":true,"port":8080,"ratio":0.5,"title":"app"}`},
+		{"toml tables", "toml", "[server]\nhost = \"localhost\"\n[server.tls]\nenabled = false", `{"server":{"host":"localhost","tls":{"enabled":false}}}`},
+		{"toml inline table", "toml", "point = { x = 1, y = 2 }", `{"point":{"x":1,"y":2}}`},
+		{"toml array of tables", "toml", "[[users]]\nname = \"a\"\n[[users]]\nname = \"b\"", `{"users":[{"name":"a"},{"name":"b"}]}`},
+		{"toml dates", "toml", "a = 1979-05-27T07:32:00-08:00\nb = 1979-05-27T07:32:00\nc = 1979-05-27\nd = 07:32:00\ne = [1979-05-27]", `{"a":"1979-05-27T07:32:00-08:00","b":"1979-05-27T07:32:00","c":"1979-05-27","d":"07:32:00","e":["1979-05-27"]}`},
+		{"toml dates in array of tables", "toml", "[[events]]\nat = 2024-01-02", `{"events":[{"at":"2024-01-02"}]}`},
+		{"toml strings", "toml", "a = 'C:\\path'\nb = \"\"\"\nline\"\"\"\nc = \"\\u00e9\"", `{"a":"C:\\path","b":"line","c":"é"}`},
+		{"yaml mapping", "yaml", "name: app\nports:\n  - 80\n  - 443", `{"name":"app","ports":[80,443]}`},
+		{"yaml non-string keys", "yaml", "1: one\ntrue: yes", `{"1":"one","true":"yes"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contents, _, err := pluginLoaders[test.loader](test.source, "data", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertSameJSON(t, contents, test.want)
+		})
+	}
+}
+
+func TestDataLoadersReportSyntaxErrors(t *testing.T) {
+	for loader, source := range map[string]string{
+		"toml": "a = 1\na = 2",
+		"yaml": "a: [1, 2",
+	} {
+		if _, _, err := pluginLoaders[loader](source, "data", nil); err == nil {
+			t.Errorf("%s: expected an error for %q", loader, source)
+		}
+	}
+}
+
+// assertSameJSON compares two JSON documents regardless of formatting and
+// key order.
+func assertSameJSON(t *testing.T, got string, want string) {
+	t.Helper()
+	var gotValue, wantValue any
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", want, err)
+	}
+	gotJSON, _ := json.Marshal(gotValue)
+	wantJSON, _ := json.Marshal(wantValue)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("got %s, want %s", gotJSON, wantJSON)
+	}
+}
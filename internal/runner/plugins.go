@@ -0,0 +1,320 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// Plugins written in Python are declared in the build request. Every call of
+// one of their hooks is passed to the plugin callback with an ID, and the
+// build waits until Python answers it with RespondPluginCall.
+var (
+	pluginCallbackMu sync.Mutex
+	pluginCallback   func(id uint64, call shared.PluginCall)
+
+	pluginCallsMu    sync.Mutex
+	nextPluginCallID uint64
+	pluginCalls      = make(map[uint64]chan []byte)
+
+	// pluginBuilds holds the resolver of each build using a Python plugin,
+	// until the build is disposed.
+	pluginBuildsMu    sync.Mutex
+	nextPluginBuildID uint64
+	pluginBuilds      = make(map[uint64]func(string, api.ResolveOptions) api.ResolveResult)
+)
+
+// pluginDisposeTimeout is how long an onDispose call waits for Python to
+// answer. Nothing waits for the answer itself, but the call is only
+// forgotten once it's answered or abandoned.
+const pluginDisposeTimeout = 10 * time.Second
+
+// pluginScope passes the context of the running build to the hooks of
+// Python plugins, since esbuild calls them without one. Hook calls are
+// abandoned once that context is done, so that a hook Python never answers
+// can't hang a build past its timeout or cancellation, or a context past
+// its disposal.
+type pluginScope struct {
+	mu  sync.Mutex
+	ctx context.Context
+
+	// base is the context of the builds esbuild starts by itself, such as
+	// those of its dev server. It's cancelled by close.
+	base  context.Context
+	close context.CancelFunc
+}
+
+func newPluginScope() *pluginScope {
+	base, close := context.WithCancel(context.Background())
+	return &pluginScope{ctx: base, base: base, close: close}
+}
+
+// enter makes ctx the context of the hook calls, until the returned
+// function is called at the end of the build.
+func (s *pluginScope) enter(ctx context.Context) (leave func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(s.base, cancel)
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		s.ctx = s.base
+		s.mu.Unlock()
+		stop()
+		cancel()
+	}
+}
+
+// context returns the context of the running build.
+func (s *pluginScope) context() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ctx
+}
+
+// SetPluginCallback registers the function that forwards hook calls to
+// Python. Builds with Python plugins fail while none is registered.
+func SetPluginCallback(callback func(id uint64, call shared.PluginCall)) {
+	pluginCallbackMu.Lock()
+	defer pluginCallbackMu.Unlock()
+	pluginCallback = callback
+}
+
+// RespondPluginCall delivers the JSON result of a hook call, resuming the
+// build that made it.
+func RespondPluginCall(id uint64, resultData []byte) error {
+	pluginCallsMu.Lock()
+	reply, ok := pluginCalls[id]
+	delete(pluginCalls, id)
+	pluginCallsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown plugin call %d", id)
+	}
+	reply <- resultData
+	return nil
+}
+
+// callPlugin sends a hook call to Python and waits for its result, until
+// ctx is done. It runs on esbuild's goroutines, or a goroutine of its own
+// for onDispose, so a panic is returned as an error rather than crashing the
+// Python process.
+func callPlugin(ctx context.Context, call shared.PluginCall) (result shared.PluginResult, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("internal error in esbuild-py: %v", recovered)
+		}
+	}()
+	pluginCallbackMu.Lock()
+	callback := pluginCallback
+	pluginCallbackMu.Unlock()
+	if callback == nil {
+		return result, errors.New("no plugin callback is registered")
+	}
+
+	// The reply is buffered, since Python may answer before the callback
+	// returns.
+	reply := make(chan []byte, 1)
+	pluginCallsMu.Lock()
+	nextPluginCallID++
+	id := nextPluginCallID
+	pluginCalls[id] = reply
+	pluginCallsMu.Unlock()
+	// An answered call is already forgotten, but an abandoned one must be,
+	// so that a late answer is rejected.
+	defer func() {
+		pluginCallsMu.Lock()
+		delete(pluginCalls, id)
+		pluginCallsMu.Unlock()
+	}()
+
+	callback(id, call)
+	select {
+	case data := <-reply:
+		if err := json.Unmarshal(data, &result); err != nil {
+			return result, fmt.Errorf("invalid plugin result: %w", err)
+		}
+		return result, nil
+	case <-ctx.Done():
+		return result, fmt.Errorf("the %s hook of plugin %q was abandoned without an answer: %w", call.Hook, call.Plugin, ctx.Err())
+	}
+}
+
+// pythonPlugin creates the esbuild plugin that forwards the hooks declared
+// by a Python plugin, within the given scope.
+func pythonPlugin(plugin shared.PluginRequest, scope *pluginScope) api.Plugin {
+	return api.Plugin{
+		Name: plugin.Name,
+		Setup: func(build api.PluginBuild) {
+			pluginBuildsMu.Lock()
+			nextPluginBuildID++
+			buildID := nextPluginBuildID
+			pluginBuilds[buildID] = build.Resolve
+			pluginBuildsMu.Unlock()
+			build.OnDispose(func() {
+				pluginBuildsMu.Lock()
+				delete(pluginBuilds, buildID)
+				pluginBuildsMu.Unlock()
+				if plugin.OnDispose {
+					// Disposing doesn't wait for Python, which may be busy
+					// disposing the context.
+					go func() {
+						ctx, cancel := context.WithTimeout(context.Background(), pluginDisposeTimeout)
+						defer cancel()
+						callPlugin(ctx, shared.PluginCall{Hook: "onDispose", Plugin: plugin.Name, Build: buildID})
+					}()
+				}
+			})
+
+			if plugin.OnStart {
+				build.OnStart(func() (api.OnStartResult, error) {
+					result, err := callPlugin(scope.context(), shared.PluginCall{Hook: "onStart", Plugin: plugin.Name, Build: buildID})
+					return api.OnStartResult{Errors: shared.APIMessages(result.Errors), Warnings: shared.APIMessages(result.Warnings)}, err
+				})
+			}
+			if plugin.OnEnd {
+				build.OnEnd(func(buildResult *api.BuildResult) (api.OnEndResult, error) {
+					result, err := callPlugin(scope.context(), shared.PluginCall{
+						Hook:   "onEnd",
+						Plugin: plugin.Name,
+						Build:  buildID,
+						Result: shared.NewPluginBuildResult(buildResult),
+					})
+					return api.OnEndResult{Errors: shared.APIMessages(result.Errors), Warnings: shared.APIMessages(result.Warnings)}, err
+				})
+			}
+			for index, hook := range plugin.OnResolve {
+				build.OnResolve(api.OnResolveOptions{Filter: hook.Filter, Namespace: hook.Namespace}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+					result, err := callPlugin(scope.context(), shared.PluginCall{
+						Hook:       "onResolve",
+						Plugin:     plugin.Name,
+						Build:      buildID,
+						Index:      index,
+						Path:       args.Path,
+						Importer:   args.Importer,
+						Namespace:  args.Namespace,
+						ResolveDir: args.ResolveDir,
+						Kind:       shared.MapResolveKindToString(args.Kind),
+						PluginData: pluginDataToJSON(args.PluginData),
+						With:       args.With,
+					})
+					if err != nil {
+						return api.OnResolveResult{}, err
+					}
+					resolved := api.OnResolveResult{
+						Errors:     shared.APIMessages(result.Errors),
+						Warnings:   shared.APIMessages(result.Warnings),
+						Path:       result.Path,
+						External:   result.External,
+						Namespace:  result.Namespace,
+						Suffix:     result.Suffix,
+						PluginData: pluginDataFromJSON(result.PluginData),
+						WatchFiles: result.WatchFiles,
+						WatchDirs:  result.WatchDirs,
+					}
+					if result.SideEffects != nil && !*result.SideEffects {
+						resolved.SideEffects = api.SideEffectsFalse
+					}
+					return resolved, nil
+				})
+			}
+			for index, hook := range plugin.OnLoad {
+				build.OnLoad(api.OnLoadOptions{Filter: hook.Filter, Namespace: hook.Namespace}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+					result, err := callPlugin(scope.context(), shared.PluginCall{
+						Hook:       "onLoad",
+						Plugin:     plugin.Name,
+						Build:      buildID,
+						Index:      index,
+						Path:       args.Path,
+						Namespace:  args.Namespace,
+						Suffix:     args.Suffix,
+						PluginData: pluginDataToJSON(args.PluginData),
+						With:       args.With,
+					})
+					if err != nil {
+						return api.OnLoadResult{}, err
+					}
+					loader, msg := shared.ParseLoader(result.Loader)
+					if msg != nil {
+						return api.OnLoadResult{}, errors.New(msg.Text)
+					}
+					return api.OnLoadResult{
+						Errors:     shared.APIMessages(result.Errors),
+						Warnings:   shared.APIMessages(result.Warnings),
+						Contents:   result.Contents,
+						ResolveDir: result.ResolveDir,
+						Loader:     loader,
+						PluginData: pluginDataFromJSON(result.PluginData),
+						WatchFiles: result.WatchFiles,
+						WatchDirs:  result.WatchDirs,
+					}, nil
+				})
+			}
+		},
+	}
+}
+
+// PluginResolve resolves a path with esbuild's resolver on behalf of a
+// Python plugin, like `build.resolve` in the JavaScript API.
+func PluginResolve(buildID uint64, requestData []byte) *shared.PluginResolveResponse {
+	pluginBuildsMu.Lock()
+	resolve, ok := pluginBuilds[buildID]
+	pluginBuildsMu.Unlock()
+	if !ok {
+		return &shared.PluginResolveResponse{
+			Errors:   shared.NewMessages([]api.Message{{Text: fmt.Sprintf("unknown plugin build %d", buildID)}}),
+			Warnings: make([]shared.Message, 0),
+		}
+	}
+	var req shared.PluginResolveRequest
+	if err := json.Unmarshal(requestData, &req); err != nil {
+		return &shared.PluginResolveResponse{
+			Errors:   shared.NewMessages([]api.Message{shared.NewRequestError("Failed to parse resolve request JSON: " + err.Error())}),
+			Warnings: make([]shared.Message, 0),
+		}
+	}
+
+	result := resolve(req.Path, api.ResolveOptions{
+		Importer:   req.Importer,
+		Namespace:  req.Namespace,
+		ResolveDir: req.ResolveDir,
+		Kind:       shared.MapStringToResolveKind(req.Kind),
+		PluginData: pluginDataFromJSON(req.PluginData),
+		With:       req.With,
+	})
+	response := &shared.PluginResolveResponse{
+		Errors:      shared.NewMessages(result.Errors),
+		Warnings:    shared.NewMessages(result.Warnings),
+		Path:        result.Path,
+		External:    result.External,
+		SideEffects: result.SideEffects,
+		Namespace:   result.Namespace,
+		Suffix:      result.Suffix,
+		PluginData:  pluginDataToJSON(result.PluginData),
+	}
+	return response
+}
+
+// pluginDataToJSON passes on the plugin data set by a Python hook. Plugin
+// data from Go plugins is kept from Python.
+func pluginDataToJSON(data any) json.RawMessage {
+	if raw, ok := data.(json.RawMessage); ok {
+		return raw
+	}
+	return nil
+}
+
+// pluginDataFromJSON stores the plugin data of a Python hook's result, which
+// esbuild hands back to the hooks called for the same module.
+func pluginDataFromJSON(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw
+}
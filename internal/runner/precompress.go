@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// precompressors map the extensions of precompressed files to their
+// compressors.
+var precompressors = map[string]func([]byte) []byte{
+	".gz": shared.Gzip,
+	".br": shared.Brotli,
+}
+
+// writePrecompressed writes gzip and Brotli variants next to the output
+// files, for static file servers to serve to the clients that accept them.
+// Variants that wouldn't be smaller than the file, as for images, are left
+// out. Files are compressed in parallel.
+func writePrecompressed(files []api.OutputFile) []api.Message {
+	var mu sync.Mutex
+	var errors []api.Message
+	var wg sync.WaitGroup
+	for _, file := range files {
+		for ext, compress := range precompressors {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				compressed := compress(file.Contents)
+				var err error
+				if len(compressed) < len(file.Contents) {
+					err = os.WriteFile(file.Path+ext, compressed, 0o644)
+				} else {
+					// A variant left over from a previous build would be
+					// out of date.
+					err = os.Remove(file.Path + ext)
+					if os.IsNotExist(err) {
+						err = nil
+					}
+				}
+				if err != nil {
+					mu.Lock()
+					errors = append(errors, api.Message{Text: fmt.Sprintf("Failed to write the precompressed output: %v", err)})
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	return errors
+}
@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"sync"
+	"time"
+)
+
+// maxQueuedEvents is the number of events kept for polling. Older events
+// are dropped once a queue is full.
+const maxQueuedEvents = 100
+
+// eventQueue buffers events, such as rebuilds of a watched context, until
+// Python polls for them.
+type eventQueue[T any] struct {
+	mu     sync.Mutex
+	events []T
+	ready  chan struct{}
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newEventQueue[T any]() *eventQueue[T] {
+	return &eventQueue[T]{ready: make(chan struct{}, 1), closed: make(chan struct{})}
+}
+
+// push queues an event and wakes up a waiting Poll.
+func (q *eventQueue[T]) push(event T) {
+	q.mu.Lock()
+	if len(q.events) >= maxQueuedEvents {
+		q.events = q.events[1:]
+	}
+	q.events = append(q.events, event)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop removes the oldest queued event, if any.
+func (q *eventQueue[T]) pop() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var event T
+	if len(q.events) == 0 {
+		return event, false
+	}
+	event = q.events[0]
+	q.events = q.events[1:]
+	return event, true
+}
+
+// close wakes up waiting Polls once no more events will be pushed.
+func (q *eventQueue[T]) close() {
+	q.once.Do(func() { close(q.closed) })
+}
+
+// Poll returns the oldest event, waiting up to timeout for one to happen. A
+// negative timeout waits indefinitely. The boolean is false if no event
+// happened in time or the queue was closed.
+func (q *eventQueue[T]) Poll(timeout time.Duration) (T, bool) {
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		if event, ok := q.pop(); ok {
+			return event, true
+		}
+		select {
+		case <-q.ready:
+		case <-q.closed:
+			return q.pop()
+		case <-expired:
+			var event T
+			return event, false
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package runner
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// The resolve cache keeps the results of esbuild's path resolution, which
+// reads package.json and tsconfig.json files, across independent builds.
+// esbuild only caches them within a build context. The cache is opt-in
+// since it doesn't notice files being added, moved or removed.
+var (
+	resolveCacheEnabled atomic.Bool
+	resolveCacheMu      sync.Mutex
+	resolveCache        = make(map[resolveKey]api.OnResolveResult)
+)
+
+// resolveKey identifies a resolution. It includes the options that affect
+// resolution, so that builds with different settings don't share results.
+type resolveKey struct {
+	options    string
+	path       string
+	importer   string
+	resolveDir string
+	kind       api.ResolveKind
+	with       string
+}
+
+// resolveOptions holds the build options that affect resolution.
+type resolveOptions struct {
+	AbsWorkingDir     string
+	Platform          api.Platform
+	External          []string
+	Packages          api.Packages
+	Alias             map[string]string
+	MainFields        []string
+	Conditions        []string
+	ResolveExtensions []string
+	Tsconfig          string
+	TsconfigRaw       string
+	NodePaths         []string
+	PreserveSymlinks  bool
+}
+
+// skipResolveCache marks the nested resolutions made by the cache plugin
+// itself, so that it doesn't recurse.
+type skipResolveCache struct{}
+
+// SetResolveCache enables or disables the shared resolve cache. Disabling it
+// also drops the cached results.
+func SetResolveCache(enabled bool) {
+	resolveCacheEnabled.Store(enabled)
+	if !enabled {
+		resolveCacheMu.Lock()
+		resolveCache = make(map[resolveKey]api.OnResolveResult)
+		resolveCacheMu.Unlock()
+	}
+}
+
+// ResolveCacheEnabled reports whether the shared resolve cache is in use.
+func ResolveCacheEnabled() bool {
+	return resolveCacheEnabled.Load()
+}
+
+// resolveCachePlugin answers resolutions of files from the shared cache,
+// asking esbuild to resolve those that aren't cached yet.
+func resolveCachePlugin(options api.BuildOptions) api.Plugin {
+	optionsKey, _ := json.Marshal(resolveOptions{
+		AbsWorkingDir:     options.AbsWorkingDir,
+		Platform:          options.Platform,
+		External:          options.External,
+		Packages:          options.Packages,
+		Alias:             options.Alias,
+		MainFields:        options.MainFields,
+		Conditions:        options.Conditions,
+		ResolveExtensions: options.ResolveExtensions,
+		Tsconfig:          options.Tsconfig,
+		TsconfigRaw:       options.TsconfigRaw,
+		NodePaths:         options.NodePaths,
+		PreserveSymlinks:  options.PreserveSymlinks,
+	})
+
+	return api.Plugin{
+		Name: "esbuild-py:resolve-cache",
+		Setup: func(build api.PluginBuild) {
+			build.OnResolve(api.OnResolveOptions{Filter: ".*", Namespace: "file"}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				if _, ok := args.PluginData.(skipResolveCache); ok {
+					return api.OnResolveResult{}, nil
+				}
+				with, _ := json.Marshal(args.With)
+				key := resolveKey{
+					options:    string(optionsKey),
+					path:       args.Path,
+					importer:   args.Importer,
+					resolveDir: args.ResolveDir,
+					kind:       args.Kind,
+					with:       string(with),
+				}
+				resolveCacheMu.Lock()
+				cached, ok := resolveCache[key]
+				resolveCacheMu.Unlock()
+				if ok {
+					return cached, nil
+				}
+
+				resolved := build.Resolve(args.Path, api.ResolveOptions{
+					Importer:   args.Importer,
+					Namespace:  args.Namespace,
+					ResolveDir: args.ResolveDir,
+					Kind:       args.Kind,
+					PluginData: skipResolveCache{},
+					With:       args.With,
+				})
+				result := onResolveResult(resolved)
+				if len(resolved.Errors) == 0 {
+					resolveCacheMu.Lock()
+					resolveCache[key] = result
+					resolveCacheMu.Unlock()
+				}
+				return result, nil
+			})
+		},
+	}
+}
+
+// onResolveResult turns the result of build.Resolve into the result of an
+// onResolve hook.
+func onResolveResult(resolved api.ResolveResult) api.OnResolveResult {
+	result := api.OnResolveResult{
+		Errors:     resolved.Errors,
+		Warnings:   resolved.Warnings,
+		Path:       resolved.Path,
+		External:   resolved.External,
+		Namespace:  resolved.Namespace,
+		Suffix:     resolved.Suffix,
+		PluginData: resolved.PluginData,
+	}
+	if !resolved.SideEffects {
+		result.SideEffects = api.SideEffectsFalse
+	}
+	return result
+}
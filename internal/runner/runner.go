@@ -0,0 +1,315 @@
+// Package runner executes transform and build requests on behalf of the
+// exported functions of the bindings. Every operation takes a context, which
+// is cancelled when Python cancels a submitted request.
+package runner
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/jobs"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// Counters for the stats export.
+var (
+	builds     atomic.Int64
+	buildTime  atomic.Int64
+	transforms atomic.Int64
+)
+
+// Transform decodes and runs a transform request.
+func Transform(ctx context.Context, requestData []byte, encoding shared.Encoding) *shared.ApiResponse {
+	req, err := shared.DecodeTransformRequest(requestData, encoding)
+	if err != nil {
+		// On failure, create a response with the parsing error.
+		return shared.NewApiResponse("", []api.Message{shared.NewRequestError("Failed to parse request " + encoding.String() + ": " + err.Error())}, nil)
+	}
+	return ExecuteTransform(ctx, req)
+}
+
+// ExecuteTransform runs a decoded transform request. esbuild's Transform
+// API can't be interrupted, so when ctx is cancelled the transform is left
+// to finish in the background and its result is discarded.
+func ExecuteTransform(ctx context.Context, req shared.TransformRequest) *shared.ApiResponse {
+	begin := time.Now()
+	warnings := req.Options.UnknownOptionWarnings()
+	realOptions, errors := req.Options.ToTransformOptions()
+	if len(errors) > 0 {
+		return shared.NewApiResponse("", errors, warnings)
+	}
+	validated := time.Now()
+
+	ctx, cancel := withTimeout(ctx, req.Options.TimeoutMs)
+	defer cancel()
+
+	var result api.TransformResult
+	var start, finish time.Time
+	err := detach(ctx, func() error {
+		return jobs.DefaultLimiter.Do(ctx, func() {
+			start = time.Now()
+			result = api.Transform(req.Code, realOptions)
+			finish = time.Now()
+			transforms.Add(1)
+		})
+	})
+	if err != nil {
+		return shared.NewCancelledResponse(err, warnings)
+	}
+
+	// Use the shared constructor to create a well-formed response.
+	response := shared.NewApiResponse(string(result.Code), result.Errors, append(warnings, result.Warnings...))
+	response.Timings = &shared.Timings{
+		ValidateMs: milliseconds(validated.Sub(begin)),
+		QueueMs:    milliseconds(start.Sub(validated)),
+		EsbuildMs:  milliseconds(finish.Sub(start)),
+		TotalMs:    milliseconds(time.Since(begin)),
+	}
+	response.FilterMessages(req.Options.LogLevel, req.Options.LogLimit, req.Options.LogOverride)
+	return response
+}
+
+// Build decodes and runs a build request.
+func Build(ctx context.Context, requestData []byte, encoding shared.Encoding) *shared.ApiResponse {
+	var req shared.BuildRequest
+	if err := encoding.Unmarshal(requestData, &req); err != nil {
+		return shared.NewApiResponse("", []api.Message{shared.NewRequestError("Failed to parse build request " + encoding.String() + ": " + err.Error())}, nil)
+	}
+	return ExecuteBuild(ctx, req)
+}
+
+// ExecuteBuild runs a decoded build request. The build runs in an esbuild
+// build context, so that cancelling ctx cancels the build itself.
+func ExecuteBuild(ctx context.Context, req shared.BuildRequest) *shared.ApiResponse {
+	start := time.Now()
+	plugins := newPluginScope()
+	defer plugins.close()
+	options, warnings, failed := prepareBuild(req, plugins)
+	if failed != nil {
+		return failed
+	}
+	buildCtx, ctxErr := api.Context(options)
+	if ctxErr != nil {
+		return shared.NewApiResponse("", ctxErr.Errors, warnings)
+	}
+	defer buildCtx.Dispose()
+	validated := time.Since(start)
+	response, _ := rebuild(ctx, buildCtx, plugins, &req, options, warnings)
+	if response.Timings != nil {
+		response.Timings.ValidateMs = milliseconds(validated)
+		response.Timings.TotalMs = milliseconds(time.Since(start))
+	}
+	return response
+}
+
+// prepareBuild converts a build request into esbuild's options, whose
+// Python plugins run within the given scope. If the request is invalid, the
+// error response is returned instead.
+func prepareBuild(req shared.BuildRequest, scope *pluginScope) (api.BuildOptions, []api.Message, *shared.ApiResponse) {
+	warnings := req.UnknownOptionWarnings()
+	options, errors := req.ToBuildOptions()
+	if len(errors) > 0 {
+		return options, warnings, shared.NewApiResponse("", errors, warnings)
+	}
+
+	// For build, esbuild defaults to bundling if an outfile is specified.
+	// We will explicitly set it to true to be clear and consistent.
+	options.Bundle = true
+	plugins, errors := builtinPlugins(req)
+	if len(errors) > 0 {
+		return options, warnings, shared.NewApiResponse("", errors, warnings)
+	}
+	options.Plugins = append(options.Plugins, plugins...)
+	for _, plugin := range req.Plugins {
+		options.Plugins = append(options.Plugins, pythonPlugin(plugin, scope))
+	}
+	if ResolveCacheEnabled() {
+		options.Plugins = append(options.Plugins, resolveCachePlugin(options))
+	}
+	// The metafile lists the inputs of each build, which are the files
+	// watched for changes in contexts, and the outputs of its entry points
+	// and CSS modules reported in the response.
+	options.Metafile = true
+	return options, warnings, nil
+}
+
+// rebuild runs a build in the given esbuild context, which is cancelled
+// along with ctx, as are the calls of its Python plugins, and converts the
+// result into a response. The raw result is returned as well, for callers
+// that need more than the response.
+func rebuild(ctx context.Context, buildCtx api.BuildContext, plugins *pluginScope, req *shared.BuildRequest, options api.BuildOptions, warnings []api.Message) (*shared.ApiResponse, api.BuildResult) {
+	ctx, cancel := withTimeout(ctx, req.TimeoutMs)
+	defer cancel()
+
+	var result api.BuildResult
+	queued := time.Now()
+	var start, finish time.Time
+	err := jobs.DefaultLimiter.Do(ctx, func() {
+		stop := context.AfterFunc(ctx, buildCtx.Cancel)
+		defer stop()
+		defer plugins.enter(ctx)()
+
+		start = time.Now()
+		result = buildCtx.Rebuild()
+		finish = time.Now()
+		builds.Add(1)
+		buildTime.Add(finish.Sub(start).Milliseconds())
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return shared.NewCancelledResponse(err, warnings), result
+	}
+
+	// The extras below depend only on esbuild having built the output files,
+	// so that a budget being exceeded doesn't hide them.
+	built := len(result.Errors) == 0
+	if len(req.Budgets) > 0 && built {
+		errors, budgetWarnings := shared.CheckBudgets(result.Metafile, result.OutputFiles, req.Budgets, options.AbsWorkingDir)
+		result.Errors = append(result.Errors, errors...)
+		result.Warnings = append(result.Warnings, budgetWarnings...)
+	}
+	if req.Precompress && options.Write && built {
+		result.Errors = append(result.Errors, writePrecompressed(result.OutputFiles)...)
+	}
+	var integrity map[string]string
+	if req.Integrity != "" && built {
+		integrity = shared.NewIntegrity(result.OutputFiles, req.Integrity, options.AbsWorkingDir)
+	}
+	var sizes map[string]shared.OutputSize
+	if req.CompressedSizes && built {
+		sizes = shared.NewOutputSizes(result.OutputFiles, options.AbsWorkingDir)
+	}
+	// The manifest is emitted before the response is made, so that it's
+	// among the output files.
+	var manifest map[string]string
+	if req.Manifest != "" && built {
+		var errors []api.Message
+		manifest, errors = emitManifest(&result, req.Manifest, options)
+		result.Errors = append(result.Errors, errors...)
+	}
+	// Use the shared constructor. The code is empty as it's either written to
+	// a file or returned in the output files.
+	response := shared.NewApiResponse("", result.Errors, append(warnings, result.Warnings...))
+	response.Manifest = manifest
+	response.Integrity = integrity
+	response.Sizes = sizes
+	response.EntryPoints = options.EntryPoints
+	if !options.Write {
+		response.OutputFiles = shared.NewOutputFiles(result.OutputFiles)
+	}
+	response.Bundles = shared.NewEntryBundles(result.Metafile)
+	if req.Metafile {
+		response.Metafile = result.Metafile
+	}
+	if req.DependencyGraph {
+		response.Graph = shared.NewModuleGraph(result.Metafile)
+	}
+	if req.Analysis {
+		response.Report = shared.NewBuildReport(result.Metafile, options.AbsWorkingDir)
+	}
+	if req.TopModules > 0 {
+		response.TopModules = shared.NewTopModules(result.Metafile, req.TopModules)
+	}
+	if req.CSSModules != nil {
+		response.CSSModules = cssModuleNames(result.Metafile, *req.CSSModules, options.AbsWorkingDir)
+	}
+	response.Timings = &shared.Timings{
+		QueueMs:   milliseconds(start.Sub(queued)),
+		EsbuildMs: milliseconds(finish.Sub(start)),
+		ProcessMs: milliseconds(time.Since(finish)),
+		TotalMs:   milliseconds(time.Since(queued)),
+	}
+	response.FilterMessages(req.LogLevel, req.LogLimit, req.LogOverride)
+	return response, result
+}
+
+// Stats reports the memory usage of the Go runtime along with the requests
+// served so far.
+func Stats() *shared.Stats {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	active, queued := jobs.DefaultLimiter.Counts()
+	return &shared.Stats{
+		HeapAlloc:   memStats.HeapAlloc,
+		HeapSys:     memStats.HeapSys,
+		Active:      active,
+		Queued:      queued,
+		Builds:      builds.Load(),
+		BuildTimeMs: buildTime.Load(),
+		Transforms:  transforms.Load(),
+	}
+}
+
+// Configure applies the settings given in config and returns the resulting
+// configuration.
+func Configure(config shared.Config) shared.Config {
+	if config.Concurrency != nil {
+		jobs.DefaultLimiter.SetLimit(*config.Concurrency)
+	}
+	if config.ResolveCache != nil {
+		SetResolveCache(*config.ResolveCache)
+	}
+	concurrency := jobs.DefaultLimiter.Limit()
+	resolveCache := ResolveCacheEnabled()
+	return shared.Config{Concurrency: &concurrency, ResolveCache: &resolveCache}
+}
+
+// withTimeout derives a context that expires after timeoutMs milliseconds,
+// or returns ctx unchanged if no timeout was requested.
+func withTimeout(ctx context.Context, timeoutMs int) (context.Context, context.CancelFunc) {
+	if timeoutMs <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, time.Duration(timeoutMs)*time.Millisecond)
+}
+
+// milliseconds converts a duration to fractional milliseconds, since many
+// transforms take less than one.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// detach calls fn, but returns the context's error as soon as ctx is done
+// instead of waiting for fn to return. A panic in fn is passed on to the
+// caller if it's still waiting.
+func detach(ctx context.Context, fn func() error) error {
+	if ctx.Done() == nil {
+		return fn()
+	}
+	done := make(chan error, 1)
+	var recovered any
+	go func() {
+		defer func() {
+			recovered = recover()
+			close(done)
+		}()
+		done <- fn()
+	}()
+	select {
+	case err, ok := <-done:
+		if !ok {
+			panic(recovered)
+		}
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Recovered calls run, converting a panic into an internal error response.
+// Background jobs need this, since a panic in any goroutine crashes the
+// whole Python process.
+func Recovered(run func() *shared.ApiResponse) (response *shared.ApiResponse) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			response = shared.NewPanicResponse(recovered, debug.Stack())
+		}
+	}()
+	return run()
+}
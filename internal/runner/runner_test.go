@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+func TestBuildExtrasSurviveBudgetErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.js"), []byte("console.log('a fairly long string')\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	write := false
+	req := shared.BuildRequest{
+		BuildOptions: api.BuildOptions{
+			EntryPoints:   []string{"main.js"},
+			Bundle:        true,
+			Outdir:        "dist",
+			AbsWorkingDir: dir,
+		},
+		Write:           &write,
+		Manifest:        "manifest.json",
+		Integrity:       "sha256",
+		CompressedSizes: true,
+		Budgets:         []shared.SizeBudgetRequest{{Raw: 1}},
+	}
+	response := ExecuteBuild(context.Background(), req)
+	if len(response.Errors) != 1 || response.Errors[0].ID != "size-budget" {
+		t.Fatalf("errors = %+v, want a single size-budget error", response.Errors)
+	}
+	if response.Manifest["main.js"] != "main.js" {
+		t.Errorf("manifest = %v", response.Manifest)
+	}
+	if response.Integrity["dist/main.js"] == "" {
+		t.Errorf("integrity = %v", response.Integrity)
+	}
+	if _, ok := response.Sizes["dist/main.js"]; !ok {
+		t.Errorf("sizes = %v", response.Sizes)
+	}
+}
+
+func TestDecodeErrorsNameTheEncoding(t *testing.T) {
+	for encoding, want := range map[shared.Encoding]string{
+		shared.EncodingJSON:        "Failed to parse request JSON: ",
+		shared.EncodingMessagePack: "Failed to parse request MessagePack: ",
+	} {
+		response := Transform(context.Background(), []byte{0xc1}, encoding)
+		if len(response.Errors) != 1 || !strings.HasPrefix(response.Errors[0].Text, want) {
+			t.Errorf("%v: errors = %+v, want %q", encoding, response.Errors, want)
+		}
+	}
+	response := Build(context.Background(), []byte{0xc1}, shared.EncodingMessagePack)
+	if len(response.Errors) != 1 || !strings.HasPrefix(response.Errors[0].Text, "Failed to parse build request MessagePack: ") {
+		t.Errorf("build errors = %+v", response.Errors)
+	}
+}
@@ -0,0 +1,346 @@
+package runner
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// server is the dev server of a context. esbuild's own server listens on a
+// private loopback port, behind a Go server that adds the features esbuild
+// lacks, such as custom headers.
+type server struct {
+	http *http.Server
+
+	// headers are added to every response.
+	headers map[string]string
+
+	// proxy forwards requests to esbuild's server.
+	proxy *httputil.ReverseProxy
+
+	// upstream receives the requests that esbuild can't answer, if set.
+	upstream *httputil.ReverseProxy
+
+	// liveReload is the live reload event stream, if enabled.
+	liveReload *liveReload
+
+	// servedir is the directory whose files are served, if any.
+	servedir string
+
+	// requests holds the log entries of the requests served, for serve_poll.
+	requests *eventQueue[shared.ServeLogEntry]
+}
+
+// close stops the server and wakes up the callers waiting for log entries.
+// It may be called on a nil server.
+func (s *server) close() {
+	if s != nil {
+		s.http.Close()
+		s.requests.close()
+	}
+}
+
+// ServeHTTP handles a request to the dev server.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	for name, value := range s.headers {
+		w.Header().Set(name, value)
+	}
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	if s.liveReload != nil && r.URL.Path == s.liveReload.path {
+		s.liveReload.ServeHTTP(recorder, r)
+	} else if r.Method == http.MethodOptions && w.Header().Get("Access-Control-Allow-Origin") != "" {
+		// Answer CORS preflight requests, which esbuild rejects.
+		recorder.WriteHeader(http.StatusNoContent)
+	} else if s.upstream != nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		// esbuild only serves files, so anything else goes to the upstream
+		// server directly.
+		s.upstream.ServeHTTP(recorder, r)
+	} else {
+		s.proxy.ServeHTTP(recorder, r)
+	}
+	s.requests.push(shared.ServeLogEntry{
+		RemoteAddress: r.RemoteAddr,
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Status:        recorder.status,
+		TimeMs:        int(time.Since(start).Milliseconds()),
+	})
+}
+
+// statusRecorder remembers the status code of a response for the log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush passes on flushes, which streamed responses rely on.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// errNotFound makes the proxy to esbuild's server hand a request over to the
+// upstream server.
+var errNotFound = errors.New("not found")
+
+// ServeContext starts a dev server for a context. The server rebuilds the
+// context on demand, when a request arrives after its inputs have changed.
+func ServeContext(id uint64, requestData []byte) *shared.ApiResponse {
+	c, err := getContext(id)
+	if err != nil {
+		return shared.NewApiResponse("", []api.Message{{Text: err.Error()}}, nil)
+	}
+	var req shared.ServeRequest
+	if len(requestData) > 0 {
+		if err := json.Unmarshal(requestData, &req); err != nil {
+			return shared.NewApiResponse("", []api.Message{shared.NewRequestError("Failed to parse serve options JSON: " + err.Error())}, nil)
+		}
+	}
+	return c.serve(req)
+}
+
+// DevContext serves a context with live reload and watches it, so that
+// browsers reload as soon as an input changes, like `esbuild --watch
+// --serve` with a live reload script.
+func DevContext(id uint64) *shared.ApiResponse {
+	c, err := getContext(id)
+	if err != nil {
+		return shared.NewApiResponse("", []api.Message{{Text: err.Error()}}, nil)
+	}
+	// Serving first, since injecting the reload client replaces the esbuild
+	// context that the watcher builds.
+	response := c.serve(shared.ServeRequest{LiveReload: true, InjectReloadClient: true})
+	if len(response.Errors) > 0 {
+		return response
+	}
+	if err := c.Watch(); err != nil {
+		c.reset()
+		return shared.NewApiResponse("", []api.Message{{Text: err.Error()}}, nil)
+	}
+	return response
+}
+
+// serve starts the dev server of the context.
+func (c *BuildContext) serve(req shared.ServeRequest) *shared.ApiResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.server != nil {
+		return shared.NewApiResponse("", []api.Message{{Text: "the context is already being served"}}, nil)
+	}
+
+	var upstream *url.URL
+	if req.Proxy != "" {
+		var err error
+		if upstream, err = url.Parse(req.Proxy); err != nil || upstream.Host == "" {
+			return shared.NewApiResponse("", []api.Message{{Text: fmt.Sprintf("invalid proxy URL %q", req.Proxy)}}, nil)
+		}
+	}
+
+	// The certificate is loaded up front, since serving starts in the
+	// background where an error could only leave a dead listener.
+	var tlsConfig *tls.Config
+	if req.Keyfile != "" || req.Certfile != "" {
+		if req.Keyfile == "" || req.Certfile == "" {
+			return shared.NewApiResponse("", []api.Message{{Text: "keyfile and certfile must be set together to serve over HTTPS"}}, nil)
+		}
+		certificate, err := tls.LoadX509KeyPair(req.Certfile, req.Keyfile)
+		if err != nil {
+			return shared.NewApiResponse("", []api.Message{{Text: "invalid keyfile or certfile: " + err.Error()}}, nil)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	}
+
+	listener, info, err := listen(req.Host, req.Port)
+	if err != nil {
+		return shared.NewApiResponse("", []api.Message{{Text: err.Error()}}, nil)
+	}
+	internalPort, err := freePort()
+	if err != nil {
+		listener.Close()
+		return shared.NewApiResponse("", []api.Message{{Text: err.Error()}}, nil)
+	}
+	if req.LiveReload && req.InjectReloadClient {
+		// The banner is a build option, so it takes a new esbuild context.
+		// serve_stop goes back to the original options.
+		buildCtx, ctxErr := api.Context(withReloadClient(c.options, req.LiveReloadPath))
+		if ctxErr != nil {
+			listener.Close()
+			return shared.NewApiResponse("", ctxErr.Errors, nil)
+		}
+		// Disposing waits for a build in progress, which may need the lock.
+		go c.esbuild.Dispose()
+		c.esbuild = buildCtx
+		c.lastInputs = nil
+	}
+	_, err = c.esbuild.Serve(api.ServeOptions{
+		Host:     "127.0.0.1",
+		Port:     internalPort,
+		Servedir: req.Servedir,
+		Fallback: req.Fallback,
+	})
+	if err != nil {
+		listener.Close()
+		return shared.NewApiResponse("", []api.Message{{Text: err.Error()}}, nil)
+	}
+
+	srv := &server{
+		headers: req.Headers,
+		proxy: httputil.NewSingleHostReverseProxy(&url.URL{
+			Scheme: "http",
+			Host:   net.JoinHostPort("127.0.0.1", strconv.Itoa(internalPort)),
+		}),
+		requests: newEventQueue[shared.ServeLogEntry](),
+		servedir: req.Servedir,
+	}
+	if req.LiveReload {
+		srv.liveReload = newLiveReload(req.LiveReloadPath)
+	}
+	if upstream != nil {
+		srv.upstream = httputil.NewSingleHostReverseProxy(upstream)
+		srv.proxy.ModifyResponse = func(resp *http.Response) error {
+			if resp.StatusCode == http.StatusNotFound {
+				return errNotFound
+			}
+			return nil
+		}
+		srv.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			if errors.Is(err, errNotFound) {
+				srv.upstream.ServeHTTP(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}
+	srv.http = &http.Server{Handler: srv, TLSConfig: tlsConfig}
+	go func() {
+		if tlsConfig != nil {
+			srv.http.ServeTLS(listener, "", "")
+		} else {
+			srv.http.Serve(listener)
+		}
+	}()
+	c.server = srv
+
+	response := shared.NewApiResponse("", nil, nil)
+	response.Serve = info
+	return response
+}
+
+// listen opens the listener of a dev server. Like esbuild, it picks the
+// first free port from 8000 if no port is given, and reports the addresses
+// of all interfaces if no host is given.
+func listen(host string, port int) (net.Listener, *shared.ServeInfo, error) {
+	var listener net.Listener
+	var err error
+	if port == 0 {
+		for port = 8000; port < 9000; port++ {
+			if listener, err = net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port))); err == nil {
+				break
+			}
+		}
+	} else {
+		listener, err = net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen for the dev server: %w", err)
+	}
+
+	info := &shared.ServeInfo{Hosts: []string{host}, Port: port}
+	if host == "" {
+		info.Hosts = interfaceHosts()
+	}
+	return listener, info, nil
+}
+
+// interfaceHosts lists the IPv4 addresses of the network interfaces.
+func interfaceHosts() []string {
+	hosts := make([]string, 0)
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			if ip := ipNet.IP.To4(); ip != nil {
+				hosts = append(hosts, ip.String())
+			}
+		}
+	}
+	return hosts
+}
+
+// freePort finds an unused loopback port for esbuild's own server.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// StopServing shuts down a context's dev server. esbuild can only stop its
+// server by disposing the context, so the context is recreated, which makes
+// the next build a cold one. A watcher keeps running and uses the new
+// context.
+func StopServing(id uint64) error {
+	c, err := getContext(id)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	serving := c.server != nil
+	c.mu.Unlock()
+	if !serving {
+		return errors.New("the context is not being served")
+	}
+	return c.reset()
+}
+
+// PollServeLog returns the next log entry of a context's dev server, like
+// eventQueue.Poll.
+func PollServeLog(id uint64, timeout time.Duration) (*shared.ServeLogEntry, error) {
+	c, err := getContext(id)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	srv := c.server
+	c.mu.Unlock()
+	if srv == nil {
+		return nil, errors.New("the context is not being served")
+	}
+	entry, ok := srv.requests.Poll(timeout)
+	if !ok {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// notifyChanged tells the browsers connected to the live reload stream which
+// outputs of a rebuild changed.
+func (s *server) notifyChanged(c *BuildContext, changed []string) {
+	if s == nil || s.liveReload == nil || len(changed) == 0 {
+		return
+	}
+	outputDir := c.options.Outdir
+	if outputDir == "" && c.options.Outfile != "" {
+		outputDir = filepath.Dir(c.options.Outfile)
+	}
+	s.liveReload.notify(outputURLs(changed, s.servedir, c.absPath(outputDir)))
+}
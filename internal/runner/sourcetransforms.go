@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// jsStringPattern matches a JavaScript string literal without
+// substitutions.
+const jsStringPattern = `'(?:[^'\\\n]|\\.)*'|"(?:[^"\\\n]|\\.)*"|` + "`[^`$]*`"
+
+// sourceFilter matches the JavaScript and TypeScript files that source
+// transforms apply to.
+const sourceFilter = `\.[cm]?[jt]sx?$`
+
+// sourceTransform rewrites the source of a JavaScript or TypeScript file
+// before esbuild parses it, returning it unchanged if it doesn't apply. It
+// may add errors, warnings and watched paths to the result of the load.
+type sourceTransform func(source string, file string, result *api.OnLoadResult) string
+
+// sourceTransformsPlugin applies the source transforms of the build options
+// that rewrite code, such as `import.meta.glob`, in a single onLoad hook,
+// since esbuild only runs the first hook that loads a file.
+func sourceTransformsPlugin(transforms []sourceTransform, loaders map[string]string) (api.Plugin, []api.Message) {
+	loaderMap, errors := shared.ParseLoaderMap(loaders)
+	return api.Plugin{
+		Name: "esbuild-py:source-transforms",
+		Setup: func(build api.PluginBuild) {
+			build.OnLoad(api.OnLoadOptions{Filter: sourceFilter, Namespace: "file"}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+				data, err := os.ReadFile(args.Path)
+				if err != nil {
+					// Let esbuild load the file, and report the error.
+					return api.OnLoadResult{}, nil
+				}
+				var result api.OnLoadResult
+				contents := string(data)
+				for _, transform := range transforms {
+					contents = transform(contents, args.Path, &result)
+				}
+				if len(result.Errors) > 0 {
+					return api.OnLoadResult{Errors: result.Errors, Warnings: result.Warnings}, nil
+				}
+				if contents == string(data) && len(result.Warnings) == 0 {
+					return api.OnLoadResult{}, nil
+				}
+				loader, ok := loaderMap[filepath.Ext(args.Path)]
+				if !ok {
+					loader = sourceLoader(args.Path)
+				}
+				result.Contents = &contents
+				result.Loader = loader
+				return result, nil
+			})
+		},
+	}, errors
+}
+
+// sourceLoader picks esbuild's default loader for a JavaScript or
+// TypeScript file.
+func sourceLoader(file string) api.Loader {
+	switch filepath.Ext(file) {
+	case ".ts", ".mts", ".cts":
+		return api.LoaderTS
+	case ".tsx":
+		return api.LoaderTSX
+	case ".jsx":
+		return api.LoaderJSX
+	}
+	return api.LoaderJS
+}
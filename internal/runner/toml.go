@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML decodes a TOML document into maps, slices and scalars that can
+// be encoded as JSON.
+func parseTOML(source string) (map[string]any, error) {
+	table := make(map[string]any)
+	if _, err := toml.Decode(source, &table); err != nil {
+		return nil, err
+	}
+	return tomlJSONCompatible(table).(map[string]any), nil
+}
+
+// tomlJSONCompatible converts the dates and times decoded by the TOML parser
+// to strings, since JSON has no type for them. Local dates and times keep
+// their TOML form, while those with an offset are formatted as RFC 3339.
+func tomlJSONCompatible(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = tomlJSONCompatible(item)
+		}
+	case []map[string]any:
+		for _, item := range v {
+			tomlJSONCompatible(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = tomlJSONCompatible(item)
+		}
+	case time.Time:
+		// The parser marks local dates and times with these zones.
+		switch v.Location().String() {
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999")
+		case "date-local":
+			return v.Format("2006-01-02")
+		case "time-local":
+			return v.Format("15:04:05.999999999")
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return value
+}
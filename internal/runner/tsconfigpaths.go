@@ -0,0 +1,198 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// tsconfigPaths holds the path mappings of a tsconfig file, with baseURL
+// and pathsDir as absolute directories.
+type tsconfigPaths struct {
+	baseURL  string
+	paths    map[string][]string
+	pathsDir string
+}
+
+// skipTsconfigPaths marks the resolutions of mapped paths.
+type skipTsconfigPaths struct{}
+
+// tsconfigPathsPlugin applies the `compilerOptions.paths` and `baseUrl` of a
+// given tsconfig file to all imports, wherever the importing files are.
+// esbuild only applies them to the files that the tsconfig file covers,
+// which isn't enough for monorepos whose packages import each other through
+// aliases.
+func tsconfigPathsPlugin(file string, workingDir string) (api.Plugin, []api.Message) {
+	plugin := api.Plugin{Name: "esbuild-py:tsconfig-paths", Setup: func(api.PluginBuild) {}}
+	if workingDir == "" {
+		workingDir, _ = os.Getwd()
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(workingDir, file)
+	}
+	config, err := readTsconfigPaths(file, 0)
+	if err != nil {
+		return plugin, []api.Message{{Text: fmt.Sprintf("Failed to read tsconfig paths: %v", err)}}
+	}
+
+	plugin.Setup = func(build api.PluginBuild) {
+		resolve := func(path string, args api.OnResolveArgs) (api.OnResolveResult, bool) {
+			resolved := build.Resolve(path, api.ResolveOptions{
+				Importer:   args.Importer,
+				Namespace:  args.Namespace,
+				ResolveDir: args.ResolveDir,
+				Kind:       args.Kind,
+				PluginData: skipTsconfigPaths{},
+				With:       args.With,
+			})
+			return onResolveResult(resolved), len(resolved.Errors) == 0
+		}
+
+		build.OnResolve(api.OnResolveOptions{Filter: ".*"}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+			if _, ok := args.PluginData.(skipTsconfigPaths); ok || isRelativePath(args.Path) || filepath.IsAbs(args.Path) {
+				return api.OnResolveResult{}, nil
+			}
+			for _, candidate := range config.candidates(args.Path) {
+				if result, ok := resolve(candidate, args); ok {
+					return result, nil
+				}
+			}
+			return api.OnResolveResult{}, nil
+		})
+	}
+	return plugin, nil
+}
+
+// candidates lists the paths an import is mapped to, in the order
+// TypeScript tries them: the substitutions of the matching pattern with the
+// longest prefix, then the import relative to baseUrl.
+func (c *tsconfigPaths) candidates(path string) []string {
+	var candidates []string
+	bestPattern, bestPrefix, wildcard := "", -1, ""
+	for pattern := range c.paths {
+		prefix, suffix, hasStar := strings.Cut(pattern, "*")
+		if !hasStar {
+			if pattern == path {
+				bestPattern, bestPrefix, wildcard = pattern, len(pattern)+1, ""
+				break
+			}
+			continue
+		}
+		if len(prefix) > bestPrefix && len(path) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(path, prefix) && strings.HasSuffix(path, suffix) {
+			bestPattern, bestPrefix, wildcard = pattern, len(prefix), path[len(prefix):len(path)-len(suffix)]
+		}
+	}
+	if bestPrefix >= 0 {
+		for _, substitution := range c.paths[bestPattern] {
+			candidates = append(candidates, filepath.Join(c.pathsDir, strings.Replace(substitution, "*", wildcard, 1)))
+		}
+	}
+	if c.baseURL != "" {
+		candidates = append(candidates, filepath.Join(c.baseURL, path))
+	}
+	return candidates
+}
+
+// readTsconfigPaths reads the path mappings of a tsconfig file, following
+// the files it extends by relative path.
+func readTsconfigPaths(file string, depth int) (*tsconfigPaths, error) {
+	if depth > 16 {
+		return nil, fmt.Errorf("too many levels of \"extends\" in %s", file)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var tsconfig struct {
+		Extends         string `json:"extends"`
+		CompilerOptions struct {
+			BaseURL *string             `json:"baseUrl"`
+			Paths   map[string][]string `json:"paths"`
+		} `json:"compilerOptions"`
+	}
+	if err := json.Unmarshal(stripJSONComments(data), &tsconfig); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	config := &tsconfigPaths{}
+	if tsconfig.Extends != "" && (isRelativePath(tsconfig.Extends) || filepath.IsAbs(tsconfig.Extends)) {
+		parent := tsconfig.Extends
+		if !filepath.IsAbs(parent) {
+			parent = filepath.Join(filepath.Dir(file), parent)
+		}
+		if !strings.HasSuffix(parent, ".json") {
+			parent += ".json"
+		}
+		if config, err = readTsconfigPaths(parent, depth+1); err != nil {
+			return nil, err
+		}
+	}
+
+	dir := filepath.Dir(file)
+	if tsconfig.CompilerOptions.BaseURL != nil {
+		config.baseURL = filepath.Join(dir, *tsconfig.CompilerOptions.BaseURL)
+	}
+	if tsconfig.CompilerOptions.Paths != nil {
+		// Paths are relative to baseUrl, or to the file that declares them
+		// if there is none.
+		config.paths = tsconfig.CompilerOptions.Paths
+		config.pathsDir = config.baseURL
+		if config.pathsDir == "" {
+			config.pathsDir = dir
+		}
+	}
+	return config, nil
+}
+
+// stripJSONComments removes the comments and trailing commas that tsconfig
+// files may contain, which encoding/json rejects.
+func stripJSONComments(data []byte) []byte {
+	var out []byte
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out = append(out, c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out = append(out, data[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			out = append(out, '\n')
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			i += 2
+			for i+1 < len(data) && !(data[i] == '*' && data[i+1] == '/') {
+				i++
+			}
+			i++
+		case c == '}' || c == ']':
+			// Drop a comma that only whitespace separates from the end of
+			// the object or array.
+			j := len(out) - 1
+			for j >= 0 && strings.IndexByte(" \t\r\n", out[j]) >= 0 {
+				j--
+			}
+			if j >= 0 && out[j] == ',' {
+				out = append(out[:j], out[j+1:]...)
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,145 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// virtualNamespace is the default namespace of the modules served from
+// memory.
+const virtualNamespace = "virtual"
+
+// virtualFile is a module served from memory.
+type virtualFile struct {
+	contents   string
+	loader     api.Loader
+	namespace  string
+	resolveDir string
+}
+
+// virtualFilesPlugin serves the `virtualFiles` of a build request. A module
+// is imported by its exact path, or, if the path is absolute, by a relative
+// path from a module in the same directory tree, which may be another
+// virtual file. Like files on disk, the imports of a module with an absolute
+// path are resolved from its directory.
+func virtualFilesPlugin(files map[string]shared.VirtualFileRequest) (api.Plugin, []api.Message) {
+	var errors []api.Message
+	virtualFiles := make(map[string]virtualFile, len(files))
+	namespaces := make(map[string]bool)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := files[name]
+		loaderName := file.Loader
+		if loaderName == "" {
+			loaderName = defaultVirtualLoader(name)
+		}
+		loader, msg := shared.ParseLoader(loaderName)
+		if msg != nil {
+			msg.Text += fmt.Sprintf(" for virtual file %q", name)
+			errors = append(errors, *msg)
+			continue
+		}
+		namespace := file.Namespace
+		if namespace == "" {
+			namespace = virtualNamespace
+		}
+		resolveDir := file.ResolveDir
+		if resolveDir == "" && filepath.IsAbs(name) {
+			resolveDir = filepath.Dir(name)
+		}
+		virtualFiles[name] = virtualFile{
+			contents:   file.Contents,
+			loader:     loader,
+			namespace:  namespace,
+			resolveDir: resolveDir,
+		}
+		namespaces[namespace] = true
+	}
+
+	return api.Plugin{
+		Name: "esbuild-py:virtual-files",
+		Setup: func(build api.PluginBuild) {
+			build.OnResolve(api.OnResolveOptions{Filter: ".*"}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				name := args.Path
+				if _, ok := virtualFiles[name]; !ok && isRelativePath(name) && args.ResolveDir != "" {
+					name = filepath.Join(args.ResolveDir, name)
+				}
+				file, ok := virtualFiles[name]
+				if !ok && isRelativePath(args.Path) && args.ResolveDir != "" && !isDir(args.ResolveDir) {
+					// esbuild can't resolve anything from a directory that
+					// doesn't exist, which is often the case for virtual
+					// files, so the path is resolved from the nearest
+					// directory that does instead.
+					dir := args.ResolveDir
+					for !isDir(dir) && filepath.Dir(dir) != dir {
+						dir = filepath.Dir(dir)
+					}
+					rel, err := filepath.Rel(dir, name)
+					if err != nil {
+						return api.OnResolveResult{}, nil
+					}
+					resolved := build.Resolve("./"+filepath.ToSlash(rel), api.ResolveOptions{
+						Importer:   args.Importer,
+						Namespace:  args.Namespace,
+						ResolveDir: dir,
+						Kind:       args.Kind,
+						PluginData: args.PluginData,
+						With:       args.With,
+					})
+					if len(resolved.Errors) > 0 {
+						// Let esbuild report the original path.
+						return api.OnResolveResult{}, nil
+					}
+					return onResolveResult(resolved), nil
+				}
+				if !ok {
+					return api.OnResolveResult{}, nil
+				}
+				return api.OnResolveResult{Path: name, Namespace: file.namespace}, nil
+			})
+			for namespace := range namespaces {
+				build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: namespace}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+					file, ok := virtualFiles[args.Path]
+					if !ok || file.namespace != args.Namespace {
+						return api.OnLoadResult{}, nil
+					}
+					return api.OnLoadResult{
+						Contents:   &file.contents,
+						Loader:     file.loader,
+						ResolveDir: file.resolveDir,
+					}, nil
+				})
+			}
+		},
+	}, errors
+}
+
+// defaultVirtualLoader picks the loader named after the extension of a
+// virtual file, if there is one, as esbuild does for files on disk.
+func defaultVirtualLoader(name string) string {
+	ext := strings.TrimPrefix(path.Ext(name), ".")
+	if _, msg := shared.ParseLoader(ext); ext != "" && msg == nil {
+		return ext
+	}
+	return "js"
+}
+
+func isRelativePath(path string) bool {
+	return strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// wasmAssetNamespace is the namespace of the WebAssembly files emitted as
+// assets by the "wasm" loader.
+const wasmAssetNamespace = "wasm-asset"
+
+// wasmLoader imports a WebAssembly file as a module whose default export
+// instantiates it, given its imports, while the file itself is emitted as
+// an asset whose URL is exported as `url`. Node builds read the file from
+// disk, and others fetch it, relative to the bundle in ES modules and to
+// the page otherwise.
+func wasmLoader(source string, file string, options *api.BuildOptions) (string, api.Loader, error) {
+	location := "url"
+	if options.Format == api.FormatESModule {
+		location = "new URL(url, import.meta.url)"
+	}
+	load := "(await fetch(" + location + ")).arrayBuffer()"
+	if options.Platform == api.PlatformNode {
+		if options.Format != api.FormatESModule {
+			location = `require("node:path").join(__dirname, url)`
+		}
+		load = `(await import("node:fs/promises")).readFile(` + location + `)`
+	}
+
+	var b strings.Builder
+	b.WriteString("import url from " + strconv.Quote(file+"?"+wasmAssetNamespace) + ";\n")
+	b.WriteString("export { url };\n")
+	b.WriteString("export default async function init(imports = {}) {\n")
+	b.WriteString("  const bytes = await " + load + ";\n")
+	b.WriteString("  const { instance } = await WebAssembly.instantiate(bytes, imports);\n")
+	b.WriteString("  return instance;\n")
+	b.WriteString("}\n")
+	return b.String(), api.LoaderJS, nil
+}
+
+// setupWasmAssets emits the WebAssembly files imported by the modules of
+// the "wasm" loader as assets.
+func setupWasmAssets(build api.PluginBuild) {
+	build.OnResolve(api.OnResolveOptions{Filter: `\?` + wasmAssetNamespace + `$`}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+		return api.OnResolveResult{
+			Path:      strings.TrimSuffix(args.Path, "?"+wasmAssetNamespace),
+			Namespace: wasmAssetNamespace,
+		}, nil
+	})
+	build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: wasmAssetNamespace}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+		data, err := os.ReadFile(args.Path)
+		if err != nil {
+			return api.OnLoadResult{}, err
+		}
+		contents := string(data)
+		return api.OnLoadResult{Contents: &contents, Loader: api.LoaderFile, WatchFiles: []string{args.Path}}, nil
+	})
+}
@@ -0,0 +1,358 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/fsnotify/fsnotify"
+	"github.com/keller-mark/esbuild-py/internal/shared"
+)
+
+// defaultPollInterval is how often watched files are checked for changes
+// when polling, unless the context sets `pollIntervalMs`.
+const defaultPollInterval = 250 * time.Millisecond
+
+// watcher rebuilds a context whenever one of the inputs of its last build
+// changes. esbuild has its own watch mode, but it can't be stopped without
+// disposing the context and doesn't report which files changed, so the
+// inputs are watched here instead.
+type watcher struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	events *eventQueue[shared.WatchEvent]
+}
+
+// fileStamp is the state of a watched file when it was last checked.
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// Watch starts rebuilding the context whenever its inputs change, after an
+// initial build.
+func (c *BuildContext) Watch() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.watcher != nil {
+		return errors.New("the context is already being watched")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &watcher{cancel: cancel, done: make(chan struct{}), events: newEventQueue[shared.WatchEvent]()}
+	c.watcher = w
+	go c.watch(ctx, w)
+	return nil
+}
+
+// Unwatch stops watching the context, cancelling a rebuild in progress.
+func (c *BuildContext) Unwatch() error {
+	c.mu.Lock()
+	w := c.watcher
+	c.watcher = nil
+	c.mu.Unlock()
+	if w == nil {
+		return errors.New("the context is not being watched")
+	}
+	w.cancel()
+	<-w.done
+	return nil
+}
+
+// WatchContext starts watching an existing context.
+func WatchContext(id uint64) error {
+	c, err := getContext(id)
+	if err != nil {
+		return err
+	}
+	return c.Watch()
+}
+
+// UnwatchContext stops watching an existing context.
+func UnwatchContext(id uint64) error {
+	c, err := getContext(id)
+	if err != nil {
+		return err
+	}
+	return c.Unwatch()
+}
+
+var (
+	watchHandlerMu sync.Mutex
+	watchHandler   func(id uint64, event shared.WatchEvent)
+)
+
+// SetWatchHandler registers a function that receives the rebuild events of
+// all watched contexts. Events delivered this way aren't queued for
+// PollWatchEvent. Passing nil restores queueing for later events.
+func SetWatchHandler(handler func(id uint64, event shared.WatchEvent)) {
+	watchHandlerMu.Lock()
+	defer watchHandlerMu.Unlock()
+	watchHandler = handler
+}
+
+// PollWatchEvent returns the next rebuild event of a watched context, like
+// eventQueue.Poll.
+func PollWatchEvent(id uint64, timeout time.Duration) (*shared.WatchEvent, error) {
+	c, err := getContext(id)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	w := c.watcher
+	c.mu.Unlock()
+	if w == nil {
+		return nil, errors.New("the context is not being watched")
+	}
+	event, ok := w.events.Poll(timeout)
+	if !ok {
+		return nil, nil
+	}
+	return &event, nil
+}
+
+func (c *BuildContext) watch(ctx context.Context, w *watcher) {
+	defer close(w.done)
+	defer w.events.close()
+
+	deliver := func(event shared.WatchEvent) {
+		watchHandlerMu.Lock()
+		handler := watchHandler
+		watchHandlerMu.Unlock()
+		if handler != nil {
+			handler(c.ID, event)
+		} else {
+			w.events.push(event)
+		}
+	}
+	// A panic ends the watch with a failed event instead of crashing the
+	// whole Python process, since nothing else recovers it on this
+	// goroutine.
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			deliver(shared.WatchEvent{
+				ChangedFiles:   make([]string, 0),
+				ChangedOutputs: make([]string, 0),
+				Errors:         shared.NewPanicResponse(recovered, debug.Stack()).Errors,
+				Warnings:       make([]shared.Message, 0),
+			})
+		}
+	}()
+
+	var outputs map[string]string
+	watchRebuild := func(changedFiles []string) api.BuildResult {
+		start := time.Now()
+		response, result := c.rebuild(ctx)
+		if ctx.Err() != nil {
+			// Watching stopped during the build.
+			return result
+		}
+		var changed []string
+		changed, outputs = changedOutputs(result.OutputFiles, outputs)
+		event := shared.WatchEvent{
+			Success:        len(response.Errors) == 0,
+			DurationMs:     time.Since(start).Milliseconds(),
+			ChangedFiles:   changedFiles,
+			ChangedOutputs: changed,
+			Errors:         response.Errors,
+			Warnings:       response.Warnings,
+		}
+		deliver(event)
+		return result
+	}
+
+	var settings shared.WatchRequest
+	if c.request.Watch != nil {
+		settings = *c.request.Watch
+	}
+
+	// Changes are detected by comparing the state of the inputs, which is
+	// checked either periodically or when a notification arrives for the
+	// directory of an input.
+	var notify *fsnotify.Watcher
+	if !settings.UsePolling {
+		var err error
+		if notify, err = fsnotify.NewWatcher(); err != nil {
+			notify = nil
+		} else {
+			defer notify.Close()
+		}
+	}
+	var tick <-chan time.Time
+	var events <-chan fsnotify.Event
+	var notifyErrors <-chan error
+	if notify != nil {
+		events = notify.Events
+		notifyErrors = notify.Errors
+	} else {
+		interval := defaultPollInterval
+		if settings.PollIntervalMs > 0 {
+			interval = time.Duration(settings.PollIntervalMs) * time.Millisecond
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	stamps := c.stampInputs(watchRebuild(make([]string, 0)), nil)
+	dirs := watchDirs(notify, stamps, nil)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case event := <-events:
+			if _, ok := stamps[event.Name]; !ok {
+				continue
+			}
+		case <-notifyErrors:
+			continue
+		}
+		if settings.DebounceMs > 0 {
+			timer := time.NewTimer(time.Duration(settings.DebounceMs) * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		changed, current := changedFiles(stamps)
+		if len(changed) == 0 {
+			continue
+		}
+		stamps = c.stampInputs(watchRebuild(changed), current)
+		dirs = watchDirs(notify, stamps, dirs)
+	}
+}
+
+// watchDirs registers the directories of the watched files for
+// notifications, and unregisters those that are no longer needed. It returns
+// the registered directories.
+func watchDirs(notify *fsnotify.Watcher, stamps map[string]fileStamp, previous map[string]bool) map[string]bool {
+	if notify == nil {
+		return nil
+	}
+	dirs := make(map[string]bool)
+	for path := range stamps {
+		dirs[filepath.Dir(path)] = true
+	}
+	for dir := range previous {
+		if !dirs[dir] {
+			notify.Remove(dir)
+		}
+	}
+	for dir := range dirs {
+		if !previous[dir] {
+			if err := notify.Add(dir); err != nil {
+				delete(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// stampInputs records the state of the inputs of a build. Files that were
+// already watched keep their state from before the build, so that changes
+// made during the build trigger another one. A failed build may not report
+// all of its inputs, so the files of the previous build and those mentioned
+// in errors are kept watched until a build succeeds again.
+func (c *BuildContext) stampInputs(result api.BuildResult, previous map[string]fileStamp) map[string]fileStamp {
+	paths := c.inputPaths(result)
+	if len(result.Errors) > 0 {
+		for path := range previous {
+			paths = append(paths, path)
+		}
+		for _, msg := range result.Errors {
+			if msg.Location != nil {
+				paths = append(paths, c.absPath(msg.Location.File))
+			}
+		}
+	}
+
+	stamps := make(map[string]fileStamp, len(paths))
+	for _, path := range paths {
+		if stamp, ok := previous[path]; ok {
+			stamps[path] = stamp
+		} else {
+			stamps[path] = stampFile(path)
+		}
+	}
+	return stamps
+}
+
+// inputPaths returns the absolute paths of the inputs listed in the metafile
+// of a build.
+func (c *BuildContext) inputPaths(result api.BuildResult) []string {
+	if result.Metafile == "" {
+		return nil
+	}
+	var metafile struct {
+		Inputs map[string]json.RawMessage `json:"inputs"`
+	}
+	if err := json.Unmarshal([]byte(result.Metafile), &metafile); err != nil {
+		return nil
+	}
+	paths := make([]string, 0, len(metafile.Inputs))
+	for path := range metafile.Inputs {
+		paths = append(paths, c.absPath(path))
+	}
+	return paths
+}
+
+// absPath resolves a path reported by esbuild, which is relative to the
+// working directory of the build.
+func (c *BuildContext) absPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	baseDir := c.options.AbsWorkingDir
+	if baseDir == "" {
+		baseDir, _ = os.Getwd()
+	}
+	return filepath.Join(baseDir, path)
+}
+
+func stampFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// changedFiles returns the watched files whose state differs from stamps,
+// along with their current state.
+func changedFiles(stamps map[string]fileStamp) ([]string, map[string]fileStamp) {
+	var changed []string
+	current := make(map[string]fileStamp, len(stamps))
+	for path, stamp := range stamps {
+		current[path] = stampFile(path)
+		if current[path] != stamp {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed, current
+}
+
+// changedOutputs compares the hashes of a build's output files with those of
+// the previous build, returning the paths that changed and the new hashes.
+func changedOutputs(files []api.OutputFile, previous map[string]string) ([]string, map[string]string) {
+	changed := make([]string, 0)
+	hashes := make(map[string]string, len(files))
+	for _, file := range files {
+		hashes[file.Path] = file.Hash
+		if previous[file.Path] != file.Hash {
+			changed = append(changed, file.Path)
+		}
+	}
+	return changed, hashes
+}
@@ -0,0 +1,176 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+var (
+	// workerRe matches the creation of a web worker whose script is given
+	// relative to the module, the way bundlers recognize workers.
+	workerRe = regexp.MustCompile(`\bnew\s+(?:Worker|SharedWorker)\s*\(\s*new\s+URL\s*\(\s*(` + jsStringPattern + `)\s*,\s*import\.meta\.url\s*\)`)
+
+	// workerOptionsRe matches the options following the URL of a worker,
+	// which tell whether it's a module worker.
+	workerOptionsRe = regexp.MustCompile(`^\s*,\s*(\{[^{}]*\})`)
+	workerModuleRe  = regexp.MustCompile(`\btype\s*:\s*['"]module['"]`)
+)
+
+// workerNamespaces map the import suffixes of worker scripts to the
+// namespace and format of their bundles.
+var workerNamespaces = map[string]api.Format{
+	"worker":        api.FormatIIFE,
+	"module-worker": api.FormatESModule,
+}
+
+// skipWorkers marks the resolutions of the scripts of workers.
+type skipWorkers struct{}
+
+// workersTransform replaces the URL of the script of each web worker with
+// the URL of its bundle, which is imported with a `?worker` suffix (or
+// `?module-worker` for module workers) for workersPlugin to build it.
+func workersTransform(source string, file string, result *api.OnLoadResult) string {
+	if !strings.Contains(source, "Worker") {
+		return source
+	}
+	var out strings.Builder
+	var imports strings.Builder
+	last := 0
+	for index, match := range workerRe.FindAllStringSubmatchIndex(source, -1) {
+		specifier := jsStringValue(source[match[2]:match[3]])
+		if !isRelativePath(specifier) && !strings.HasPrefix(specifier, "/") {
+			continue
+		}
+		suffix := "?worker"
+		if m := workerOptionsRe.FindStringSubmatch(source[match[1]:]); m != nil && workerModuleRe.MatchString(m[1]) {
+			suffix = "?module-worker"
+		}
+		local := fmt.Sprintf("__worker_%d", index)
+		fmt.Fprintf(&imports, "\nimport %s from %s;", local, strconv.Quote(specifier+suffix))
+		out.WriteString(source[last:match[2]])
+		out.WriteString(local)
+		last = match[3]
+	}
+	if last == 0 {
+		return source
+	}
+	out.WriteString(source[last:])
+	out.WriteString(imports.String())
+	return out.String()
+}
+
+// workersPlugin bundles the scripts of the web workers found by
+// workersTransform with the options of the build, and emits each bundle as
+// an asset, whose URL replaces that of the script.
+func workersPlugin() (api.Plugin, []api.Message) {
+	return api.Plugin{
+		Name: "esbuild-py:workers",
+		Setup: func(build api.PluginBuild) {
+			build.OnResolve(api.OnResolveOptions{Filter: `\?(module-)?worker$`}, func(args api.OnResolveArgs) (api.OnResolveResult, error) {
+				if _, ok := args.PluginData.(skipWorkers); ok {
+					return api.OnResolveResult{}, nil
+				}
+				suffix := args.Path[strings.LastIndexByte(args.Path, '?'):]
+				resolved := build.Resolve(strings.TrimSuffix(args.Path, suffix), api.ResolveOptions{
+					Importer:   args.Importer,
+					Namespace:  args.Namespace,
+					ResolveDir: args.ResolveDir,
+					Kind:       api.ResolveEntryPoint,
+					PluginData: skipWorkers{},
+				})
+				if len(resolved.Errors) > 0 || resolved.External || resolved.Namespace != "file" {
+					return onResolveResult(resolved), nil
+				}
+				// The bundle is named after the script, with a `.js`
+				// extension, while the script's path is kept as plugin data.
+				return api.OnResolveResult{
+					Path:       strings.TrimSuffix(resolved.Path, filepath.Ext(resolved.Path)) + ".js",
+					Namespace:  suffix[1:],
+					PluginData: resolved.Path,
+				}, nil
+			})
+			for namespace, format := range workerNamespaces {
+				build.OnLoad(api.OnLoadOptions{Filter: ".*", Namespace: namespace}, func(args api.OnLoadArgs) (api.OnLoadResult, error) {
+					entry, ok := args.PluginData.(string)
+					if !ok {
+						return api.OnLoadResult{}, fmt.Errorf("The script of the worker %s is unknown", args.Path)
+					}
+					return buildWorker(*build.InitialOptions, entry, format)
+				})
+			}
+		},
+	}, nil
+}
+
+// buildWorker bundles the script of a worker with the options of the build
+// that creates it. Source maps of the worker are inlined, since the bundle
+// is emitted as a single asset.
+func buildWorker(options api.BuildOptions, entry string, format api.Format) (api.OnLoadResult, error) {
+	options.EntryPoints = []string{entry}
+	options.EntryPointsAdvanced = nil
+	options.Stdin = nil
+	options.Outfile = ""
+	options.Outbase = ""
+	// Nothing is written, but an output directory names the output files.
+	options.Outdir = filepath.Dir(entry)
+	options.EntryNames = "[name]"
+	options.Write = false
+	options.Bundle = true
+	options.Splitting = false
+	options.Metafile = true
+	options.Format = format
+	if options.Sourcemap != api.SourceMapNone {
+		options.Sourcemap = api.SourceMapInline
+	}
+
+	result := api.Build(options)
+	if len(result.Errors) > 0 {
+		return api.OnLoadResult{Errors: result.Errors, Warnings: result.Warnings}, nil
+	}
+	var contents string
+	for _, file := range result.OutputFiles {
+		if filepath.Ext(file.Path) == ".js" {
+			contents = string(file.Contents)
+			break
+		}
+	}
+	return api.OnLoadResult{
+		Contents:   &contents,
+		Loader:     api.LoaderFile,
+		Warnings:   result.Warnings,
+		WatchFiles: metafileInputs(result.Metafile, options.AbsWorkingDir),
+	}, nil
+}
+
+// metafileInputs returns the absolute paths of the files listed as inputs
+// in a metafile.
+func metafileInputs(metafile string, workingDir string) []string {
+	var parsed struct {
+		Inputs map[string]json.RawMessage `json:"inputs"`
+	}
+	if err := json.Unmarshal([]byte(metafile), &parsed); err != nil {
+		return nil
+	}
+	if workingDir == "" {
+		workingDir, _ = os.Getwd()
+	}
+	var files []string
+	for input := range parsed.Inputs {
+		// Inputs from other namespaces are prefixed with their namespace.
+		if strings.Contains(input, ":") && !filepath.IsAbs(input) {
+			continue
+		}
+		if !filepath.IsAbs(input) {
+			input = filepath.Join(workingDir, input)
+		}
+		files = append(files, input)
+	}
+	return files
+}
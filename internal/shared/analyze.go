@@ -0,0 +1,32 @@
+package shared
+
+import (
+	"encoding/json"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// AnalyzeMetafileRequest is the JSON request of the analyze_metafile export.
+type AnalyzeMetafileRequest struct {
+	// Metafile is the metafile of a build, either as a JSON string or as an
+	// object.
+	Metafile json.RawMessage `json:"metafile"`
+
+	Verbose bool `json:"verbose"`
+	Color   bool `json:"color"`
+}
+
+// AnalyzeMetafile describes the outputs of a build and the inputs making
+// them up, largest first, as `esbuild --analyze` prints it.
+func AnalyzeMetafile(req AnalyzeMetafileRequest) *ApiResponse {
+	metafile := rawJSONToString(req.Metafile)
+	if !json.Valid([]byte(metafile)) {
+		return NewApiResponse("", []api.Message{{Text: "The metafile is not valid JSON"}}, nil)
+	}
+	response := NewApiResponse("", nil, nil)
+	response.Analysis = api.AnalyzeMetafile(metafile, api.AnalyzeMetafileOptions{
+		Verbose: req.Verbose,
+		Color:   req.Color,
+	})
+	return response
+}
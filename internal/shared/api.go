@@ -1,65 +1,235 @@
 package shared
 
-import "github.com/evanw/esbuild/pkg/api"
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// ProtocolVersion identifies the calling convention and request/response
+// format of the bindings. It must be incremented whenever a change would make
+// an older Python wrapper misbehave with a newer library, or vice versa, in
+// the same commit as that change and along with `PROTOCOL_VERSION` in
+// src/esbuild_py/_native_backend.py, which TestProtocolVersion checks.
+//
+//  1. The first versioned protocol.
+//  2. Messages are serialized with camelCase keys.
+//  3. Setting a callback returns a status.
+//  4. The `shutdown` export is renamed to `esbuild_shutdown`.
+const ProtocolVersion = 4
 
 // ApiResponse defines the universal response structure for all API calls.
 // It's designed to be safely serialized to JSON, ensuring that slices are
 // never null.
 type ApiResponse struct {
-	Code     string        `json:"code,omitempty"`
-	Errors   []api.Message `json:"errors"`
-	Warnings []api.Message `json:"warnings"`
+	Code     string    `json:"code,omitempty"`
+	Errors   []Message `json:"errors"`
+	Warnings []Message `json:"warnings"`
+
+	// EntryPoints lists the entry points of a build after glob patterns
+	// have been expanded.
+	EntryPoints []string `json:"entryPoints,omitempty"`
+
+	// Bundles maps the entry points of a build to their JS and CSS
+	// outputs.
+	Bundles map[string]EntryBundle `json:"bundles,omitempty"`
+
+	// Manifest maps the logical names of the outputs of a build to their
+	// hashed paths, relative to the output directory.
+	Manifest map[string]string `json:"manifest,omitempty"`
+
+	// Integrity maps the output files of a build, by path relative to the
+	// working directory, to their Subresource Integrity strings.
+	Integrity map[string]string `json:"integrity,omitempty"`
+
+	// Sizes maps the output files of a build, by path relative to the
+	// working directory, to their raw and compressed sizes.
+	Sizes map[string]OutputSize `json:"sizes,omitempty"`
+
+	// CSSModules maps the CSS modules of a build, by path relative to the
+	// working directory, to their scoped class names, by local name.
+	CSSModules map[string]map[string]string `json:"cssModules,omitempty"`
+
+	// Metafile describes the inputs and outputs of a build, as JSON, when
+	// the request asks for it.
+	Metafile string `json:"metafile,omitempty"`
+
+	// Graph maps the modules of a build, by path relative to the working
+	// directory, to their sizes and imports.
+	Graph map[string]GraphNode `json:"graph,omitempty"`
+
+	// Report holds the analyses of the module graph of a build.
+	Report *BuildReport `json:"report,omitempty"`
+
+	// TopModules maps the outputs of a build to their largest inputs.
+	TopModules map[string][]ModuleSize `json:"topModules,omitempty"`
+
+	// Analysis is the human-readable breakdown of a metafile returned by
+	// analyze_metafile.
+	Analysis string `json:"analysis,omitempty"`
+
+	// Timings breaks down the time taken by a build or transform.
+	Timings *Timings `json:"timings,omitempty"`
+
+	// Formatted holds the messages rendered by format_messages.
+	Formatted []string `json:"formatted,omitempty"`
+
+	// Stats describes the work done by a rebuild of a context.
+	Stats *RebuildStats `json:"stats,omitempty"`
+
+	// Serve describes the dev server started by context_serve.
+	Serve *ServeInfo `json:"serve,omitempty"`
+
+	// Context is the handle of a newly created build context.
+	Context uint64 `json:"context,omitempty"`
+
+	// Kind classifies a failed call. It is empty for regular esbuild errors,
+	// "internal" when the bindings themselves failed, "cancelled" when the
+	// operation was cancelled and "timeout" when it exceeded its timeout.
+	Kind string `json:"kind,omitempty"`
+
+	// Stack holds the Go stack trace of an internal error.
+	Stack string `json:"stack,omitempty"`
+
+	// OutputFiles holds the files produced by a build when `write` is
+	// disabled, including any source maps next to their JS/CSS outputs.
+	OutputFiles []OutputFile `json:"outputFiles,omitempty"`
+}
+
+// Timings breaks down the wall time of an operation, in milliseconds.
+// esbuild doesn't report the time spent in each of its own phases, such as
+// parsing, linking and writing the outputs, so they are all in EsbuildMs.
+type Timings struct {
+	// ValidateMs is the time spent checking and converting the options.
+	ValidateMs float64 `json:"validateMs"`
+
+	// QueueMs is the time spent waiting for one of the operations allowed
+	// to run at the same time to finish.
+	QueueMs float64 `json:"queueMs"`
+
+	EsbuildMs float64 `json:"esbuildMs"`
+
+	// ProcessMs is the time spent on the outputs of a build after esbuild,
+	// e.g. to compress them or to write a manifest.
+	ProcessMs float64 `json:"processMs,omitempty"`
+
+	TotalMs float64 `json:"totalMs"`
+}
+
+// RebuildStats holds the metrics of a single rebuild of a context, for
+// tracking the performance of incremental builds.
+type RebuildStats struct {
+	DurationMs int64 `json:"durationMs"`
+
+	// ModulesParsed counts the inputs that were new or had changed since the
+	// previous build, which esbuild had to parse again.
+	ModulesParsed int `json:"modulesParsed"`
+
+	// OutputsWritten counts the output files whose contents changed.
+	OutputsWritten int `json:"outputsWritten"`
+}
+
+// OutputFile describes a single file produced by a build.
+type OutputFile struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+	Text string `json:"text"`
+}
+
+// NewOutputFiles converts esbuild's output files into their JSON form.
+func NewOutputFiles(files []api.OutputFile) []OutputFile {
+	outputFiles := make([]OutputFile, 0, len(files))
+	for _, file := range files {
+		outputFiles = append(outputFiles, OutputFile{
+			Path: file.Path,
+			Hash: file.Hash,
+			Text: string(file.Contents),
+		})
+	}
+	return outputFiles
 }
 
 // NewApiResponse is a factory function that creates a well-formed ApiResponse
 // from the results of an esbuild API call.
-// It guarantees that the Errors and Warnings slices are never nil, which
-// prevents them from being serialized to `null` in JSON.
+// The messages are converted to their JSON shape, whose slices are never
+// nil, which prevents them from being serialized to `null` in JSON.
 func NewApiResponse(code string, errors []api.Message, warnings []api.Message) *ApiResponse {
-	resp := &ApiResponse{
+	return &ApiResponse{
 		Code:     code,
-		Errors:   errors,
-		Warnings: warnings,
+		Errors:   NewMessages(errors),
+		Warnings: NewMessages(warnings),
 	}
+}
 
-	// Ensure we always return an empty slice `[]` instead of `null` for JSON.
-	if resp.Errors == nil {
-		resp.Errors = make([]api.Message, 0)
-	}
-	if resp.Warnings == nil {
-		resp.Warnings = make([]api.Message, 0)
+// KindInternal marks responses for failures inside the bindings, such as a
+// recovered panic, as opposed to errors reported by esbuild.
+const KindInternal = "internal"
+
+// KindCancelled marks responses for operations that were cancelled before
+// they completed.
+const KindCancelled = "cancelled"
+
+// KindTimeout marks responses for operations that exceeded their
+// `timeoutMs`.
+const KindTimeout = "timeout"
+
+// NewCancelledResponse creates the response for an operation that was
+// stopped because its context was cancelled or its deadline passed. The kind
+// of the response is also the ID of its error.
+func NewCancelledResponse(err error, warnings []api.Message) *ApiResponse {
+	if errors.Is(err, context.DeadlineExceeded) {
+		resp := NewApiResponse("", []api.Message{{ID: KindTimeout, Text: "The operation timed out"}}, warnings)
+		resp.Kind = KindTimeout
+		return resp
 	}
+	resp := NewApiResponse("", []api.Message{{ID: KindCancelled, Text: "The operation was cancelled: " + err.Error()}}, warnings)
+	resp.Kind = KindCancelled
+	return resp
+}
 
+// NewPanicResponse creates the response for a panic recovered in one of the
+// exported functions, so that Python receives an error instead of the whole
+// interpreter crashing.
+func NewPanicResponse(recovered any, stack []byte) *ApiResponse {
+	resp := NewApiResponse("", []api.Message{{ID: KindInternal, Text: fmt.Sprintf("Internal error in esbuild-py: %v", recovered)}}, nil)
+	resp.Kind = KindInternal
+	resp.Stack = string(stack)
 	return resp
 }
 
-func MapStringToLoader(loaderStr string) api.Loader {
-	switch loaderStr {
-	case "js":
-		return api.LoaderJS
-	case "jsx":
-		return api.LoaderJSX
-	case "ts":
-		return api.LoaderTS
-	case "tsx":
-		return api.LoaderTSX
-	case "css":
-		return api.LoaderCSS
-	case "json":
-		return api.LoaderJSON
-	case "text":
-		return api.LoaderText
-	case "base64":
-		return api.LoaderBase64
-	case "dataurl":
-		return api.LoaderDataURL
-	case "file":
-		return api.LoaderFile
-	case "binary":
-		return api.LoaderBinary
-	default:
-		// Fallback to JS if an unknown loader is provided.
-		// esbuild will likely error out, which is the desired behavior.
-		return api.LoaderJS
+// FilterMessages drops the messages that the caller asked not to receive.
+// esbuild itself only uses the log level and limit to decide what to print
+// to stderr, so they are applied to the response here as well. Errors are
+// always kept, since they indicate that the call failed. The log overrides
+// are applied again for the warnings of the bindings themselves, such as
+// "unknown-option", which esbuild doesn't know about: as in esbuild, a
+// warning overridden to "error" becomes an error, and one overridden to
+// "silent", "info", "debug" or "verbose" is dropped, since responses only
+// carry errors and warnings.
+func (r *ApiResponse) FilterMessages(logLevel string, logLimit int, logOverride map[string]string) {
+	hideWarnings := logLevel == "silent" || logLevel == "error"
+	warnings := make([]Message, 0, len(r.Warnings))
+	for _, msg := range r.Warnings {
+		switch logOverride[msg.ID] {
+		case "error":
+			r.Errors = append(r.Errors, msg)
+		case "silent", "info", "debug", "verbose":
+		default:
+			if !hideWarnings {
+				warnings = append(warnings, msg)
+			}
+		}
+	}
+	r.Warnings = warnings
+	if logLimit > 0 {
+		if len(r.Errors) > logLimit {
+			r.Errors = r.Errors[:logLimit]
+		}
+		remaining := logLimit - len(r.Errors)
+		if len(r.Warnings) > remaining {
+			r.Warnings = r.Warnings[:remaining]
+		}
 	}
 }
@@ -0,0 +1,71 @@
+package shared
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// TestProtocolVersion checks that the Python wrapper expects the protocol
+// version of the library.
+func TestProtocolVersion(t *testing.T) {
+	source, err := os.ReadFile("../../src/esbuild_py/_native_backend.py")
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := regexp.MustCompile(`(?m)^PROTOCOL_VERSION = (\d+)$`).FindSubmatch(source)
+	if match == nil {
+		t.Fatal("PROTOCOL_VERSION isn't set in _native_backend.py")
+	}
+	if version, _ := strconv.Atoi(string(match[1])); version != ProtocolVersion {
+		t.Errorf("PROTOCOL_VERSION = %d in _native_backend.py, but ProtocolVersion = %d", version, ProtocolVersion)
+	}
+}
+
+func TestFilterMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		logLevel    string
+		logLimit    int
+		logOverride map[string]string
+		errors      []string
+		warnings    []string
+	}{
+		{"default", "", 0, nil, []string{"e1", "e2"}, []string{"w1", "w2", "w3"}},
+		{"warning", "warning", 0, nil, []string{"e1", "e2"}, []string{"w1", "w2", "w3"}},
+		{"error", "error", 0, nil, []string{"e1", "e2"}, nil},
+		{"silent keeps errors", "silent", 0, nil, []string{"e1", "e2"}, nil},
+		{"limit", "", 3, nil, []string{"e1", "e2"}, []string{"w1"}},
+		{"limit below the errors", "", 1, nil, []string{"e1"}, nil},
+		{"override to error", "", 0, map[string]string{"w2": "error"}, []string{"e1", "e2", "w2"}, []string{"w1", "w3"}},
+		{"override to error when silent", "silent", 0, map[string]string{"w2": "error"}, []string{"e1", "e2", "w2"}, nil},
+		{"override to silent", "", 0, map[string]string{"w1": "silent", "w3": "info"}, []string{"e1", "e2"}, []string{"w2"}},
+		{"override to warning", "", 0, map[string]string{"w1": "warning"}, []string{"e1", "e2"}, []string{"w1", "w2", "w3"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &ApiResponse{
+				Errors:   []Message{{ID: "e1"}, {ID: "e2"}},
+				Warnings: []Message{{ID: "w1"}, {ID: "w2"}, {ID: "w3"}},
+			}
+			r.FilterMessages(test.logLevel, test.logLimit, test.logOverride)
+			if got := messageIDs(r.Errors); !reflect.DeepEqual(got, test.errors) {
+				t.Errorf("errors = %v, want %v", got, test.errors)
+			}
+			if got := messageIDs(r.Warnings); !reflect.DeepEqual(got, test.warnings) {
+				t.Errorf("warnings = %v, want %v", got, test.warnings)
+			}
+		})
+	}
+}
+
+// messageIDs lists the IDs of messages, or nil if there are none.
+func messageIDs(messages []Message) []string {
+	var ids []string
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
@@ -0,0 +1,72 @@
+package shared
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// TransformBatchEntry is a single transform in a batch request. Results are
+// keyed by Name, which should therefore be unique within the batch.
+type TransformBatchEntry struct {
+	Name    string                  `json:"name"`
+	Code    string                  `json:"code"`
+	Options TransformOptionsRequest `json:"options"`
+}
+
+// BatchResponse holds the response of every transform in a batch, keyed by
+// entry name. Errors is only used when the batch itself is invalid.
+type BatchResponse struct {
+	Results map[string]*ApiResponse `json:"results"`
+	Errors  []Message               `json:"errors"`
+}
+
+// NewBatchErrorResponse creates the response for a batch that couldn't be
+// run at all, e.g. because the request couldn't be decoded.
+func NewBatchErrorResponse(errors []api.Message) *BatchResponse {
+	return &BatchResponse{
+		Results: make(map[string]*ApiResponse),
+		Errors:  NewMessages(errors),
+	}
+}
+
+// DecodeTransformBatch decodes a JSON array of batch entries.
+func DecodeTransformBatch(data []byte) ([]TransformBatchEntry, error) {
+	var entries []TransformBatchEntry
+	err := json.Unmarshal(data, &entries)
+	return entries, err
+}
+
+// RunTransformBatch runs transform for every entry on a pool of workers
+// goroutines and collects the responses by name.
+func RunTransformBatch(entries []TransformBatchEntry, workers int, transform func(TransformRequest) *ApiResponse) *BatchResponse {
+	if workers < 1 {
+		workers = 1
+	}
+	responses := make([]*ApiResponse, len(entries))
+	indices := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(entries); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indices {
+				entry := entries[index]
+				responses[index] = transform(TransformRequest{Code: entry.Code, Options: entry.Options})
+			}
+		}()
+	}
+	for index := range entries {
+		indices <- index
+	}
+	close(indices)
+	wg.Wait()
+
+	batch := NewBatchErrorResponse(make([]api.Message, 0))
+	for index, entry := range entries {
+		batch.Results[entry.Name] = responses[index]
+	}
+	return batch
+}
@@ -0,0 +1,138 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// SizeBudgetID is the message ID of errors and warnings reported for
+// outputs over their size budget.
+const SizeBudgetID = "size-budget"
+
+// validateBudgets checks the levels and limits of the size budgets.
+func validateBudgets(budgets []SizeBudgetRequest) []api.Message {
+	var errors []api.Message
+	for _, budget := range budgets {
+		if budget.Level != "" && budget.Level != "error" && budget.Level != "warning" {
+			errors = append(errors, NewOptionsError(
+				fmt.Sprintf("Invalid level %q of a size budget", budget.Level),
+				"Valid levels are: error, warning"))
+		}
+		if budget.Raw <= 0 && budget.Gzip <= 0 {
+			errors = append(errors, NewOptionsError(
+				"A size budget has no limit",
+				"Set \"raw\" or \"gzip\" to the maximum size in bytes."))
+		}
+	}
+	return errors
+}
+
+// CheckBudgets measures the outputs of a build against the size budgets,
+// and reports each one that is exceeded as an error, or as a warning if its
+// level says so. The outputs of an entry point are its JS and CSS bundles
+// along with the chunks they import statically, which are all loaded with
+// it, while a budget without an entry point covers every output apart from
+// source maps.
+func CheckBudgets(metafile string, files []api.OutputFile, budgets []SizeBudgetRequest, workingDir string) (errors []api.Message, warnings []api.Message) {
+	var parsed struct {
+		Outputs map[string]struct {
+			EntryPoint string `json:"entryPoint"`
+			CSSBundle  string `json:"cssBundle"`
+			Imports    []struct {
+				Path string `json:"path"`
+				Kind string `json:"kind"`
+			} `json:"imports"`
+		} `json:"outputs"`
+	}
+	if err := json.Unmarshal([]byte(metafile), &parsed); err != nil {
+		return nil, nil
+	}
+	contents := make(map[string][]byte, len(files))
+	for _, file := range files {
+		contents[MetafilePath(file.Path, workingDir)] = file.Contents
+	}
+
+	// loaded adds an output and those it loads to the set of paths.
+	var loaded func(output string, paths map[string]bool)
+	loaded = func(output string, paths map[string]bool) {
+		if paths[output] {
+			return
+		}
+		paths[output] = true
+		if bundle := parsed.Outputs[output].CSSBundle; bundle != "" {
+			loaded(bundle, paths)
+		}
+		for _, imported := range parsed.Outputs[output].Imports {
+			if imported.Kind == "import-statement" {
+				if _, ok := parsed.Outputs[imported.Path]; ok {
+					loaded(imported.Path, paths)
+				}
+			}
+		}
+	}
+
+	for _, budget := range budgets {
+		paths := make(map[string]bool)
+		name := "The outputs of the build"
+		if budget.Entry != "" {
+			entry := path.Clean(filepath.ToSlash(budget.Entry))
+			for output, info := range parsed.Outputs {
+				if info.EntryPoint == entry {
+					loaded(output, paths)
+				}
+			}
+			if len(paths) == 0 {
+				errors = append(errors, NewOptionsError(
+					fmt.Sprintf("The size budget of %q doesn't match any entry point", budget.Entry),
+					"Entry points are given by path relative to the working directory, as in the \"bundles\" of the response."))
+				continue
+			}
+			name = fmt.Sprintf("The outputs of %q", entry)
+		} else {
+			for output := range parsed.Outputs {
+				if !strings.HasSuffix(output, ".map") {
+					paths[output] = true
+				}
+			}
+		}
+
+		var raw, gzipped int
+		sorted := make([]string, 0, len(paths))
+		for output := range paths {
+			sorted = append(sorted, output)
+			raw += len(contents[output])
+			if budget.Gzip > 0 {
+				gzipped += len(Gzip(contents[output]))
+			}
+		}
+		sort.Strings(sorted)
+
+		var exceeded []string
+		if budget.Raw > 0 && raw > budget.Raw {
+			exceeded = append(exceeded, fmt.Sprintf("%d bytes, over the budget of %d bytes", raw, budget.Raw))
+		}
+		if budget.Gzip > 0 && gzipped > budget.Gzip {
+			exceeded = append(exceeded, fmt.Sprintf("%d bytes gzipped, over the budget of %d bytes", gzipped, budget.Gzip))
+		}
+		if len(exceeded) == 0 {
+			continue
+		}
+		msg := api.Message{
+			ID:    SizeBudgetID,
+			Text:  fmt.Sprintf("%s are %s", name, strings.Join(exceeded, ", and ")),
+			Notes: []api.Note{{Text: "The budget covers " + strings.Join(sorted, ", ")}},
+		}
+		if budget.Level == "warning" {
+			warnings = append(warnings, msg)
+		} else {
+			errors = append(errors, msg)
+		}
+	}
+	return errors, warnings
+}
@@ -0,0 +1,77 @@
+package shared
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+func TestCheckBudgets(t *testing.T) {
+	const metafile = `{"outputs": {
+		"dist/a.js": {"entryPoint": "src/a.ts", "cssBundle": "dist/a.css", "imports": [
+			{"path": "dist/chunk.js", "kind": "import-statement"},
+			{"path": "dist/lazy.js", "kind": "dynamic-import"}
+		]},
+		"dist/a.css": {},
+		"dist/a.js.map": {},
+		"dist/chunk.js": {},
+		"dist/lazy.js": {},
+		"dist/b.js": {"entryPoint": "src/b.ts"}
+	}}`
+	workingDir := t.TempDir()
+	var files []api.OutputFile
+	for path, size := range map[string]int{"dist/a.js": 100, "dist/a.css": 20, "dist/a.js.map": 1000, "dist/chunk.js": 5, "dist/lazy.js": 50, "dist/b.js": 10} {
+		files = append(files, api.OutputFile{Path: filepath.Join(workingDir, filepath.FromSlash(path)), Contents: make([]byte, size)})
+	}
+
+	tests := []struct {
+		name     string
+		budget   SizeBudgetRequest
+		errors   []string
+		warnings []string
+	}{
+		{"entry within its budget", SizeBudgetRequest{Entry: "src/a.ts", Raw: 125}, nil, nil},
+		{"entry over its budget", SizeBudgetRequest{Entry: "./src/a.ts", Raw: 124}, []string{
+			`The outputs of "src/a.ts" are 125 bytes, over the budget of 124 bytes`,
+		}, nil},
+		{"warning", SizeBudgetRequest{Entry: "src/b.ts", Raw: 9, Level: "warning"}, nil, []string{
+			`The outputs of "src/b.ts" are 10 bytes, over the budget of 9 bytes`,
+		}},
+		{"all the outputs but source maps", SizeBudgetRequest{Raw: 184}, []string{
+			"The outputs of the build are 185 bytes, over the budget of 184 bytes",
+		}, nil},
+		{"gzip", SizeBudgetRequest{Entry: "src/b.ts", Gzip: 1}, []string{
+			`bytes gzipped, over the budget of 1 bytes`,
+		}, nil},
+		{"unknown entry", SizeBudgetRequest{Entry: "src/c.ts", Raw: 1}, []string{
+			`The size budget of "src/c.ts" doesn't match any entry point`,
+		}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errors, warnings := CheckBudgets(metafile, files, []SizeBudgetRequest{test.budget}, workingDir)
+			assertMessages(t, "errors", errors, test.errors)
+			assertMessages(t, "warnings", warnings, test.warnings)
+		})
+	}
+}
+
+func TestValidateBudgets(t *testing.T) {
+	errors := validateBudgets([]SizeBudgetRequest{{Raw: 1}, {Gzip: 1, Level: "warning"}, {Raw: 1, Level: "info"}, {}})
+	assertMessages(t, "errors", errors, []string{`Invalid level "info" of a size budget`, "A size budget has no limit"})
+}
+
+// assertMessages checks that messages contain the given texts.
+func assertMessages(t *testing.T, name string, messages []api.Message, want []string) {
+	t.Helper()
+	if len(messages) != len(want) {
+		t.Fatalf("%s = %+v, want %q", name, messages, want)
+	}
+	for i, msg := range messages {
+		if !strings.Contains(msg.Text, want[i]) {
+			t.Errorf("%s[%d] = %q, want %q", name, i, msg.Text, want[i])
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package shared
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// BuildRequest is used to unmarshal the JSON build options from Python.
+// It embeds `api.BuildOptions` so that plain fields (strings, booleans,
+// slices) are decoded directly, while fields that are enums in esbuild are
+// shadowed by string fields and mapped manually, in the same way as the
+// `Loader` field of the transform request.
+type BuildRequest struct {
+	api.BuildOptions
+
+	Packages string `json:"packages"`
+	Platform string `json:"platform"`
+	Format   string `json:"format"`
+	Target   string `json:"target"`
+	LogLevel string `json:"logLevel"`
+
+	LegalComments string `json:"legalComments"`
+
+	LogOverride map[string]string `json:"logOverride"`
+
+	// TsconfigRaw may be given either as a JSON string or as an object,
+	// mirroring the JavaScript API.
+	TsconfigRaw json.RawMessage `json:"tsconfigRaw"`
+
+	Stdin *StdinRequest `json:"stdin"`
+
+	// Write defaults to true, so that output files are written to disk
+	// unless the caller explicitly asks for them in the response instead.
+	Write *bool `json:"write"`
+
+	Sourcemap      string `json:"sourcemap"`
+	SourcesContent *bool  `json:"sourcesContent"`
+
+	EntryPointsAdvanced []EntryPointRequest `json:"entryPointsAdvanced"`
+
+	// Loader maps file extensions to loader names, e.g. {".svg": "text"}.
+	Loader map[string]string `json:"loader"`
+
+	// Plugins declares plugins whose hooks are implemented in Python.
+	Plugins []PluginRequest `json:"plugins"`
+
+	// ExternalPatterns marks the imports matching any of these regular
+	// expressions as external.
+	ExternalPatterns []string `json:"externalPatterns"`
+
+	// AliasPatterns rewrites the imports matching regular expressions.
+	AliasPatterns []AliasPatternRequest `json:"aliasPatterns"`
+
+	// NodeBuiltins replaces the imports of Node builtins when bundling for
+	// other platforms, with empty modules ("empty") or with polyfills where
+	// available ("polyfill").
+	NodeBuiltins string `json:"nodeBuiltins"`
+
+	// GlobImports expands the calls of `import.meta.glob` into the imports
+	// of the matching files, as in Vite.
+	GlobImports bool `json:"globImports"`
+
+	// CSSModules scopes the class names of CSS modules, and reports them in
+	// the response.
+	CSSModules *CSSModulesRequest `json:"cssModules"`
+
+	// CSSAssets emits the files referenced by `url()` in CSS as assets, or
+	// inlines the small ones, whatever their extension.
+	CSSAssets *CSSAssetsRequest `json:"cssAssets"`
+
+	// Workers bundles the scripts of the web workers created with
+	// `new Worker(new URL("./worker.js", import.meta.url))` separately.
+	Workers bool `json:"workers"`
+
+	// ImportSuffixes loads the files imported with a `?raw` suffix as text
+	// and those imported with a `?url` suffix as assets, as in Vite.
+	ImportSuffixes bool `json:"importSuffixes"`
+
+	// Manifest is the path, relative to the output directory, of a JSON
+	// file mapping the logical names of the outputs to their hashed paths.
+	Manifest string `json:"manifest"`
+
+	// Integrity is the algorithm ("sha256", "sha384" or "sha512") of the
+	// Subresource Integrity strings computed for the output files.
+	Integrity string `json:"integrity"`
+
+	// CompressedSizes reports the gzip and Brotli sizes of the output files.
+	CompressedSizes bool `json:"compressedSizes"`
+
+	// Precompress writes gzip and Brotli variants of the output files.
+	Precompress bool `json:"precompress"`
+
+	// DependencyGraph returns the graph of the modules of the build and
+	// their imports.
+	DependencyGraph bool `json:"dependencyGraph"`
+
+	// Analysis analyzes the module graph of the build, and returns the
+	// findings in the report of the response.
+	Analysis bool `json:"analysis"`
+
+	// TopModules is the number of the largest inputs of each output to
+	// list in the response.
+	TopModules int `json:"topModules"`
+
+	// Budgets limit the size of the outputs of the build, or of an entry
+	// point.
+	Budgets []SizeBudgetRequest `json:"budgets"`
+
+	// TsconfigPaths is a tsconfig file whose `paths` and `baseUrl` apply to
+	// every import, not only to those of the files it covers.
+	TsconfigPaths string `json:"tsconfigPaths"`
+
+	// ImportMap resolves bare imports through a WICG import map, given
+	// either as an object or as the path of a JSON file.
+	ImportMap json.RawMessage `json:"importMap"`
+
+	// HTTPImports enables bundling modules imported by URL.
+	HTTPImports *HTTPImportsRequest `json:"httpImports"`
+
+	// VirtualFiles maps import paths to modules held in memory, which are
+	// bundled as if they were files.
+	VirtualFiles map[string]VirtualFileRequest `json:"virtualFiles"`
+
+	// Env is exposed to the bundled code as `process.env` and
+	// `import.meta.env`.
+	Env map[string]any `json:"env"`
+
+	// Watch tunes how a context watches its inputs for changes.
+	Watch *WatchRequest `json:"watch"`
+
+	// DisposeAfterIdleMs disposes a context automatically once it hasn't
+	// been used for the given number of milliseconds. Zero keeps it until it
+	// is disposed explicitly.
+	DisposeAfterIdleMs int `json:"disposeAfterIdleMs"`
+
+	// TimeoutMs aborts the operation after the given number of milliseconds.
+	// Zero means no timeout.
+	TimeoutMs int `json:"timeoutMs"`
+
+	// unknownFields lists the keys of the request that don't match any
+	// option, so typos can be reported instead of silently doing nothing.
+	unknownFields []string
+}
+
+// UnmarshalJSON decodes the request and records any unrecognized keys.
+func (r *BuildRequest) UnmarshalJSON(data []byte) error {
+	type plain BuildRequest
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.unknownFields = unknownFields(data, reflect.TypeOf(*r))
+	return nil
+}
+
+// UnknownOptionWarnings returns a warning for each unrecognized option.
+func (r *BuildRequest) UnknownOptionWarnings() []api.Message {
+	return unknownOptionWarnings(r.unknownFields, reflect.TypeOf(*r))
+}
+
+// EntryPointRequest maps an input file to a specific output path (relative
+// to `outdir` and without an extension), using the `{in, out}` shape of the
+// JavaScript API.
+type EntryPointRequest struct {
+	In  string `json:"in"`
+	Out string `json:"out"`
+}
+
+// AliasPatternRequest rewrites the import paths matching Pattern into
+// Replacement, where `$1` or `${name}` stand for the text of a capture group.
+type AliasPatternRequest struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// HTTPImportsRequest holds the settings of the modules imported by URL.
+type HTTPImportsRequest struct {
+	// CacheDir is where downloaded modules are kept. It defaults to an
+	// "esbuild-py/http" directory in the user's cache directory.
+	CacheDir string `json:"cacheDir"`
+}
+
+// CSSModulesRequest holds the settings of CSS modules.
+type CSSModulesRequest struct {
+	// Extensions are the suffixes of the names of CSS modules. They default
+	// to ".module.css".
+	Extensions []string `json:"extensions"`
+
+	// Pattern names the scoped class names, with the [name] of the file,
+	// the [local] class name and a [hash] of both. It defaults to
+	// "[name]_[local]", like esbuild's names.
+	Pattern string `json:"pattern"`
+}
+
+// CSSAssetsRequest holds the settings of the files referenced by `url()` in
+// CSS.
+type CSSAssetsRequest struct {
+	// InlineLimit is the size in bytes under which files are inlined as
+	// data URLs. It defaults to 4096, and 0 disables inlining.
+	InlineLimit *int `json:"inlineLimit"`
+}
+
+// SizeBudgetRequest limits the size in bytes of the outputs of an entry
+// point, or of all the outputs of a build if Entry is empty.
+type SizeBudgetRequest struct {
+	Entry string `json:"entry"`
+	Raw   int    `json:"raw"`
+	Gzip  int    `json:"gzip"`
+
+	// Level is "error" (the default) to fail the build when the budget is
+	// exceeded, or "warning".
+	Level string `json:"level"`
+}
+
+// VirtualFileRequest is a module generated by Python. Its loader defaults
+// to the one matching the extension of its path, or JS.
+type VirtualFileRequest struct {
+	Contents string `json:"contents"`
+	Loader   string `json:"loader"`
+
+	// Namespace is the esbuild namespace of the module, "virtual" by
+	// default.
+	Namespace string `json:"namespace"`
+
+	// ResolveDir is the directory that the imports of the module are
+	// resolved from. It defaults to the directory of the module if its path
+	// is absolute; otherwise, only imports of other virtual files work
+	// without it.
+	ResolveDir string `json:"resolveDir"`
+}
+
+// WatchRequest holds the watch mode settings of a context.
+type WatchRequest struct {
+	// DebounceMs waits for changes to settle before rebuilding, so that
+	// saving several files at once triggers a single rebuild.
+	DebounceMs int `json:"debounceMs"`
+
+	// UsePolling checks the inputs periodically instead of relying on file
+	// system notifications, which aren't delivered for network file systems
+	// or Docker bind mounts. Polling is also used if notifications aren't
+	// available.
+	UsePolling bool `json:"usePolling"`
+
+	// PollIntervalMs is the time between checks when polling.
+	PollIntervalMs int `json:"pollIntervalMs"`
+}
+
+// StdinRequest describes an in-memory entry point, used instead of (or in
+// addition to) the files listed in `entryPoints`.
+type StdinRequest struct {
+	Contents   string `json:"contents"`
+	ResolveDir string `json:"resolveDir"`
+	Sourcefile string `json:"sourcefile"`
+	Loader     string `json:"loader"`
+}
+
+// ToBuildOptions converts the request into the options understood by
+// esbuild's Build API. Any problems with the request are returned as error
+// messages, in the same shape as esbuild's own errors.
+func (r *BuildRequest) ToBuildOptions() (api.BuildOptions, []api.Message) {
+	options := r.BuildOptions
+
+	entryPoints, err := ExpandGlobs(r.EntryPoints, r.AbsWorkingDir)
+	if err != nil {
+		return options, []api.Message{{Text: err.Error()}}
+	}
+	options.EntryPoints = entryPoints
+
+	loaderMap, errors := ParseLoaderMap(r.Loader)
+	if len(errors) > 0 {
+		return options, errors
+	}
+	options.Loader = loaderMap
+
+	define, errors := envDefines(r.Define, r.Env)
+	if len(errors) > 0 {
+		return options, errors
+	}
+	options.Define = define
+
+	var msg *api.Message
+	options.Packages, msg = ParsePackages(r.Packages)
+	errors = appendMessage(errors, msg)
+	options.Platform, msg = ParsePlatform(r.Platform)
+	errors = appendMessage(errors, msg)
+	options.Format, msg = ParseFormat(r.Format)
+	errors = appendMessage(errors, msg)
+	options.Target, msg = ParseTarget(r.Target)
+	errors = appendMessage(errors, msg)
+	options.LegalComments, msg = ParseLegalComments(r.LegalComments)
+	errors = appendMessage(errors, msg)
+	options.Sourcemap, msg = ParseSourceMap(r.Sourcemap)
+	errors = appendMessage(errors, msg)
+	options.LogLevel, msg = ParseLogLevel(r.LogLevel)
+	errors = appendMessage(errors, msg)
+	logOverride, overrideErrors := ParseLogOverride(r.LogOverride)
+	options.LogOverride = logOverride
+	errors = append(errors, overrideErrors...)
+	if len(errors) > 0 {
+		return options, errors
+	}
+	options.TsconfigRaw = rawJSONToString(r.TsconfigRaw)
+	options.Write = r.Write == nil || *r.Write
+	if r.SourcesContent != nil && !*r.SourcesContent {
+		options.SourcesContent = api.SourcesContentExclude
+	}
+	for _, entryPoint := range r.EntryPointsAdvanced {
+		options.EntryPointsAdvanced = append(options.EntryPointsAdvanced, api.EntryPoint{
+			InputPath:  entryPoint.In,
+			OutputPath: entryPoint.Out,
+		})
+	}
+	if r.Stdin != nil {
+		loader, msg := ParseLoader(r.Stdin.Loader)
+		if msg != nil {
+			return options, []api.Message{*msg}
+		}
+		options.Stdin = &api.StdinOptions{
+			Contents:   r.Stdin.Contents,
+			ResolveDir: r.Stdin.ResolveDir,
+			Sourcefile: r.Stdin.Sourcefile,
+			Loader:     loader,
+		}
+	}
+	errors = append(validateBuildOptions(options), validatePlugins(r.Plugins)...)
+	errors = append(errors, validateIntegrity(r.Integrity)...)
+	errors = append(errors, validateBudgets(r.Budgets)...)
+	if r.Manifest != "" && options.Outdir == "" && options.Outfile == "" {
+		errors = append(errors, NewOptionsError(
+			"The manifest requires \"outdir\" or \"outfile\" to be set",
+			"Set \"outdir\", since the paths of the manifest are relative to it."))
+	}
+	return options, errors
+}
+
+// rawJSONToString returns the contents of a JSON string, or the JSON text
+// itself for any other kind of value.
+func rawJSONToString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str
+	}
+	return string(raw)
+}
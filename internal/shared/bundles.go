@@ -0,0 +1,60 @@
+package shared
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EntryBundle lists the outputs of an entry point: its JS bundle and the
+// CSS bundle holding the CSS it imports, or its CSS bundle if the entry
+// point is a stylesheet.
+type EntryBundle struct {
+	JS  string `json:"js,omitempty"`
+	CSS string `json:"css,omitempty"`
+}
+
+// NewEntryBundles maps the entry points listed in a metafile to their
+// outputs, with the paths of the metafile, relative to the working
+// directory.
+func NewEntryBundles(metafile string) map[string]EntryBundle {
+	var parsed struct {
+		Outputs map[string]struct {
+			EntryPoint string `json:"entryPoint"`
+			CSSBundle  string `json:"cssBundle"`
+		} `json:"outputs"`
+	}
+	if err := json.Unmarshal([]byte(metafile), &parsed); err != nil {
+		return nil
+	}
+	bundles := make(map[string]EntryBundle)
+	for path, output := range parsed.Outputs {
+		if output.EntryPoint == "" {
+			continue
+		}
+		bundle := bundles[output.EntryPoint]
+		if output.CSSBundle != "" || !strings.HasSuffix(path, ".css") {
+			bundle.JS = path
+			if output.CSSBundle != "" {
+				bundle.CSS = output.CSSBundle
+			}
+		} else {
+			bundle.CSS = path
+		}
+		bundles[output.EntryPoint] = bundle
+	}
+	return bundles
+}
+
+// MetafilePath converts the absolute path of an output file to its path in
+// the metafile, relative to the working directory with forward slashes.
+func MetafilePath(path string, workingDir string) string {
+	if workingDir == "" {
+		workingDir, _ = os.Getwd()
+	}
+	if rel, err := filepath.Rel(workingDir, path); err == nil {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
@@ -0,0 +1,77 @@
+package shared
+
+// Commands lists the operations supported by the native library. Each one
+// may be exported in several variants that only differ in how the request
+// and response are passed, e.g. `transform` and `transform_bytes`. Every new
+// export must be added here, since Python relies on this list to detect the
+// features of the library it loaded.
+var Commands = []string{
+	"build",
+	"transform",
+	"version",
+	"capabilities",
+	"submit_transform",
+	"submit_build",
+	"poll_result",
+	"wait_result",
+	"set_completion_callback",
+	"transform_many",
+	"configure",
+	"cancel",
+	"set_max_threads",
+	"set_memory_limit",
+	"stats",
+	"esbuild_shutdown",
+	"context_create",
+	"context_rebuild",
+	"context_dispose",
+	"list_contexts",
+	"context_watch",
+	"context_unwatch",
+	"watch_poll",
+	"set_watch_callback",
+	"context_serve",
+	"serve_stop",
+	"serve_poll",
+	"dev",
+	"set_plugin_callback",
+	"plugin_respond",
+	"plugin_resolve",
+	"analyze_metafile",
+	"format_messages",
+}
+
+// Capabilities is the JSON response of the capabilities export. Apart from
+// the commands, every list is generated from the mapping tables used to
+// decode requests.
+type Capabilities struct {
+	Commands      []string `json:"commands"`
+	Loaders       []string `json:"loaders"`
+	Formats       []string `json:"formats"`
+	Platforms     []string `json:"platforms"`
+	Targets       []string `json:"targets"`
+	Sourcemaps    []string `json:"sourcemaps"`
+	Packages      []string `json:"packages"`
+	LegalComments []string `json:"legalComments"`
+	LogLevels     []string `json:"logLevels"`
+	Encodings     []string `json:"encodings"`
+}
+
+// NewCapabilities describes the given commands and the option values
+// supported by this build of the bindings. The native library passes
+// Commands, while the WASM module and the daemon pass the smaller sets of
+// commands they serve.
+func NewCapabilities(commands []string) *Capabilities {
+	return &Capabilities{
+		Commands:      commands,
+		Loaders:       loaderNames(),
+		Formats:       sortedKeys(formats),
+		Platforms:     sortedKeys(platforms),
+		Targets:       sortedKeys(targets),
+		Sourcemaps:    sortedKeys(sourceMaps),
+		Packages:      sortedKeys(packageModes),
+		LegalComments: sortedKeys(legalCommentModes),
+		LogLevels:     sortedKeys(logLevels),
+		Encodings:     sortedKeys(encodings),
+	}
+}
@@ -0,0 +1,62 @@
+package shared
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// OutputSize holds the size of an output file, as is and once compressed
+// the way static files are precompressed for serving.
+type OutputSize struct {
+	Raw    int `json:"raw"`
+	Gzip   int `json:"gzip"`
+	Brotli int `json:"brotli"`
+}
+
+// Gzip compresses data at the best compression level.
+func Gzip(data []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// Brotli compresses data at the best compression level.
+func Brotli(data []byte) []byte {
+	var buf bytes.Buffer
+	w := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// NewOutputSizes measures the output files of a build, by path relative to
+// the working directory, as in the metafile. Files are compressed in
+// parallel, since Brotli's best level is slow on large bundles.
+func NewOutputSizes(files []api.OutputFile, workingDir string) map[string]OutputSize {
+	sizes := make([]OutputSize, len(files))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sizes[i] = OutputSize{
+				Raw:    len(file.Contents),
+				Gzip:   len(Gzip(file.Contents)),
+				Brotli: len(Brotli(file.Contents)),
+			}
+		}()
+	}
+	wg.Wait()
+
+	result := make(map[string]OutputSize, len(files))
+	for i, file := range files {
+		result[MetafilePath(file.Path, workingDir)] = sizes[i]
+	}
+	return result
+}
@@ -0,0 +1,13 @@
+package shared
+
+// Config holds the settings of the configure export. Fields that are absent
+// from the request are left unchanged.
+type Config struct {
+	// Concurrency caps how many builds and transforms may run at the same
+	// time. Zero means no limit.
+	Concurrency *int `json:"concurrency,omitempty"`
+
+	// ResolveCache shares the results of path resolution across builds,
+	// instead of only within a build context. Disabling it clears the cache.
+	ResolveCache *bool `json:"resolveCache,omitempty"`
+}
@@ -0,0 +1,41 @@
+package shared
+
+// States of a build context, as reported by list_contexts.
+const (
+	ContextIdle     = "idle"
+	ContextBuilding = "building"
+	ContextWatching = "watching"
+	ContextServing  = "serving"
+)
+
+// ContextInfo describes a live build context in the response of the
+// list_contexts export.
+type ContextInfo struct {
+	ID    uint64 `json:"id"`
+	State string `json:"state"`
+
+	// A summary of the options the context was created with.
+	EntryPoints []string `json:"entryPoints"`
+	Outfile     string   `json:"outfile,omitempty"`
+	Outdir      string   `json:"outdir,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	Platform    string   `json:"platform,omitempty"`
+	Write       bool     `json:"write"`
+}
+
+// WatchEvent describes a rebuild of a watched context.
+type WatchEvent struct {
+	Success    bool  `json:"success"`
+	DurationMs int64 `json:"durationMs"`
+
+	// ChangedFiles lists the input files whose changes triggered the
+	// rebuild. It is empty for the initial build.
+	ChangedFiles []string `json:"changedFiles"`
+
+	// ChangedOutputs lists the output files whose contents differ from the
+	// previous build.
+	ChangedOutputs []string `json:"changedOutputs"`
+
+	Errors   []Message `json:"errors"`
+	Warnings []Message `json:"warnings"`
+}
@@ -0,0 +1,92 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encoding selects the wire format of requests and responses. JSON is the
+// default; MessagePack avoids the cost of escaping large sources and outputs.
+type Encoding int
+
+const (
+	EncodingJSON Encoding = iota
+	EncodingMessagePack
+)
+
+var encodings = map[string]Encoding{
+	"json":    EncodingJSON,
+	"msgpack": EncodingMessagePack,
+}
+
+// ParseEncoding maps the encoding argument of the `_encoded` exports to an
+// Encoding. Like option values, unknown encodings are rejected rather than
+// silently treated as JSON.
+func ParseEncoding(value int) (Encoding, *api.Message) {
+	if encoding := Encoding(value); encoding.valid() {
+		return encoding, nil
+	}
+	msg := NewOptionsError(
+		fmt.Sprintf("Invalid encoding %d", value),
+		fmt.Sprintf("Valid encodings are: %d for JSON, %d for MessagePack", int(EncodingJSON), int(EncodingMessagePack)))
+	return EncodingJSON, &msg
+}
+
+// valid reports whether e is one of the supported encodings.
+func (e Encoding) valid() bool {
+	return e == EncodingJSON || e == EncodingMessagePack
+}
+
+// String returns the name of the encoding, for error messages.
+func (e Encoding) String() string {
+	switch e {
+	case EncodingJSON:
+		return "JSON"
+	case EncodingMessagePack:
+		return "MessagePack"
+	}
+	return fmt.Sprintf("Encoding(%d)", int(e))
+}
+
+// Marshal encodes a response. MessagePack responses use the same field names
+// as JSON ones, taken from the `json` struct tags.
+func (e Encoding) Marshal(v any) ([]byte, error) {
+	if !e.valid() {
+		return nil, fmt.Errorf("unknown encoding %d", int(e))
+	}
+	if e == EncodingJSON {
+		return json.Marshal(v)
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a request. MessagePack requests are converted to JSON
+// first, so that the request types decode them with the same rules (enum
+// mapping, unknown option detection) regardless of the wire format.
+func (e Encoding) Unmarshal(data []byte, v any) error {
+	if !e.valid() {
+		return fmt.Errorf("unknown encoding %d", int(e))
+	}
+	if e == EncodingJSON {
+		return json.Unmarshal(data, v)
+	}
+	var value any
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonData, v)
+}
@@ -0,0 +1,26 @@
+package shared
+
+import "testing"
+
+func TestParseEncoding(t *testing.T) {
+	for value, want := range map[int]Encoding{0: EncodingJSON, 1: EncodingMessagePack} {
+		if got, msg := ParseEncoding(value); got != want || msg != nil {
+			t.Errorf("ParseEncoding(%d) = %v, %+v, want %v", value, got, msg, want)
+		}
+	}
+	for _, value := range []int{-1, 2, 7} {
+		if _, msg := ParseEncoding(value); msg == nil || msg.ID != InvalidOptionsID {
+			t.Errorf("ParseEncoding(%d) = %+v, want an invalid-options error", value, msg)
+		}
+	}
+}
+
+func TestUnknownEncoding(t *testing.T) {
+	var v any
+	if err := Encoding(2).Unmarshal([]byte("{}"), &v); err == nil {
+		t.Error("Unmarshal accepted an unknown encoding")
+	}
+	if _, err := Encoding(2).Marshal(v); err == nil {
+		t.Error("Marshal accepted an unknown encoding")
+	}
+}
@@ -0,0 +1,48 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// envKeyPattern matches the names that can follow `process.env.` in a
+// define.
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// envDefines adds the `env` of a build request to its defines, as both
+// `process.env.KEY` and `import.meta.env.KEY`, and the whole set as
+// `import.meta.env`, like Vite does. Values are serialized as JSON, which
+// turns strings into safely escaped string literals. Defines given
+// explicitly take precedence.
+func envDefines(define map[string]string, env map[string]any) (map[string]string, []api.Message) {
+	if len(env) == 0 {
+		return define, nil
+	}
+	var errors []api.Message
+	defines := make(map[string]string, len(define)+2*len(env)+1)
+	for _, key := range sortedKeys(env) {
+		if !envKeyPattern.MatchString(key) {
+			errors = append(errors, NewOptionsError(
+				fmt.Sprintf("The environment variable %q can't be defined", key),
+				"Names in \"env\" must be valid JavaScript identifiers."))
+			continue
+		}
+		value, err := json.Marshal(env[key])
+		if err != nil {
+			errors = append(errors, api.Message{Text: fmt.Sprintf("Failed to serialize the environment variable %q: %v", key, err)})
+			continue
+		}
+		defines["process.env."+key] = string(value)
+		defines["import.meta.env."+key] = string(value)
+	}
+	if all, err := json.Marshal(env); err == nil {
+		defines["import.meta.env"] = string(all)
+	}
+	for key, value := range define {
+		defines[key] = value
+	}
+	return defines, errors
+}
@@ -0,0 +1,47 @@
+package shared
+
+import (
+	"fmt"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// messageKinds maps the kinds of the format_messages request to esbuild's.
+var messageKinds = map[string]api.MessageKind{
+	"error":   api.ErrorMessage,
+	"warning": api.WarningMessage,
+}
+
+// FormatMessagesRequest is the JSON request of the format_messages export.
+type FormatMessagesRequest struct {
+	// Messages are errors or warnings, as found in responses.
+	Messages []Message `json:"messages"`
+
+	// Kind is "error" (the default) or "warning".
+	Kind  string `json:"kind"`
+	Color bool   `json:"color"`
+
+	// TerminalWidth wraps the messages to the given number of columns.
+	TerminalWidth int `json:"terminalWidth"`
+}
+
+// FormatMessages renders messages the way esbuild prints them, with an
+// excerpt of the source pointing at their location and their notes.
+func FormatMessages(req FormatMessagesRequest) *ApiResponse {
+	kind := api.ErrorMessage
+	if req.Kind != "" {
+		var ok bool
+		if kind, ok = messageKinds[req.Kind]; !ok {
+			return NewApiResponse("", []api.Message{NewOptionsError(
+				fmt.Sprintf("Invalid message kind %q", req.Kind),
+				"Valid kinds are: error, warning")}, nil)
+		}
+	}
+	response := NewApiResponse("", nil, nil)
+	response.Formatted = api.FormatMessages(APIMessages(req.Messages), api.FormatMessagesOptions{
+		Kind:          kind,
+		Color:         req.Color,
+		TerminalWidth: req.TerminalWidth,
+	})
+	return response
+}
@@ -0,0 +1,125 @@
+package shared
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExpandGlobs expands entry points containing glob patterns into the list of
+// matching files, so that Python callers can pass patterns like
+// `src/pages/*.tsx` exactly as they would to the esbuild CLI. In addition to
+// the `*`, `?` and `[...]` wildcards, a `**` path segment matches any number
+// of nested directories. Relative patterns are resolved against baseDir (or
+// the current directory if it's empty) and matches are returned relative to
+// it. Entries without wildcards are passed through unchanged so esbuild can
+// report missing files itself.
+func ExpandGlobs(patterns []string, baseDir string) ([]string, error) {
+	var expanded []string
+	for _, pattern := range patterns {
+		if !hasGlobMeta(pattern) {
+			expanded = append(expanded, pattern)
+			continue
+		}
+
+		matches, err := ExpandGlob(filepath.ToSlash(pattern), baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry point pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files matched the entry point pattern %q", pattern)
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// ExpandGlob returns the files matching a single slash-separated glob
+// pattern, which may be empty, with the same syntax as ExpandGlobs.
+func ExpandGlob(pattern string, baseDir string) ([]string, error) {
+	// Split off the leading segments without wildcards; that's the directory
+	// the walk starts from.
+	segments := strings.Split(pattern, "/")
+	static := 0
+	for static < len(segments) && !hasGlobMeta(segments[static]) {
+		static++
+	}
+	root := strings.Join(segments[:static], "/")
+	if root == "" && strings.HasPrefix(pattern, "/") {
+		root = "/"
+	}
+	dynamic := segments[static:]
+
+	// Validate the pattern up front, since path.Match only reports a bad
+	// pattern when it's actually used to match something.
+	for _, segment := range dynamic {
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	walkRoot := root
+	if !filepath.IsAbs(filepath.FromSlash(walkRoot)) && baseDir != "" {
+		walkRoot = filepath.Join(baseDir, filepath.FromSlash(walkRoot))
+	}
+	if walkRoot == "" {
+		walkRoot = "."
+	}
+
+	var matches []string
+	err := filepath.WalkDir(walkRoot, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// A missing root simply means there are no matches.
+			if file == walkRoot {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(walkRoot, file)
+		if err != nil {
+			return err
+		}
+		if matchSegments(dynamic, strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, path.Join(root, filepath.ToSlash(rel)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// matchSegments matches path segments against pattern segments, where a `**`
+// pattern segment matches zero or more path segments.
+func matchSegments(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
@@ -0,0 +1,66 @@
+package shared
+
+import "encoding/json"
+
+// GraphNode is a module of the dependency graph of a build.
+type GraphNode struct {
+	// Bytes is the size of the module's source, and BytesInOutput the size
+	// of what's left of it in the outputs, after tree shaking.
+	Bytes         int `json:"bytes"`
+	BytesInOutput int `json:"bytesInOutput"`
+
+	// Format is "esm" or "cjs" for JS modules, and empty otherwise.
+	Format string `json:"format,omitempty"`
+
+	Imports []GraphEdge `json:"imports"`
+}
+
+// GraphEdge is an import of a module. Path is the imported module, or the
+// import path as written if the import is external.
+type GraphEdge struct {
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	External bool   `json:"external,omitempty"`
+	Original string `json:"original,omitempty"`
+}
+
+// NewModuleGraph converts the inputs of a metafile into an adjacency list,
+// keyed by module path relative to the working directory.
+func NewModuleGraph(metafile string) map[string]GraphNode {
+	var parsed struct {
+		Inputs map[string]struct {
+			Bytes   int         `json:"bytes"`
+			Format  string      `json:"format"`
+			Imports []GraphEdge `json:"imports"`
+		} `json:"inputs"`
+		Outputs map[string]struct {
+			Inputs map[string]struct {
+				BytesInOutput int `json:"bytesInOutput"`
+			} `json:"inputs"`
+		} `json:"outputs"`
+	}
+	if err := json.Unmarshal([]byte(metafile), &parsed); err != nil {
+		return nil
+	}
+	graph := make(map[string]GraphNode, len(parsed.Inputs))
+	for path, input := range parsed.Inputs {
+		imports := input.Imports
+		if imports == nil {
+			imports = make([]GraphEdge, 0)
+		}
+		graph[path] = GraphNode{
+			Bytes:   input.Bytes,
+			Format:  input.Format,
+			Imports: imports,
+		}
+	}
+	for _, output := range parsed.Outputs {
+		for path, input := range output.Inputs {
+			if node, ok := graph[path]; ok {
+				node.BytesInOutput += input.BytesInOutput
+				graph[path] = node
+			}
+		}
+	}
+	return graph
+}
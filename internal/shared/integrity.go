@@ -0,0 +1,47 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// integrityHashes maps the algorithms of the `integrity` build option to
+// their hash functions.
+var integrityHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// validateIntegrity checks the algorithm of the `integrity` build option.
+func validateIntegrity(algorithm string) []api.Message {
+	if algorithm == "" || integrityHashes[algorithm] != nil {
+		return nil
+	}
+	return []api.Message{NewOptionsError(
+		fmt.Sprintf("Invalid integrity algorithm %q", algorithm),
+		"Valid algorithms are: "+strings.Join(sortedKeys(integrityHashes), ", "))}
+}
+
+// NewIntegrity computes the Subresource Integrity strings of the output
+// files of a build, e.g. "sha384-oqVu...", by path relative to the working
+// directory, as in the metafile.
+func NewIntegrity(files []api.OutputFile, algorithm string, workingDir string) map[string]string {
+	newHash := integrityHashes[algorithm]
+	if newHash == nil {
+		return nil
+	}
+	integrity := make(map[string]string, len(files))
+	for _, file := range files {
+		h := newHash()
+		h.Write(file.Contents)
+		integrity[MetafilePath(file.Path, workingDir)] = algorithm + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+	}
+	return integrity
+}
@@ -0,0 +1,147 @@
+package shared
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// placeholderRe matches the placeholders of esbuild's output path templates.
+var placeholderRe = regexp.MustCompile(`\[(dir|name|hash|ext)\]`)
+
+// NewManifest maps the logical names of the outputs of a build to their
+// final paths, both relative to the output directory. A logical name is the
+// path of an output without the hash that the `entryNames` or `assetNames`
+// template puts into it, e.g. "main.js" for "main-X7Q2.js". Entry points,
+// their CSS bundles and assets are listed, while chunks and source maps are
+// left out, since pages don't refer to them directly.
+func NewManifest(metafile string, options api.BuildOptions) map[string]string {
+	var parsed struct {
+		Outputs map[string]struct {
+			EntryPoint string `json:"entryPoint"`
+			CSSBundle  string `json:"cssBundle"`
+		} `json:"outputs"`
+	}
+	if err := json.Unmarshal([]byte(metafile), &parsed); err != nil {
+		return nil
+	}
+	cssBundles := make(map[string]bool)
+	for _, output := range parsed.Outputs {
+		if output.CSSBundle != "" {
+			cssBundles[output.CSSBundle] = true
+		}
+	}
+
+	entryNames := hashPattern(options.EntryNames)
+	assetNames := hashPattern(options.AssetNames)
+	if options.AssetNames == "" {
+		assetNames = hashPattern("[name]-[hash]")
+	}
+	outdir := ManifestDir(options)
+	manifest := make(map[string]string)
+	for path, output := range parsed.Outputs {
+		var pattern *regexp.Regexp
+		switch ext := filepath.Ext(path); {
+		case ext == ".map":
+			continue
+		case output.EntryPoint != "" || cssBundles[path]:
+			pattern = entryNames
+		case ext == ".js" || ext == ".css" || ext == ".mjs" || ext == ".cjs":
+			// Other JS and CSS outputs are chunks shared by entry points.
+			continue
+		default:
+			pattern = assetNames
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(absWorkingDir(options), path)
+		}
+		rel, err := filepath.Rel(outdir, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		manifest[removeHash(rel, pattern)] = rel
+	}
+	return manifest
+}
+
+// ManifestDir returns the absolute directory the paths of the manifest are
+// relative to: the output directory, or that of the output file.
+func ManifestDir(options api.BuildOptions) string {
+	dir := options.Outdir
+	if dir == "" {
+		dir = filepath.Dir(options.Outfile)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(absWorkingDir(options), dir)
+	}
+	return dir
+}
+
+// absWorkingDir returns the directory relative paths of a build are
+// resolved against, which is the current one unless `absWorkingDir` is set.
+func absWorkingDir(options api.BuildOptions) string {
+	if options.AbsWorkingDir != "" {
+		return options.AbsWorkingDir
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// hashPattern converts an output path template into a regular expression
+// matching the paths made from it, whose only group is the hash. It returns
+// nil if the template has no hash.
+func hashPattern(template string) *regexp.Regexp {
+	if !strings.Contains(template, "[hash]") {
+		return nil
+	}
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, match := range placeholderRe.FindAllStringSubmatchIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:match[0]]))
+		switch template[match[2]:match[3]] {
+		case "hash":
+			pattern.WriteString(`([A-Z2-7]{8})`)
+		case "dir":
+			// An empty directory is dropped along with its separator.
+			if strings.HasPrefix(template[match[1]:], "/") {
+				pattern.WriteString(`(?:.*/)?`)
+				match[1]++
+			} else {
+				pattern.WriteString(`.*`)
+			}
+		default:
+			pattern.WriteString(`[^/]*`)
+		}
+		last = match[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	// esbuild adds the extension of the output after the template.
+	pattern.WriteString(`(?:\.[^/]*)?$`)
+	return regexp.MustCompile(pattern.String())
+}
+
+// removeHash removes the hash from a path made from a template, along with
+// the separator next to it.
+func removeHash(path string, pattern *regexp.Regexp) string {
+	if pattern == nil {
+		return path
+	}
+	match := pattern.FindStringSubmatchIndex(path)
+	if match == nil {
+		return path
+	}
+	start, end := match[2], match[3]
+	switch {
+	case start > 0 && strings.ContainsRune("-._", rune(path[start-1])):
+		start--
+	case end < len(path) && strings.ContainsRune("-._/", rune(path[end])):
+		end++
+	}
+	return path[:start] + path[end:]
+}
@@ -0,0 +1,277 @@
+package shared
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// These tables map the string values used in the JSON API to esbuild's enums.
+// They are the single source of truth for both the request decoding and the
+// capabilities export, so that the two can't drift apart.
+
+var loaders = map[string]api.Loader{
+	"js":         api.LoaderJS,
+	"jsx":        api.LoaderJSX,
+	"ts":         api.LoaderTS,
+	"tsx":        api.LoaderTSX,
+	"css":        api.LoaderCSS,
+	"global-css": api.LoaderGlobalCSS,
+	"local-css":  api.LoaderLocalCSS,
+	"json":       api.LoaderJSON,
+	"text":       api.LoaderText,
+	"base64":     api.LoaderBase64,
+	"dataurl":    api.LoaderDataURL,
+	"file":       api.LoaderFile,
+	"copy":       api.LoaderCopy,
+	"binary":     api.LoaderBinary,
+	"empty":      api.LoaderEmpty,
+}
+
+// pluginLoaders names the loaders implemented by built-in plugins rather
+// than by esbuild, which are only valid in the `loader` build option.
+var pluginLoaders = map[string]bool{
+	"yaml":          true,
+	"toml":          true,
+	"markdown":      true,
+	"markdown-html": true,
+	"wasm":          true,
+}
+
+var formats = map[string]api.Format{
+	"iife": api.FormatIIFE,
+	"cjs":  api.FormatCommonJS,
+	"esm":  api.FormatESModule,
+}
+
+var platforms = map[string]api.Platform{
+	"browser": api.PlatformBrowser,
+	"node":    api.PlatformNode,
+	"neutral": api.PlatformNeutral,
+}
+
+var targets = map[string]api.Target{
+	"esnext": api.ESNext,
+	"es5":    api.ES5,
+	"es2015": api.ES2015,
+	"es2016": api.ES2016,
+	"es2017": api.ES2017,
+	"es2018": api.ES2018,
+	"es2019": api.ES2019,
+	"es2020": api.ES2020,
+	"es2021": api.ES2021,
+	"es2022": api.ES2022,
+	"es2023": api.ES2023,
+	"es2024": api.ES2024,
+}
+
+var sourceMaps = map[string]api.SourceMap{
+	"linked":   api.SourceMapLinked,
+	"external": api.SourceMapExternal,
+	"inline":   api.SourceMapInline,
+	"both":     api.SourceMapInlineAndExternal,
+}
+
+var packageModes = map[string]api.Packages{
+	"bundle":   api.PackagesBundle,
+	"external": api.PackagesExternal,
+}
+
+var legalCommentModes = map[string]api.LegalComments{
+	"none":     api.LegalCommentsNone,
+	"inline":   api.LegalCommentsInline,
+	"eof":      api.LegalCommentsEndOfFile,
+	"linked":   api.LegalCommentsLinked,
+	"external": api.LegalCommentsExternal,
+}
+
+var logLevels = map[string]api.LogLevel{
+	"verbose": api.LogLevelVerbose,
+	"debug":   api.LogLevelDebug,
+	"info":    api.LogLevelInfo,
+	"warning": api.LogLevelWarning,
+	"error":   api.LogLevelError,
+	"silent":  api.LogLevelSilent,
+}
+
+// resolveKinds names the kinds of imports passed to plugins, as in the
+// JavaScript API.
+var resolveKinds = map[string]api.ResolveKind{
+	"entry-point":      api.ResolveEntryPoint,
+	"import-statement": api.ResolveJSImportStatement,
+	"require-call":     api.ResolveJSRequireCall,
+	"dynamic-import":   api.ResolveJSDynamicImport,
+	"require-resolve":  api.ResolveJSRequireResolve,
+	"import-rule":      api.ResolveCSSImportRule,
+	"composes-from":    api.ResolveCSSComposesFrom,
+	"url-token":        api.ResolveCSSURLToken,
+}
+
+// sortedKeys returns the keys of a mapping table in a stable order.
+func sortedKeys[T any](table map[string]T) []string {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseLoader maps a loader name to esbuild's enum. Unknown names are
+// rejected with a message listing the valid ones, since falling back to
+// another loader only leads to confusing errors further down the line.
+// An empty name selects the JS loader.
+func ParseLoader(loaderStr string) (api.Loader, *api.Message) {
+	if loaderStr == "" {
+		return api.LoaderJS, nil
+	}
+	if loader, ok := loaders[loaderStr]; ok {
+		return loader, nil
+	}
+	msg := NewOptionsError(
+		fmt.Sprintf("Invalid loader %q", loaderStr),
+		"Valid loaders are: "+strings.Join(sortedKeys(loaders), ", "))
+	return api.LoaderNone, &msg
+}
+
+// ParseLoaderMap maps a file extension → loader name table, as used by the
+// `loader` build option.
+func ParseLoaderMap(loaderMap map[string]string) (map[string]api.Loader, []api.Message) {
+	if len(loaderMap) == 0 {
+		return nil, nil
+	}
+	var errors []api.Message
+	result := make(map[string]api.Loader, len(loaderMap))
+	for _, ext := range sortedKeys(loaderMap) {
+		if pluginLoaders[loaderMap[ext]] {
+			continue
+		}
+		loader, msg := ParseLoader(loaderMap[ext])
+		if msg != nil {
+			msg.Text += fmt.Sprintf(" for extension %q", ext)
+			msg.Notes[0].Text = "Valid loaders are: " + strings.Join(loaderNames(), ", ")
+			errors = append(errors, *msg)
+			continue
+		}
+		result[ext] = loader
+	}
+	return result, errors
+}
+
+// PluginLoaderMap returns the extensions of a loader map that use loaders
+// implemented by built-in plugins, with their loader names.
+func PluginLoaderMap(loaderMap map[string]string) map[string]string {
+	result := make(map[string]string)
+	for ext, name := range loaderMap {
+		if pluginLoaders[name] {
+			result[ext] = name
+		}
+	}
+	return result
+}
+
+// loaderNames lists the loaders valid in the `loader` build option.
+func loaderNames() []string {
+	names := sortedKeys(loaders)
+	for name := range pluginLoaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseOption maps the value of a string option to esbuild's enum, using
+// one of the tables above. Like loaders, unknown values are rejected with a
+// message naming the option and listing the valid values, rather than
+// silently falling back to a default. An empty value selects empty.
+func parseOption[T any](option string, value string, table map[string]T, empty T) (T, *api.Message) {
+	if value == "" {
+		return empty, nil
+	}
+	if mapped, ok := table[value]; ok {
+		return mapped, nil
+	}
+	msg := NewOptionsError(
+		fmt.Sprintf("Invalid %q value %q", option, value),
+		"Valid values are: "+strings.Join(sortedKeys(table), ", "))
+	return empty, &msg
+}
+
+func ParseFormat(formatStr string) (api.Format, *api.Message) {
+	return parseOption("format", formatStr, formats, api.FormatDefault)
+}
+
+func ParsePlatform(platformStr string) (api.Platform, *api.Message) {
+	return parseOption("platform", platformStr, platforms, api.PlatformBrowser)
+}
+
+func ParseTarget(targetStr string) (api.Target, *api.Message) {
+	return parseOption("target", targetStr, targets, api.DefaultTarget)
+}
+
+func ParseSourceMap(sourcemapStr string) (api.SourceMap, *api.Message) {
+	return parseOption("sourcemap", sourcemapStr, sourceMaps, api.SourceMapNone)
+}
+
+func ParsePackages(packagesStr string) (api.Packages, *api.Message) {
+	return parseOption("packages", packagesStr, packageModes, api.PackagesDefault)
+}
+
+func ParseLegalComments(legalCommentsStr string) (api.LegalComments, *api.Message) {
+	return parseOption("legalComments", legalCommentsStr, legalCommentModes, api.LegalCommentsDefault)
+}
+
+// appendMessage appends the message returned by one of the parse functions
+// to a list of errors, if there is one.
+func appendMessage(errors []api.Message, msg *api.Message) []api.Message {
+	if msg == nil {
+		return errors
+	}
+	return append(errors, *msg)
+}
+
+func ParseLogLevel(logLevelStr string) (api.LogLevel, *api.Message) {
+	// Nothing is printed to stderr by default, since the messages are
+	// returned to Python in the response instead.
+	return parseOption("logLevel", logLevelStr, logLevels, api.LogLevelSilent)
+}
+
+// ParseLogOverride maps the levels of a message ID → level table. Unlike the
+// global log level, an override of "silent" drops the message entirely and
+// an override of "error" turns a warning into an error. Unknown levels are
+// rejected, since silently dropping the message would hide the very warning
+// the override was meant to adjust.
+func ParseLogOverride(overrides map[string]string) (map[string]api.LogLevel, []api.Message) {
+	if len(overrides) == 0 {
+		return nil, nil
+	}
+	var errors []api.Message
+	logOverride := make(map[string]api.LogLevel, len(overrides))
+	for _, id := range sortedKeys(overrides) {
+		level, ok := logLevels[overrides[id]]
+		if !ok {
+			errors = append(errors, NewOptionsError(
+				fmt.Sprintf("Invalid \"logOverride\" value %q for %q", overrides[id], id),
+				"Valid values are: "+strings.Join(sortedKeys(logLevels), ", ")))
+			continue
+		}
+		logOverride[id] = level
+	}
+	return logOverride, errors
+}
+
+// MapResolveKindToString names a resolve kind for plugins written in Python.
+func MapResolveKindToString(kind api.ResolveKind) string {
+	for name, value := range resolveKinds {
+		if value == kind {
+			return name
+		}
+	}
+	return ""
+}
+
+func MapStringToResolveKind(kindStr string) api.ResolveKind {
+	return resolveKinds[kindStr]
+}
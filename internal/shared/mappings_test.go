@@ -0,0 +1,103 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(string) (any, *api.Message)
+		value string
+		want  any
+		err   string
+	}{
+		{"format", wrap(ParseFormat), "", api.FormatDefault, ""},
+		{"format", wrap(ParseFormat), "esm", api.FormatESModule, ""},
+		{"format", wrap(ParseFormat), "es", api.FormatDefault, `Invalid "format" value "es"`},
+		{"platform", wrap(ParsePlatform), "", api.PlatformBrowser, ""},
+		{"platform", wrap(ParsePlatform), "node", api.PlatformNode, ""},
+		{"platform", wrap(ParsePlatform), "nodejs", api.PlatformBrowser, `Invalid "platform" value "nodejs"`},
+		{"target", wrap(ParseTarget), "", api.DefaultTarget, ""},
+		{"target", wrap(ParseTarget), "es2020", api.ES2020, ""},
+		{"target", wrap(ParseTarget), "ES2020", api.DefaultTarget, `Invalid "target" value "ES2020"`},
+		{"sourcemap", wrap(ParseSourceMap), "", api.SourceMapNone, ""},
+		{"sourcemap", wrap(ParseSourceMap), "both", api.SourceMapInlineAndExternal, ""},
+		{"sourcemap", wrap(ParseSourceMap), "true", api.SourceMapNone, `Invalid "sourcemap" value "true"`},
+		{"packages", wrap(ParsePackages), "external", api.PackagesExternal, ""},
+		{"packages", wrap(ParsePackages), "extern", api.PackagesDefault, `Invalid "packages" value "extern"`},
+		{"legalComments", wrap(ParseLegalComments), "eof", api.LegalCommentsEndOfFile, ""},
+		{"legalComments", wrap(ParseLegalComments), "end", api.LegalCommentsDefault, `Invalid "legalComments" value "end"`},
+		{"logLevel", wrap(ParseLogLevel), "", api.LogLevelSilent, ""},
+		{"logLevel", wrap(ParseLogLevel), "warning", api.LogLevelWarning, ""},
+		{"logLevel", wrap(ParseLogLevel), "warn", api.LogLevelSilent, `Invalid "logLevel" value "warn"`},
+		{"loader", wrap(ParseLoader), "", api.LoaderJS, ""},
+		{"loader", wrap(ParseLoader), "tsx", api.LoaderTSX, ""},
+		{"loader", wrap(ParseLoader), "typescript", api.LoaderNone, `Invalid loader "typescript"`},
+		{"loader", wrap(ParseLoader), "TSX", api.LoaderNone, `Invalid loader "TSX"`},
+	}
+	for _, test := range tests {
+		got, msg := test.parse(test.value)
+		if got != test.want {
+			t.Errorf("%s %q = %v, want %v", test.name, test.value, got, test.want)
+		}
+		switch {
+		case test.err == "" && msg != nil:
+			t.Errorf("%s %q: unexpected error %q", test.name, test.value, msg.Text)
+		case test.err != "" && msg == nil:
+			t.Errorf("%s %q: expected an error", test.name, test.value)
+		case test.err != "":
+			if msg.Text != test.err || msg.ID != InvalidOptionsID || len(msg.Notes) != 1 {
+				t.Errorf("%s %q: error = %+v, want %q with a note listing the valid values", test.name, test.value, msg, test.err)
+			}
+		}
+	}
+}
+
+// wrap adapts a parse function to the table of TestParseOptions.
+func wrap[T any](parse func(string) (T, *api.Message)) func(string) (any, *api.Message) {
+	return func(value string) (any, *api.Message) {
+		return parse(value)
+	}
+}
+
+func TestParseLoaderMap(t *testing.T) {
+	loaders, errors := ParseLoaderMap(map[string]string{".svg": "text", ".yml": "yaml", ".x": "nope", ".y": "css"})
+	if want := map[string]api.Loader{".svg": api.LoaderText, ".y": api.LoaderCSS}; !reflect.DeepEqual(loaders, want) {
+		t.Errorf("loaders = %v, want %v", loaders, want)
+	}
+	if len(errors) != 1 || errors[0].Text != `Invalid loader "nope" for extension ".x"` {
+		t.Errorf("errors = %+v", errors)
+	}
+	if want := map[string]string{".yml": "yaml"}; !reflect.DeepEqual(PluginLoaderMap(map[string]string{".yml": "yaml", ".y": "css"}), want) {
+		t.Errorf("PluginLoaderMap doesn't keep only the plugin loaders")
+	}
+}
+
+func TestParseLogOverride(t *testing.T) {
+	overrides, errors := ParseLogOverride(map[string]string{"direct-eval": "error", "empty-import-meta": "silent", "x": "loud"})
+	want := map[string]api.LogLevel{"direct-eval": api.LogLevelError, "empty-import-meta": api.LogLevelSilent}
+	if !reflect.DeepEqual(overrides, want) {
+		t.Errorf("overrides = %v, want %v", overrides, want)
+	}
+	if len(errors) != 1 || errors[0].Text != `Invalid "logOverride" value "loud" for "x"` {
+		t.Errorf("errors = %+v", errors)
+	}
+}
+
+func TestResolveKinds(t *testing.T) {
+	for name, kind := range resolveKinds {
+		if got := MapResolveKindToString(kind); got != name {
+			t.Errorf("MapResolveKindToString(%v) = %q, want %q", kind, got, name)
+		}
+		if got := MapStringToResolveKind(name); got != kind {
+			t.Errorf("MapStringToResolveKind(%q) = %v, want %v", name, got, kind)
+		}
+	}
+	if got := MapResolveKindToString(api.ResolveNone); got != "" {
+		t.Errorf("MapResolveKindToString(ResolveNone) = %q", got)
+	}
+}
@@ -0,0 +1,116 @@
+package shared
+
+import "github.com/evanw/esbuild/pkg/api"
+
+// InvalidRequestID is the message ID of errors reported for requests that
+// can't be decoded.
+const InvalidRequestID = "invalid-request"
+
+// NewRequestError creates the error message for a request that can't be
+// decoded.
+func NewRequestError(text string) api.Message {
+	return api.Message{ID: InvalidRequestID, Text: text}
+}
+
+// Message is the JSON shape of the errors and warnings exchanged with
+// Python. It holds the same information as esbuild's messages, under the
+// camelCase names of the JavaScript API rather than the Go field names that
+// api.Message would be serialized with, so that it stays stable across
+// esbuild versions.
+type Message struct {
+	ID         string    `json:"id"`
+	PluginName string    `json:"pluginName"`
+	Text       string    `json:"text"`
+	Location   *Location `json:"location"`
+	Notes      []Note    `json:"notes"`
+}
+
+// Location points at the source of a message. Lines start at 1 and columns
+// at 0, counted in bytes, and Length is that of the highlighted text.
+type Location struct {
+	File       string `json:"file"`
+	Namespace  string `json:"namespace"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+	Length     int    `json:"length"`
+	LineText   string `json:"lineText"`
+	Suggestion string `json:"suggestion"`
+}
+
+// Note adds information to a message, possibly about another location.
+type Note struct {
+	Text     string    `json:"text"`
+	Location *Location `json:"location"`
+}
+
+// NewMessages converts esbuild's messages into their JSON shape. The result
+// is never nil, so that it's serialized as an empty list.
+func NewMessages(messages []api.Message) []Message {
+	result := make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		notes := make([]Note, 0, len(msg.Notes))
+		for _, note := range msg.Notes {
+			notes = append(notes, Note{Text: note.Text, Location: newLocation(note.Location)})
+		}
+		result = append(result, Message{
+			ID:         msg.ID,
+			PluginName: msg.PluginName,
+			Text:       msg.Text,
+			Location:   newLocation(msg.Location),
+			Notes:      notes,
+		})
+	}
+	return result
+}
+
+func newLocation(location *api.Location) *Location {
+	if location == nil {
+		return nil
+	}
+	return &Location{
+		File:       location.File,
+		Namespace:  location.Namespace,
+		Line:       location.Line,
+		Column:     location.Column,
+		Length:     location.Length,
+		LineText:   location.LineText,
+		Suggestion: location.Suggestion,
+	}
+}
+
+// APIMessages converts messages received from Python into esbuild's.
+func APIMessages(messages []Message) []api.Message {
+	if len(messages) == 0 {
+		return nil
+	}
+	result := make([]api.Message, 0, len(messages))
+	for _, msg := range messages {
+		notes := make([]api.Note, 0, len(msg.Notes))
+		for _, note := range msg.Notes {
+			notes = append(notes, api.Note{Text: note.Text, Location: apiLocation(note.Location)})
+		}
+		result = append(result, api.Message{
+			ID:         msg.ID,
+			PluginName: msg.PluginName,
+			Text:       msg.Text,
+			Location:   apiLocation(msg.Location),
+			Notes:      notes,
+		})
+	}
+	return result
+}
+
+func apiLocation(location *Location) *api.Location {
+	if location == nil {
+		return nil
+	}
+	return &api.Location{
+		File:       location.File,
+		Namespace:  location.Namespace,
+		Line:       location.Line,
+		Column:     location.Column,
+		Length:     location.Length,
+		LineText:   location.LineText,
+		Suggestion: location.Suggestion,
+	}
+}
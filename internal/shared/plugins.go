@@ -0,0 +1,133 @@
+package shared
+
+import (
+	"encoding/json"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// PluginRequest declares a plugin implemented in Python. esbuild needs to
+// know the hooks of a plugin before the build starts, so they are declared
+// in the build request, and each call of a hook is forwarded to Python.
+type PluginRequest struct {
+	Name      string              `json:"name"`
+	OnResolve []PluginHookRequest `json:"onResolve"`
+	OnLoad    []PluginHookRequest `json:"onLoad"`
+
+	// OnStart and OnEnd ask for the calls made when each build starts and
+	// ends.
+	OnStart bool `json:"onStart"`
+	OnEnd   bool `json:"onEnd"`
+
+	// OnDispose asks for a call when the build or context is disposed, so
+	// the plugin can release its resources.
+	OnDispose bool `json:"onDispose"`
+}
+
+// PluginHookRequest declares an onResolve or onLoad hook, with the same
+// options as in the JavaScript API.
+type PluginHookRequest struct {
+	Filter    string `json:"filter"`
+	Namespace string `json:"namespace"`
+}
+
+// PluginCall is sent to Python whenever a hook of a Python plugin is called.
+// The hook is identified by its kind ("onResolve", "onLoad", "onStart",
+// "onEnd" or "onDispose"), the name of its plugin and, for onResolve and onLoad, its index
+// among the plugin's hooks of that kind.
+type PluginCall struct {
+	Hook   string `json:"hook"`
+	Plugin string `json:"plugin"`
+	Index  int    `json:"index"`
+
+	// Build identifies the plugin's build, for plugin_resolve.
+	Build uint64 `json:"build"`
+
+	Path       string            `json:"path,omitempty"`
+	Importer   string            `json:"importer,omitempty"`
+	Namespace  string            `json:"namespace,omitempty"`
+	ResolveDir string            `json:"resolveDir,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Suffix     string            `json:"suffix,omitempty"`
+	PluginData json.RawMessage   `json:"pluginData,omitempty"`
+	With       map[string]string `json:"with,omitempty"`
+
+	// Result is the outcome of the build, for onEnd.
+	Result *PluginBuildResult `json:"result,omitempty"`
+}
+
+// PluginBuildResult describes a finished build to onEnd hooks.
+type PluginBuildResult struct {
+	Errors   []Message `json:"errors"`
+	Warnings []Message `json:"warnings"`
+
+	// Metafile describes the inputs and outputs of the build.
+	Metafile string `json:"metafile,omitempty"`
+
+	// OutputFiles lists the paths of the output files.
+	OutputFiles []string `json:"outputFiles"`
+}
+
+// NewPluginBuildResult converts the result of a build for onEnd hooks.
+func NewPluginBuildResult(result *api.BuildResult) *PluginBuildResult {
+	pluginResult := &PluginBuildResult{
+		Errors:      NewMessages(result.Errors),
+		Warnings:    NewMessages(result.Warnings),
+		Metafile:    result.Metafile,
+		OutputFiles: make([]string, 0, len(result.OutputFiles)),
+	}
+	for _, file := range result.OutputFiles {
+		pluginResult.OutputFiles = append(pluginResult.OutputFiles, file.Path)
+	}
+	return pluginResult
+}
+
+// PluginResult is the answer of a Python hook. An empty result lets esbuild
+// carry on with the next plugin, as when a JavaScript hook returns nothing.
+// onStart and onEnd hooks may only return errors and warnings, which are
+// added to those of the build, and the result of onDispose is ignored.
+type PluginResult struct {
+	Errors   []Message `json:"errors"`
+	Warnings []Message `json:"warnings"`
+
+	// Fields of onResolve results.
+	Path        string `json:"path"`
+	External    bool   `json:"external"`
+	SideEffects *bool  `json:"sideEffects"`
+	Namespace   string `json:"namespace"`
+	Suffix      string `json:"suffix"`
+
+	// Fields of onLoad results.
+	Contents   *string `json:"contents"`
+	ResolveDir string  `json:"resolveDir"`
+	Loader     string  `json:"loader"`
+
+	PluginData json.RawMessage `json:"pluginData"`
+	WatchFiles []string        `json:"watchFiles"`
+	WatchDirs  []string        `json:"watchDirs"`
+}
+
+// PluginResolveRequest asks esbuild to resolve a path on behalf of a Python
+// plugin, with the options of `build.resolve` in the JavaScript API.
+type PluginResolveRequest struct {
+	Path       string            `json:"path"`
+	Importer   string            `json:"importer"`
+	Namespace  string            `json:"namespace"`
+	ResolveDir string            `json:"resolveDir"`
+	Kind       string            `json:"kind"`
+	PluginData json.RawMessage   `json:"pluginData"`
+	With       map[string]string `json:"with"`
+}
+
+// PluginResolveResponse is the outcome of a PluginResolveRequest.
+type PluginResolveResponse struct {
+	Errors   []Message `json:"errors"`
+	Warnings []Message `json:"warnings"`
+
+	Path        string          `json:"path"`
+	External    bool            `json:"external"`
+	SideEffects bool            `json:"sideEffects"`
+	Namespace   string          `json:"namespace"`
+	Suffix      string          `json:"suffix"`
+	PluginData  json.RawMessage `json:"pluginData,omitempty"`
+}
@@ -0,0 +1,346 @@
+package shared
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BuildReport holds the analyses of the module graph of a build.
+type BuildReport struct {
+	// DuplicatePackages lists the packages bundled from several copies.
+	DuplicatePackages []DuplicatePackage `json:"duplicatePackages"`
+
+	// Cycles lists the groups of modules that import each other.
+	Cycles []ImportCycle `json:"cycles"`
+
+	// UnusedInputs lists the modules that were bundled but left nothing in
+	// the outputs, since tree shaking removed all their code.
+	UnusedInputs []string `json:"unusedInputs"`
+}
+
+// DuplicatePackage is a package of which several copies were bundled,
+// usually different versions installed in nested node_modules directories.
+type DuplicatePackage struct {
+	Name   string        `json:"name"`
+	Copies []PackageCopy `json:"copies"`
+}
+
+// PackageCopy is one of the copies of a duplicate package.
+type PackageCopy struct {
+	// Path is the directory of the copy, relative to the working directory.
+	Path    string `json:"path"`
+	Version string `json:"version,omitempty"`
+
+	// BytesInOutput is the size of the modules of the copy in the outputs.
+	BytesInOutput int `json:"bytesInOutput"`
+
+	// ImportChain is the shortest chain of imports from an entry point to a
+	// module of the copy.
+	ImportChain []string `json:"importChain"`
+}
+
+// ImportCycle is a group of modules that import each other, directly or
+// not, so that one of them runs before the modules it imports have been
+// initialized.
+type ImportCycle struct {
+	// Files are the modules taking part in the cycle.
+	Files []string `json:"files"`
+
+	// Chain is the shortest chain of imports from the first of the files
+	// back to itself.
+	Chain []string `json:"chain"`
+}
+
+// NewBuildReport analyzes the module graph described by a metafile, whose
+// paths are relative to workingDir.
+func NewBuildReport(metafile string, workingDir string) *BuildReport {
+	graph := NewModuleGraph(metafile)
+	var parsed struct {
+		Outputs map[string]struct {
+			EntryPoint string `json:"entryPoint"`
+		} `json:"outputs"`
+	}
+	if graph == nil || json.Unmarshal([]byte(metafile), &parsed) != nil {
+		return nil
+	}
+	var entryPoints []string
+	for _, output := range parsed.Outputs {
+		if output.EntryPoint != "" {
+			entryPoints = append(entryPoints, output.EntryPoint)
+		}
+	}
+	chains := importChains(graph, entryPoints)
+	return &BuildReport{
+		DuplicatePackages: duplicatePackages(graph, chains, workingDir),
+		Cycles:            importCycles(graph),
+		UnusedInputs:      unusedInputs(graph, entryPoints),
+	}
+}
+
+// importChains finds the shortest chain of imports from an entry point to
+// each module of the graph, by a breadth-first search.
+func importChains(graph map[string]GraphNode, entryPoints []string) map[string][]string {
+	sort.Strings(entryPoints)
+	chains := make(map[string][]string, len(graph))
+	queue := make([]string, 0, len(graph))
+	for _, entry := range entryPoints {
+		if _, ok := chains[entry]; !ok {
+			chains[entry] = []string{entry}
+			queue = append(queue, entry)
+		}
+	}
+	for len(queue) > 0 {
+		module := queue[0]
+		queue = queue[1:]
+		for _, imported := range graph[module].Imports {
+			if _, ok := graph[imported.Path]; !ok || imported.External {
+				continue
+			}
+			if _, ok := chains[imported.Path]; ok {
+				continue
+			}
+			chain := make([]string, len(chains[module]), len(chains[module])+1)
+			copy(chain, chains[module])
+			chains[imported.Path] = append(chain, imported.Path)
+			queue = append(queue, imported.Path)
+		}
+	}
+	return chains
+}
+
+// packageDir returns the name of the package that a module belongs to and
+// the directory of the package, or empty strings if it isn't in a
+// node_modules directory.
+func packageDir(module string) (name string, dir string) {
+	index := strings.LastIndex(module, "node_modules/")
+	if index < 0 {
+		return "", ""
+	}
+	start := index + len("node_modules/")
+	parts := strings.SplitN(module[start:], "/", 3)
+	count := 1
+	if strings.HasPrefix(parts[0], "@") {
+		count = 2
+	}
+	if len(parts) <= count {
+		return "", ""
+	}
+	name = strings.Join(parts[:count], "/")
+	return name, module[:start+len(name)]
+}
+
+// duplicatePackages finds the packages of which modules were bundled from
+// several directories.
+func duplicatePackages(graph map[string]GraphNode, chains map[string][]string, workingDir string) []DuplicatePackage {
+	copies := make(map[string]map[string]*PackageCopy)
+	for module, node := range graph {
+		name, dir := packageDir(module)
+		if name == "" {
+			continue
+		}
+		if copies[name] == nil {
+			copies[name] = make(map[string]*PackageCopy)
+		}
+		packageCopy := copies[name][dir]
+		if packageCopy == nil {
+			packageCopy = &PackageCopy{Path: dir, Version: packageVersion(filepath.Join(workingDir, dir))}
+			copies[name][dir] = packageCopy
+		}
+		packageCopy.BytesInOutput += node.BytesInOutput
+		chain, ok := chains[module]
+		if ok && (packageCopy.ImportChain == nil || len(chain) < len(packageCopy.ImportChain) ||
+			len(chain) == len(packageCopy.ImportChain) && module < packageCopy.ImportChain[len(chain)-1]) {
+			packageCopy.ImportChain = chain
+		}
+	}
+
+	duplicates := make([]DuplicatePackage, 0)
+	for _, name := range sortedKeys(copies) {
+		if len(copies[name]) < 2 {
+			continue
+		}
+		duplicate := DuplicatePackage{Name: name}
+		for _, dir := range sortedKeys(copies[name]) {
+			packageCopy := copies[name][dir]
+			if packageCopy.ImportChain == nil {
+				packageCopy.ImportChain = make([]string, 0)
+			}
+			duplicate.Copies = append(duplicate.Copies, *packageCopy)
+		}
+		duplicates = append(duplicates, duplicate)
+	}
+	return duplicates
+}
+
+// packageVersion reads the version of the package in a directory.
+func packageVersion(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return ""
+	}
+	var manifest struct {
+		Version string `json:"version"`
+	}
+	json.Unmarshal(data, &manifest)
+	return manifest.Version
+}
+
+// staticImport tells whether an import runs the imported module before the
+// importing one, which is what makes cycles harmful.
+func staticImport(edge GraphEdge) bool {
+	return !edge.External && (edge.Kind == "import-statement" || edge.Kind == "require-call")
+}
+
+// importCycles finds the strongly connected components of the graph of
+// static imports, with Tarjan's algorithm, and reports those that form a
+// cycle.
+func importCycles(graph map[string]GraphNode) []ImportCycle {
+	index := make(map[string]int, len(graph))
+	lowLink := make(map[string]int, len(graph))
+	onStack := make(map[string]bool)
+	var stack []string
+	cycles := make([]ImportCycle, 0)
+
+	var visit func(module string)
+	visit = func(module string) {
+		index[module] = len(index)
+		lowLink[module] = index[module]
+		stack = append(stack, module)
+		onStack[module] = true
+		selfImport := false
+		for _, edge := range graph[module].Imports {
+			if _, ok := graph[edge.Path]; !ok || !staticImport(edge) {
+				continue
+			}
+			if edge.Path == module {
+				selfImport = true
+			}
+			if _, visited := index[edge.Path]; !visited {
+				visit(edge.Path)
+				lowLink[module] = min(lowLink[module], lowLink[edge.Path])
+			} else if onStack[edge.Path] {
+				lowLink[module] = min(lowLink[module], index[edge.Path])
+			}
+		}
+		if lowLink[module] != index[module] {
+			return
+		}
+		var files []string
+		for {
+			last := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[last] = false
+			files = append(files, last)
+			if last == module {
+				break
+			}
+		}
+		if len(files) > 1 || selfImport {
+			sort.Strings(files)
+			cycles = append(cycles, ImportCycle{Files: files, Chain: shortestCycle(graph, files)})
+		}
+	}
+	for _, module := range sortedKeys(graph) {
+		if _, visited := index[module]; !visited {
+			visit(module)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i].Files[0] < cycles[j].Files[0] })
+	return cycles
+}
+
+// shortestCycle finds the shortest chain of static imports from the first
+// of the files of a cycle back to itself, through the others.
+func shortestCycle(graph map[string]GraphNode, files []string) []string {
+	inCycle := make(map[string]bool, len(files))
+	for _, file := range files {
+		inCycle[file] = true
+	}
+	start := files[0]
+	parents := map[string]string{start: ""}
+	queue := []string{start}
+	for len(queue) > 0 {
+		module := queue[0]
+		queue = queue[1:]
+		for _, edge := range graph[module].Imports {
+			if !inCycle[edge.Path] || !staticImport(edge) {
+				continue
+			}
+			if edge.Path == start {
+				chain := []string{start}
+				for m := module; m != start; m = parents[m] {
+					chain = append(chain, m)
+				}
+				chain = append(chain, start)
+				// The chain was built backwards.
+				for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+					chain[i], chain[j] = chain[j], chain[i]
+				}
+				return chain
+			}
+			if _, seen := parents[edge.Path]; !seen {
+				parents[edge.Path] = module
+				queue = append(queue, edge.Path)
+			}
+		}
+	}
+	return files
+}
+
+// unusedInputs lists the modules with no bytes in any output. Entry points
+// are left out, since they may only import other modules.
+func unusedInputs(graph map[string]GraphNode, entryPoints []string) []string {
+	isEntryPoint := make(map[string]bool, len(entryPoints))
+	for _, entry := range entryPoints {
+		isEntryPoint[entry] = true
+	}
+	unused := make([]string, 0)
+	for _, module := range sortedKeys(graph) {
+		if graph[module].BytesInOutput == 0 && !isEntryPoint[module] {
+			unused = append(unused, module)
+		}
+	}
+	return unused
+}
+
+// ModuleSize is the share of an output taken by one of its inputs.
+type ModuleSize struct {
+	Path          string `json:"path"`
+	BytesInOutput int    `json:"bytesInOutput"`
+}
+
+// NewTopModules lists the n inputs that take the most bytes in each output
+// of a build, largest first.
+func NewTopModules(metafile string, n int) map[string][]ModuleSize {
+	var parsed struct {
+		Outputs map[string]struct {
+			Inputs map[string]struct {
+				BytesInOutput int `json:"bytesInOutput"`
+			} `json:"inputs"`
+		} `json:"outputs"`
+	}
+	if err := json.Unmarshal([]byte(metafile), &parsed); err != nil {
+		return nil
+	}
+	top := make(map[string][]ModuleSize)
+	for path, output := range parsed.Outputs {
+		if len(output.Inputs) == 0 {
+			continue
+		}
+		modules := make([]ModuleSize, 0, len(output.Inputs))
+		for input, info := range output.Inputs {
+			modules = append(modules, ModuleSize{Path: input, BytesInOutput: info.BytesInOutput})
+		}
+		sort.Slice(modules, func(i, j int) bool {
+			if modules[i].BytesInOutput != modules[j].BytesInOutput {
+				return modules[i].BytesInOutput > modules[j].BytesInOutput
+			}
+			return modules[i].Path < modules[j].Path
+		})
+		top[path] = modules[:min(n, len(modules))]
+	}
+	return top
+}
@@ -0,0 +1,56 @@
+package shared
+
+// ServeRequest holds the options of the context_serve export.
+type ServeRequest struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Servedir string `json:"servedir"`
+
+	// Fallback is the HTML file served for paths that match neither an
+	// output nor a file in servedir, e.g. the index.html of a single page app
+	// with client-side routing.
+	Fallback string `json:"fallback"`
+
+	// Proxy is the URL of a server that receives the requests that don't
+	// match an output or a file in servedir, e.g. "http://localhost:8000"
+	// for the backend of the app, so both can be used from a single origin.
+	Proxy string `json:"proxy"`
+
+	// Headers are added to every response, e.g.
+	// {"Access-Control-Allow-Origin": "*"} to allow other origins to load
+	// the outputs.
+	Headers map[string]string `json:"headers"`
+
+	// LiveReload streams a `change` event to browsers after every rebuild
+	// that changes outputs, at LiveReloadPath ("/esbuild" by default). A
+	// page reloads itself with
+	// `new EventSource("/esbuild").addEventListener("change", () => location.reload())`.
+	LiveReload     bool   `json:"liveReload"`
+	LiveReloadPath string `json:"liveReloadPath"`
+
+	// InjectReloadClient adds the snippet above to the JS outputs, using the
+	// banner, when live reload is enabled.
+	InjectReloadClient bool `json:"injectReloadClient"`
+
+	// Keyfile and Certfile are the PEM files of the TLS key and certificate
+	// used to serve over HTTPS.
+	Keyfile  string `json:"keyfile"`
+	Certfile string `json:"certfile"`
+}
+
+// ServeInfo describes where a context's dev server is listening.
+type ServeInfo struct {
+	Hosts []string `json:"hosts"`
+	Port  int      `json:"port"`
+}
+
+// ServeLogEntry describes a request handled by a dev server.
+type ServeLogEntry struct {
+	RemoteAddress string `json:"remoteAddress"`
+	Method        string `json:"method"`
+	Path          string `json:"path"`
+	Status        int    `json:"status"`
+
+	// TimeMs is the time taken to generate the response, not to send it.
+	TimeMs int `json:"timeMs"`
+}
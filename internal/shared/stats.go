@@ -0,0 +1,19 @@
+package shared
+
+// Stats is the JSON response of the stats export, describing the state of
+// the embedded Go runtime.
+type Stats struct {
+	// HeapAlloc and HeapSys are the bytes of allocated heap objects and of
+	// heap memory obtained from the OS.
+	HeapAlloc uint64 `json:"heapAlloc"`
+	HeapSys   uint64 `json:"heapSys"`
+
+	// Active and Queued count the builds and transforms that are running
+	// and that are waiting for the concurrency limit.
+	Active int `json:"active"`
+	Queued int `json:"queued"`
+
+	Builds      int64 `json:"builds"`
+	BuildTimeMs int64 `json:"buildTimeMs"`
+	Transforms  int64 `json:"transforms"`
+}
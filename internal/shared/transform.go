@@ -0,0 +1,112 @@
+package shared
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/evanw/esbuild/pkg/api"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// TransformRequest is used to unmarshal the JSON from Python for the transform API.
+// We use this intermediate struct because enum fields like `Loader` in
+// `api.TransformOptions` are strings in JSON and require manual mapping.
+type TransformRequest struct {
+	Code    string                  `json:"code"`
+	Options TransformOptionsRequest `json:"options"`
+}
+
+// DecodeTransformRequest decodes a transform request in the given encoding.
+// With MessagePack, the source code is decoded directly and only the small
+// options object goes through JSON.
+func DecodeTransformRequest(data []byte, encoding Encoding) (TransformRequest, error) {
+	var req TransformRequest
+	if encoding != EncodingMessagePack {
+		err := encoding.Unmarshal(data, &req)
+		return req, err
+	}
+
+	var raw struct {
+		Code    string             `msgpack:"code"`
+		Options msgpack.RawMessage `msgpack:"options"`
+	}
+	if err := msgpack.Unmarshal(data, &raw); err != nil {
+		return req, err
+	}
+	req.Code = raw.Code
+	if len(raw.Options) > 0 {
+		if err := encoding.Unmarshal(raw.Options, &req.Options); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// TransformOptionsRequest is used to unmarshal the JSON transform options
+// from Python. Like BuildRequest, it embeds `api.TransformOptions` so plain
+// fields are decoded directly and shadows enum fields with strings.
+type TransformOptionsRequest struct {
+	api.TransformOptions
+
+	Loader   string `json:"loader"`
+	Platform string `json:"platform"`
+	Format   string `json:"format"`
+	Target   string `json:"target"`
+	LogLevel string `json:"logLevel"`
+
+	LegalComments string `json:"legalComments"`
+
+	LogOverride map[string]string `json:"logOverride"`
+
+	// TimeoutMs aborts the operation after the given number of milliseconds.
+	// Zero means no timeout.
+	TimeoutMs int `json:"timeoutMs"`
+
+	// unknownFields lists the keys of the request that don't match any
+	// option, so typos can be reported instead of silently doing nothing.
+	unknownFields []string
+}
+
+// UnmarshalJSON decodes the request and records any unrecognized keys.
+func (r *TransformOptionsRequest) UnmarshalJSON(data []byte) error {
+	type plain TransformOptionsRequest
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.unknownFields = unknownFields(data, reflect.TypeOf(*r))
+	return nil
+}
+
+// UnknownOptionWarnings returns a warning for each unrecognized option.
+func (r *TransformOptionsRequest) UnknownOptionWarnings() []api.Message {
+	return unknownOptionWarnings(r.unknownFields, reflect.TypeOf(*r))
+}
+
+// ToTransformOptions converts the request into the options understood by
+// esbuild's Transform API. Any problems with the request are returned as
+// error messages, in the same shape as esbuild's own errors.
+func (r *TransformOptionsRequest) ToTransformOptions() (api.TransformOptions, []api.Message) {
+	options := r.TransformOptions
+
+	loader, msg := ParseLoader(r.Loader)
+	if msg != nil {
+		return options, []api.Message{*msg}
+	}
+	options.Loader = loader
+
+	var errors []api.Message
+	options.Platform, msg = ParsePlatform(r.Platform)
+	errors = appendMessage(errors, msg)
+	options.Format, msg = ParseFormat(r.Format)
+	errors = appendMessage(errors, msg)
+	options.Target, msg = ParseTarget(r.Target)
+	errors = appendMessage(errors, msg)
+	options.LegalComments, msg = ParseLegalComments(r.LegalComments)
+	errors = appendMessage(errors, msg)
+	options.LogLevel, msg = ParseLogLevel(r.LogLevel)
+	errors = appendMessage(errors, msg)
+	logOverride, overrideErrors := ParseLogOverride(r.LogOverride)
+	options.LogOverride = logOverride
+	errors = append(errors, overrideErrors...)
+	return options, errors
+}
@@ -0,0 +1,119 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// UnknownOptionID is the message ID of warnings about unrecognized options.
+const UnknownOptionID = "unknown-option"
+
+// unknownFields returns the keys of a JSON object that don't correspond to
+// any field of the struct type t, using the same case-insensitive matching
+// as encoding/json. Keys are returned in sorted order.
+func unknownFields(data []byte, t reflect.Type) []string {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil
+	}
+	known := knownFields(t)
+	var unknown []string
+	for key := range object {
+		if _, ok := known[strings.ToLower(key)]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// knownFields maps the lowercased JSON names of the fields of a struct type,
+// including promoted fields of embedded structs, to their camelCase form.
+func knownFields(t reflect.Type) map[string]string {
+	known := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for key, name := range knownFields(field.Type) {
+				known[key] = name
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		known[strings.ToLower(name)] = lowerFirst(name)
+	}
+	return known
+}
+
+func lowerFirst(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
+
+// unknownOptionWarnings creates a warning for each unrecognized option, with
+// a note suggesting the closest known option when there is a likely typo.
+func unknownOptionWarnings(unknown []string, t reflect.Type) []api.Message {
+	if len(unknown) == 0 {
+		return nil
+	}
+	known := knownFields(t)
+	warnings := make([]api.Message, 0, len(unknown))
+	for _, key := range unknown {
+		msg := api.Message{
+			ID:   UnknownOptionID,
+			Text: fmt.Sprintf("Unknown option %q was ignored", key),
+		}
+		if suggestion := closestName(strings.ToLower(key), known); suggestion != "" {
+			msg.Notes = []api.Note{{Text: fmt.Sprintf("Did you mean %q?", suggestion)}}
+		}
+		warnings = append(warnings, msg)
+	}
+	return warnings
+}
+
+// closestName returns the known name within a small edit distance of key.
+func closestName(key string, known map[string]string) string {
+	best, bestDistance := "", len(key)/3+1
+	for lower, name := range known {
+		distance := editDistance(key, lower)
+		if distance < bestDistance || (distance == bestDistance && best != "" && name < best) {
+			best, bestDistance = name, distance
+		}
+	}
+	return best
+}
+
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
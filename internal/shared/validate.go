@@ -0,0 +1,83 @@
+package shared
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// InvalidOptionsID is the message ID of errors reported for invalid
+// combinations of options, before esbuild itself is invoked.
+const InvalidOptionsID = "invalid-options"
+
+// NewOptionsError creates an error message for an invalid combination of
+// options, with a note suggesting how to fix it.
+func NewOptionsError(text string, suggestion string) api.Message {
+	return api.Message{
+		ID:    InvalidOptionsID,
+		Text:  text,
+		Notes: []api.Note{{Text: suggestion}},
+	}
+}
+
+// validateBuildOptions checks for combinations of options that esbuild
+// rejects with a generic message, and reports them with an actionable one.
+func validateBuildOptions(options api.BuildOptions) []api.Message {
+	var errors []api.Message
+
+	entryPointCount := len(options.EntryPoints) + len(options.EntryPointsAdvanced)
+	if options.Stdin != nil {
+		entryPointCount++
+	}
+	if options.Outfile != "" && entryPointCount > 1 {
+		errors = append(errors, NewOptionsError(
+			"Cannot use \"outfile\" with multiple entry points",
+			"Use \"outdir\" instead so that each entry point gets its own output file."))
+	}
+
+	if options.Splitting {
+		if options.Format != api.FormatESModule {
+			errors = append(errors, NewOptionsError(
+				"Code splitting only works with the \"esm\" format",
+				"Set \"format\" to \"esm\", or remove \"splitting\"."))
+		}
+		if options.Outdir == "" {
+			errors = append(errors, NewOptionsError(
+				"Code splitting requires \"outdir\" to be set",
+				"Replace \"outfile\" with \"outdir\", since splitting produces several output files."))
+		}
+	}
+
+	return errors
+}
+
+// validatePlugins checks the filters of the hooks of Python plugins. esbuild
+// matches them in Go, so that Python is only called for the paths a hook
+// handles, which means they use Go's regular expression syntax rather than
+// Python's or JavaScript's.
+func validatePlugins(plugins []PluginRequest) []api.Message {
+	var errors []api.Message
+	check := func(plugin string, hook string, filter string) {
+		if filter == "" {
+			errors = append(errors, NewOptionsError(
+				fmt.Sprintf("The %s hook of plugin %q has no filter", hook, plugin),
+				"Use \".*\" to match every path, although a narrower filter saves a call into Python for every import."))
+			return
+		}
+		if _, err := regexp.Compile(filter); err != nil {
+			errors = append(errors, NewOptionsError(
+				fmt.Sprintf("The filter %q of the %s hook of plugin %q is not a valid Go regular expression: %v", filter, hook, plugin, err),
+				"Go regular expressions don't support lookarounds or backreferences. Use a broader filter and check the path in Python instead."))
+		}
+	}
+	for _, plugin := range plugins {
+		for _, hook := range plugin.OnResolve {
+			check(plugin.Name, "onResolve", hook.Filter)
+		}
+		for _, hook := range plugin.OnLoad {
+			check(plugin.Name, "onLoad", hook.Filter)
+		}
+	}
+	return errors
+}
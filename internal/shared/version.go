@@ -0,0 +1,41 @@
+package shared
+
+import (
+	"runtime/debug"
+	"strings"
+)
+
+// BindingVersion is the version of the esbuild-py bindings. It should be
+// kept in sync with `__version__` in the Python package.
+const BindingVersion = "0.2.0"
+
+const esbuildModulePath = "github.com/evanw/esbuild"
+
+// VersionInfo is the JSON response of the version export.
+type VersionInfo struct {
+	Esbuild  string `json:"esbuild"`
+	Bindings string `json:"bindings"`
+	Protocol int    `json:"protocol"`
+}
+
+// NewVersionInfo reports the version of the embedded esbuild library, read
+// from the module information compiled into the binary.
+func NewVersionInfo() *VersionInfo {
+	info := &VersionInfo{
+		Esbuild:  "unknown",
+		Bindings: BindingVersion,
+		Protocol: ProtocolVersion,
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range buildInfo.Deps {
+			if dep.Path == esbuildModulePath {
+				if dep.Replace != nil {
+					dep = dep.Replace
+				}
+				info.Esbuild = strings.TrimPrefix(dep.Version, "v")
+				break
+			}
+		}
+	}
+	return info
+}
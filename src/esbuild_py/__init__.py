@@ -1,13 +1,16 @@
 import logging
+import os
 
 # Public API
-__all__ = ["transform", "BACKEND", "__version__"]
+__all__ = ["transform", "build", "analyze_metafile", "format_messages", "version", "capabilities", "BACKEND", "__version__"]
 
 # The version of the esbuild-py package.
 __version__ = "0.2.0"
 
 # The backend implementation to use.
 # - "native": The native binary extension.
+# - "daemon": The `esbuild-py --stdio` subprocess named by ESBUILD_PY_DAEMON.
+# - "socket": The `esbuild-py --serve-socket` daemon at ESBUILD_PY_SOCKET.
 # - "wasm": The WebAssembly fallback.
 # - "none": No backend available.
 BACKEND = "none"
@@ -16,27 +19,41 @@ _backend_instance = None
 log = logging.getLogger(__name__)
 
 # --- Backend Initialization ---
-# This section determines which backend (native or WASM) to use.
-
-# 1. Try to import the native C-extension backend first.
-try:
-    from ._native_backend import NativeBackend
-    _backend_instance = NativeBackend()
-    BACKEND = "native"
-
-except (ImportError, FileNotFoundError):
-    # 2. If the native backend fails, fall back to the WASM implementation.
-    log.warning("esbuild-py: Native backend failed to load, attempting WASM fallback.")
+# This section determines which backend (socket, daemon, native or WASM) to use.
+
+# 0. If a daemon is configured, use it instead of loading a library.
+_daemon_path = os.environ.get("ESBUILD_PY_DAEMON")
+_socket_path = os.environ.get("ESBUILD_PY_SOCKET")
+if _socket_path:
+    from ._daemon_backend import SocketBackend
+    _backend_instance = SocketBackend(_socket_path)
+    BACKEND = "socket"
+
+elif _daemon_path:
+    from ._daemon_backend import DaemonBackend
+    _backend_instance = DaemonBackend(_daemon_path)
+    BACKEND = "daemon"
+
+else:
+    # 1. Try to import the native C-extension backend first.
     try:
-        from ._wasm_backend import WasmBackend
-        _backend_instance = WasmBackend()
-        BACKEND = "wasm"
+        from ._native_backend import NativeBackend
+        _backend_instance = NativeBackend()
+        BACKEND = "native"
 
     except (ImportError, FileNotFoundError) as e:
-        # This catches errors if 'wasmtime' is not installed or if 'esbuild.wasm' is missing.
-        log.error(f"esbuild-py: Failed to initialize WASM fallback: {e}")
-        _backend_instance = None
-        BACKEND = "none"
+        # 2. If the native backend fails, fall back to the WASM implementation.
+        log.warning(f"esbuild-py: Native backend failed to load ({e}), attempting WASM fallback.")
+        try:
+            from ._wasm_backend import WasmBackend
+            _backend_instance = WasmBackend()
+            BACKEND = "wasm"
+
+        except (ImportError, FileNotFoundError) as e:
+            # This catches errors if 'wasmtime' is not installed or if 'esbuild.wasm' is missing.
+            log.error(f"esbuild-py: Failed to initialize WASM fallback: {e}")
+            _backend_instance = None
+            BACKEND = "none"
 
 
 def transform(code: str, **kwargs):
@@ -79,7 +96,7 @@ def build(**kwargs) -> dict:
 
     Args:
         **kwargs: esbuild build options, such as `entry_points`, `outfile`,
-                  `bundle`, `minify`, etc.
+                  `bundle`, `minify`, etc., and `plugins` written in Python.
 
     Returns:
         A dictionary containing 'errors' and 'warnings' lists.
@@ -92,4 +109,94 @@ def build(**kwargs) -> dict:
             "No esbuild backend is available. The native library may be missing "
             "or the WASM fallback failed."
         )
+    if kwargs.get('plugins') and BACKEND != "native":
+        raise RuntimeError(f"Python plugins need the native backend, but the {BACKEND} backend is in use.")
     return _backend_instance.build(**kwargs)
+
+
+def analyze_metafile(metafile, verbose: bool = False, color: bool = False) -> str:
+    """
+    Describes the outputs of a build and the input files making them up,
+    largest first, like `esbuild --analyze`.
+
+    Args:
+        metafile: The `metafile` returned by `build(metafile=True)`, as a
+                  JSON string or a dictionary.
+        verbose: Whether to show the import chain of each input file.
+        color: Whether to use ANSI colors.
+
+    Returns:
+        The analysis as a human-readable string.
+
+    Raises:
+        RuntimeError: If the metafile is invalid or no backend is available.
+    """
+    if _backend_instance is None:
+        raise RuntimeError(
+            "No esbuild backend is available. The native library may be missing "
+            "or the WASM fallback failed."
+        )
+    return _backend_instance.analyze_metafile(metafile, verbose=verbose, color=color)
+
+
+def format_messages(messages: list, kind: str = "error", color: bool = False, terminal_width: int = 0) -> list:
+    """
+    Renders errors or warnings the way esbuild prints them, with an excerpt
+    of the source pointing at their location and their notes.
+
+    Args:
+        messages: The `errors` or `warnings` of a response.
+        kind: Either "error" or "warning".
+        color: Whether to use ANSI colors.
+        terminal_width: The number of columns to wrap the messages to.
+
+    Returns:
+        A list with the text of each message.
+
+    Raises:
+        RuntimeError: If the kind is invalid or no backend is available.
+    """
+    if _backend_instance is None:
+        raise RuntimeError(
+            "No esbuild backend is available. The native library may be missing "
+            "or the WASM fallback failed."
+        )
+    return _backend_instance.format_messages(messages, kind=kind, color=color, terminal_width=terminal_width)
+
+
+def version() -> dict:
+    """
+    Returns the versions of the esbuild library embedded in the active
+    backend and of the bindings, which is useful in bug reports.
+
+    Returns:
+        A dictionary with 'esbuild', 'bindings' and 'protocol' keys.
+
+    Raises:
+        RuntimeError: If no backend is available.
+    """
+    if _backend_instance is None:
+        raise RuntimeError(
+            "No esbuild backend is available. The native library may be missing "
+            "or the WASM fallback failed."
+        )
+    return _backend_instance.version()
+
+
+def capabilities() -> dict:
+    """
+    Describes what the active backend supports: the available commands and
+    the accepted values of options such as `loader`, `format` and `target`.
+
+    Returns:
+        A dictionary mapping each category to a list of supported values.
+
+    Raises:
+        RuntimeError: If no backend is available.
+    """
+    if _backend_instance is None:
+        raise RuntimeError(
+            "No esbuild backend is available. The native library may be missing "
+            "or the WASM fallback failed."
+        )
+    return _backend_instance.capabilities()
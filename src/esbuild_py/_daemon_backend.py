@@ -0,0 +1,322 @@
+import atexit
+import json
+import logging
+import os
+import shutil
+import socket
+import struct
+import subprocess
+import threading
+from concurrent.futures import Future
+
+from ._options import request_options
+
+log = logging.getLogger(__name__)
+
+# The length prefix of each frame: a 4-byte big-endian unsigned integer.
+_HEADER = struct.Struct('>I')
+
+# The prefix of the names of Windows named pipes.
+_PIPE_PREFIX = '\\\\.\\pipe\\'
+
+# How long to wait, in milliseconds, while every instance of a named pipe
+# is busy, i.e. until the daemon creates one for the next client.
+_PIPE_WAIT_MS = 5000
+
+
+class _Connection:
+    """
+    The stream of frames exchanged with a daemon. The daemon serves requests
+    concurrently and answers them as they finish, so a background thread
+    reads the responses and hands each one to the request with its ID.
+    """
+
+    def __init__(self, reader, writer):
+        self._reader = reader
+        self._writer = writer
+        # Writing can block until the daemon reads, so it has its own lock,
+        # which the reading thread never waits for.
+        self._write_lock = threading.Lock()
+        self._pending_lock = threading.Lock()
+        self._pending = {}
+        self._next_id = 0
+        self._error = None
+        threading.Thread(target=self._read_responses, name="esbuild-py-daemon", daemon=True).start()
+
+    def send(self, method: str, params=None):
+        """Sends a JSON-RPC request, returning its ID and a Future of its response."""
+        future = Future()
+        with self._pending_lock:
+            if self._error is not None:
+                raise RuntimeError(f"The esbuild-py daemon exited unexpectedly: {self._error}")
+            self._next_id += 1
+            request_id = self._next_id
+            self._pending[request_id] = future
+
+        request = {"jsonrpc": "2.0", "id": request_id, "method": method}
+        if params is not None:
+            request["params"] = params
+        payload = json.dumps(request).encode('utf-8')
+        try:
+            with self._write_lock:
+                self._writer.write(_HEADER.pack(len(payload)) + payload)
+                self._writer.flush()
+        except OSError as e:
+            with self._pending_lock:
+                self._pending.pop(request_id, None)
+            raise RuntimeError(f"The esbuild-py daemon exited unexpectedly: {e}") from e
+        return request_id, future
+
+    def _read_responses(self):
+        """
+        Reads responses until the connection closes or a response can't be
+        read, then fails the requests still waiting, whatever stopped it.
+        """
+        error = EOFError("the connection stopped being read")
+        try:
+            while True:
+                header = self._read_exactly(_HEADER.size)
+                response = json.loads(self._read_exactly(_HEADER.unpack(header)[0]).decode('utf-8'))
+                with self._pending_lock:
+                    future = self._pending.pop(response.get('id'), None)
+                if future is not None:
+                    future.set_result(response)
+        except Exception as e:
+            error = e
+        finally:
+            with self._pending_lock:
+                self._error = error
+                waiting = list(self._pending.values())
+                self._pending.clear()
+            for future in waiting:
+                future.set_exception(RuntimeError(f"The esbuild-py daemon exited unexpectedly: {error}"))
+
+    def close(self):
+        """Closes the reader and the writer."""
+        self._reader.close()
+        if self._writer is not self._reader:
+            self._writer.close()
+
+    def _read_exactly(self, size: int) -> bytes:
+        """Reads `size` bytes from the daemon."""
+        data = b''
+        while len(data) < size:
+            # Unbuffered pipes may return fewer bytes than requested.
+            chunk = self._reader.read(size - len(data))
+            if not chunk:
+                raise EOFError("the connection was closed")
+            data += chunk
+        return data
+
+
+class _OverlappedPipe:
+    """
+    A client end of a Windows named pipe opened for overlapped I/O, so that
+    one thread can wait for responses while others write requests, which
+    would block each other on a file opened with `open()`.
+    """
+
+    def __init__(self, name: str):
+        import _winapi
+        self._winapi = _winapi
+        while True:
+            try:
+                self._handle = _winapi.CreateFile(
+                    name, _winapi.GENERIC_READ | _winapi.GENERIC_WRITE, 0, _winapi.NULL,
+                    _winapi.OPEN_EXISTING, _winapi.FILE_FLAG_OVERLAPPED, _winapi.NULL)
+                return
+            except OSError as e:
+                if e.winerror != _winapi.ERROR_PIPE_BUSY:
+                    raise
+                _winapi.WaitNamedPipe(name, _PIPE_WAIT_MS)
+
+    def read(self, size: int) -> bytes:
+        try:
+            ov, err = self._winapi.ReadFile(self._handle, size, overlapped=True)
+            nread, err = ov.GetOverlappedResult(True)
+        except OSError as e:
+            if e.winerror == self._winapi.ERROR_BROKEN_PIPE:
+                return b''
+            raise
+        if err == self._winapi.ERROR_BROKEN_PIPE:
+            return b''
+        if err:
+            raise OSError(f"Failed to read from the esbuild-py daemon (error {err})")
+        return bytes(ov.getbuffer()[:nread])
+
+    def write(self, data: bytes):
+        while data:
+            ov, err = self._winapi.WriteFile(self._handle, data, overlapped=True)
+            nwritten, err = ov.GetOverlappedResult(True)
+            if err:
+                raise OSError(f"Failed to write to the esbuild-py daemon (error {err})")
+            data = data[nwritten:]
+
+    def flush(self):
+        pass
+
+    def close(self):
+        # The pipe is both the reader and the socket of its connection.
+        if self._handle is not None:
+            self._winapi.CloseHandle(self._handle)
+            self._handle = None
+
+
+class DaemonBackend:
+    """
+    A client for the `esbuild-py --stdio` daemon.
+    It runs the Go binary as a subprocess once and sends it length-prefixed
+    JSON-RPC requests over stdin/stdout, for environments that can't load
+    the native shared library. Requests sent from several threads run
+    concurrently in the daemon.
+    """
+
+    def __init__(self, path: str):
+        """Starts the daemon binary found at `path` (or on the PATH)."""
+        executable = shutil.which(path)
+        if executable is None:
+            raise FileNotFoundError(f"Could not find the esbuild-py daemon binary {path!r}.")
+
+        log.info(f"STARTING DAEMON AT: {executable}")
+        self._process = subprocess.Popen(
+            [executable, '--stdio'],
+            stdin=subprocess.PIPE,
+            stdout=subprocess.PIPE,
+        )
+        self._conn = _Connection(self._process.stdout, self._process.stdin)
+        atexit.register(self.close)
+
+    def close(self):
+        """Closes the daemon's stdin, which makes it exit, and waits for it."""
+        if self._process.poll() is None:
+            self._process.stdin.close()
+            self._process.wait()
+
+    def _connection(self) -> _Connection:
+        """Returns the connection to send requests on."""
+        return self._conn
+
+    def _call(self, method: str, params=None):
+        """Sends a JSON-RPC request and returns the result of its response."""
+        connection = self._connection()
+        request_id, future = connection.send(method, params)
+        try:
+            response = future.result()
+        except KeyboardInterrupt:
+            # Don't leave the daemon working on a request nobody waits for.
+            connection.send("cancel", {"id": request_id})
+            raise
+
+        if response.get('error'):
+            raise RuntimeError(f"esbuild-py daemon request failed: {response['error'].get('message')}")
+        return response.get('result')
+
+    def transform(self, code: str, **kwargs):
+        """Proxy for the daemon's transform method."""
+        options = request_options(**kwargs)
+        if 'loader' not in options:
+            options['loader'] = 'jsx'
+
+        response = self._call("transform", {"code": code, "options": options})
+
+        if response.get('kind') == 'timeout':
+            raise TimeoutError("esbuild transformation timed out.")
+
+        if response.get('errors') and len(response['errors']) > 0:
+            error_messages = [e.get('text', 'Unknown error') for e in response['errors']]
+            raise RuntimeError(f"esbuild transformation failed: {', '.join(error_messages)}")
+
+        return response.get('code', '')
+
+    def build(self, **kwargs):
+        """Proxy for the daemon's build method."""
+        return self._call("build", request_options(**kwargs))
+
+    def analyze_metafile(self, metafile, verbose: bool = False, color: bool = False) -> str:
+        """Proxy for the daemon's analyze_metafile method."""
+        response = self._call("analyze_metafile", {"metafile": metafile, "verbose": verbose, "color": color})
+        if response.get('errors'):
+            error_messages = [e.get('text', 'Unknown error') for e in response['errors']]
+            raise RuntimeError(f"esbuild metafile analysis failed: {', '.join(error_messages)}")
+        return response.get('analysis', '')
+
+    def format_messages(self, messages: list, kind: str = "error", color: bool = False, terminal_width: int = 0) -> list:
+        """Proxy for the daemon's format_messages method."""
+        request = {"messages": messages, "kind": kind, "color": color, "terminalWidth": terminal_width}
+        response = self._call("format_messages", request)
+        if response.get('errors'):
+            error_messages = [e.get('text', 'Unknown error') for e in response['errors']]
+            raise RuntimeError(f"esbuild message formatting failed: {', '.join(error_messages)}")
+        return response.get('formatted', [])
+
+    def version(self) -> dict:
+        """Returns the versions of the esbuild library embedded in the daemon and the bindings."""
+        return self._call("version")
+
+    def capabilities(self) -> dict:
+        """Returns the commands and option values supported by the daemon."""
+        return self._call("capabilities")
+
+
+
+class SocketBackend(DaemonBackend):
+    """
+    A client for an `esbuild-py --serve-socket` daemon, which is shared by
+    every process connected to its Unix domain socket or Windows named pipe,
+    e.g. the workers of a gunicorn server.
+    """
+
+    def __init__(self, socket_path: str):
+        """Connects to the daemon listening at `socket_path`, or at a named pipe such as `\\\\.\\pipe\\esbuild-py`."""
+        self._socket_path = socket_path
+        self._socket = None
+        self._conn = None
+        self._pid = None
+        self._lock = threading.Lock()
+        self._connection()
+        atexit.register(self.close)
+
+    def close(self):
+        """Closes the connection, leaving the daemon running."""
+        if self._socket is None:
+            return
+        if isinstance(self._socket, socket.socket) and self._pid == os.getpid():
+            # The files made from the socket keep it open until they're
+            # closed, and the reading thread holds the reader until a
+            # shutdown wakes it. A forked child mustn't shut down the
+            # connection it shares with its parent.
+            try:
+                self._socket.shutdown(socket.SHUT_RDWR)
+            except OSError:
+                pass
+        self._conn.close()
+        self._socket.close()
+        self._socket = None
+
+    def _connection(self) -> _Connection:
+        """
+        Connects to the daemon, again after a fork, since a child process
+        sharing its parent's connection would read the parent's responses.
+        """
+        with self._lock:
+            if self._conn is not None and self._pid == os.getpid():
+                return self._conn
+            log.info(f"CONNECTING TO DAEMON AT: {self._socket_path}")
+            try:
+                if self._socket_path.startswith(_PIPE_PREFIX):
+                    pipe = _OverlappedPipe(self._socket_path)
+                    self._socket = pipe
+                    self._conn = _Connection(pipe, pipe)
+                else:
+                    sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+                    try:
+                        sock.connect(self._socket_path)
+                    except OSError:
+                        sock.close()
+                        raise
+                    self._socket = sock
+                    self._conn = _Connection(sock.makefile('rb'), sock.makefile('wb'))
+            except OSError as e:
+                raise FileNotFoundError(f"Could not connect to the esbuild-py daemon at {self._socket_path!r}: {e}") from e
+            self._pid = os.getpid()
+            return self._conn
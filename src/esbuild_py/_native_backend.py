@@ -3,11 +3,24 @@ import json
 import logging
 import os
 import site
+import threading
+from contextlib import contextmanager
 from pathlib import Path
 from sysconfig import get_config_var
 
+from ._options import request_options
+from ._plugins import PluginBuild
+
 log = logging.getLogger(__name__)
 
+# The protocol version this wrapper was written for. It must match the value
+# returned by the shared library's `protocol_version()` export, so it's bumped
+# along with `ProtocolVersion` in internal/shared/api.go.
+PROTOCOL_VERSION = 4
+
+# The signature of the plugin callback of the native library.
+PLUGIN_CALLBACK = ctypes.CFUNCTYPE(None, ctypes.c_ulonglong, ctypes.c_void_p, ctypes.c_size_t)
+
 
 class NativeBackend:
     """
@@ -33,26 +46,87 @@ class NativeBackend:
             log.debug(f"ctypes.cdll.LoadLibrary failed: {e}")
             raise
 
+        self._check_protocol_version()
+
         # --- Set up function signatures for safe FFI ---
 
-        # The Go 'transform' function returns a C string (char*) that we must free.
+        # The Go 'transform' function returns a buffer (char*) that we must free,
+        # and stores its length in the size_t pointed to by the second argument.
         # By setting restype to c_void_p, we get back a raw pointer (as an int),
         # giving us full control over memory management.
-        self._transform = self.so.transform
-        self._transform.argtypes = [ctypes.c_char_p]
+        # The '_bytes' variants take the request buffer and its length, so Go
+        # can read it in place without a NUL-terminated copy.
+        self._transform = self.so.transform_bytes
+        self._transform.argtypes = [ctypes.c_char_p, ctypes.c_size_t, ctypes.POINTER(ctypes.c_size_t)]
         self._transform.restype = ctypes.c_void_p
 
-        self._build = self.so.build
-        self._build.argtypes = [ctypes.c_char_p]
+        self._build = self.so.build_bytes
+        self._build.argtypes = [ctypes.c_char_p, ctypes.c_size_t, ctypes.POINTER(ctypes.c_size_t)]
         self._build.restype = ctypes.c_void_p
 
-        # The Go 'free' function takes the pointer we received and frees it.
-        self._free = self.so.free
+        self._analyze_metafile = self.so.analyze_metafile
+        self._analyze_metafile.argtypes = [ctypes.c_char_p, ctypes.c_size_t, ctypes.POINTER(ctypes.c_size_t)]
+        self._analyze_metafile.restype = ctypes.c_void_p
+
+        self._format_messages = self.so.format_messages
+        self._format_messages.argtypes = [ctypes.c_char_p, ctypes.c_size_t, ctypes.POINTER(ctypes.c_size_t)]
+        self._format_messages.restype = ctypes.c_void_p
+
+        self._version = self.so.version
+        self._version.argtypes = [ctypes.POINTER(ctypes.c_size_t)]
+        self._version.restype = ctypes.c_void_p
+
+        self._capabilities = self.so.capabilities
+        self._capabilities.argtypes = [ctypes.POINTER(ctypes.c_size_t)]
+        self._capabilities.restype = ctypes.c_void_p
+
+        self._shutdown = self.so.esbuild_shutdown
+        self._shutdown.argtypes = [ctypes.c_longlong]
+        self._shutdown.restype = ctypes.c_int
+
+        self._set_plugin_callback = self.so.set_plugin_callback
+        self._set_plugin_callback.argtypes = [PLUGIN_CALLBACK]
+        self._set_plugin_callback.restype = ctypes.c_int
+
+        self._plugin_respond = self.so.plugin_respond
+        self._plugin_respond.argtypes = [ctypes.c_ulonglong, ctypes.c_char_p, ctypes.c_size_t]
+        self._plugin_respond.restype = ctypes.c_int
+
+        # The plugins of the running builds by name, with the number of builds
+        # using each. ctypes doesn't keep the callback alive while Go holds it.
+        self._plugins = {}
+        self._plugins_lock = threading.Lock()
+        self._plugin_callback = PLUGIN_CALLBACK(self._on_plugin_call)
+
+        # The Go 'free_result' function takes the pointer we received and frees it.
+        self._free = self.so.free_result
         self._free.argtypes = [ctypes.c_void_p]
         self._free.restype = None  # It returns nothing
 
         log.debug("NativeBackend initialization complete.")
 
+    def _check_protocol_version(self):
+        """
+        Verifies that the loaded library speaks the protocol this wrapper
+        expects, raising an ImportError with a clear message otherwise.
+        """
+        try:
+            protocol_version = self.so.protocol_version
+        except AttributeError:
+            # Libraries built before the export existed.
+            version = 0
+        else:
+            protocol_version.argtypes = []
+            protocol_version.restype = ctypes.c_int
+            version = protocol_version()
+
+        if version != PROTOCOL_VERSION:
+            raise ImportError(
+                f"The native esbuild library speaks protocol version {version}, "
+                f"but esbuild-py expects version {PROTOCOL_VERSION}. "
+                "Please rebuild or reinstall the package."
+            )
+
     def _get_lib_path(self) -> str | None:
         """
         Finds the path to the compiled native shared library using a robust
@@ -88,31 +162,35 @@ class NativeBackend:
 
     def transform(self, code: str, **kwargs):
         """Proxy for the Go transform function with safe memory management."""
-        options = kwargs.copy()
+        options = request_options(**kwargs)
         if 'loader' not in options:
             options['loader'] = 'jsx'
 
         request = {"code": code, "options": options}
-        request_json = json.dumps(request)
+        request_bytes = json.dumps(request).encode('utf-8')
 
         result_ptr = None
+        result_length = ctypes.c_size_t()
         try:
-            # 1. Call the Go function, which returns a raw pointer.
-            result_ptr = self._transform(request_json.encode('utf-8'))
+            # 1. Call the Go function, which returns a raw pointer and its length.
+            result_ptr = self._transform(request_bytes, len(request_bytes), ctypes.byref(result_length))
 
             if not result_ptr:
                 raise RuntimeError("esbuild transform function returned a NULL pointer.")
 
-            # 2. Cast the raw pointer to a C string pointer and get its value.
-            c_string = ctypes.cast(result_ptr, ctypes.c_char_p).value
+            # 2. Copy exactly `result_length` bytes from the raw pointer.
+            result_bytes = ctypes.string_at(result_ptr, result_length.value)
 
             # 3. Decode the bytes to a Python string.
-            result_json = c_string.decode('utf-8')
+            result_json = result_bytes.decode('utf-8')
             log.info(f"Received raw JSON from native call: {result_json!r}")
 
             # 4. Process the response.
             response = json.loads(result_json)
 
+            if response.get('kind') == 'timeout':
+                raise TimeoutError("esbuild transformation timed out.")
+
             if response.get('errors') and len(response['errors']) > 0:
                 error_messages = [e.get('text', 'Unknown error') for e in response['errors']]
                 raise RuntimeError(f"esbuild transformation failed: {', '.join(error_messages)}")
@@ -128,26 +206,87 @@ class NativeBackend:
 
     def build(self, **kwargs):
         """Proxy for the Go build function with safe memory management."""
+        plugins = kwargs.pop('plugins', None)
+        if plugins:
+            with self._registered_plugins(plugins) as declarations:
+                return self._build_request(plugins=declarations, **kwargs)
+        return self._build_request(**kwargs)
+
+    @contextmanager
+    def _registered_plugins(self, plugins: list):
+        """
+        Sets up Python plugins, each a dict with a `name` and a `setup`
+        function taking a PluginBuild, and yields their declarations for the
+        build request. Their hooks are called back until the build ends.
+        Builds running at the same time may share a plugin, but not two
+        plugins of the same name with different setup functions, since calls
+        are dispatched by name.
+        """
+        builds = []
+        for plugin in plugins:
+            build = PluginBuild(plugin['name'])
+            plugin['setup'](build)
+            builds.append((plugin['setup'], build))
+
+        with self._plugins_lock:
+            for setup, build in builds:
+                registered = self._plugins.get(build.name)
+                if registered and registered[0] is not setup:
+                    raise ValueError(f"Another plugin named {build.name!r} is used by a running build.")
+            for setup, build in builds:
+                _, registered_build, count = self._plugins.get(build.name, (setup, build, 0))
+                self._plugins[build.name] = (setup, registered_build, count + 1)
+            # Registered for every build, in case the callback was replaced.
+            if self._set_plugin_callback(self._plugin_callback) != 0:
+                raise RuntimeError("Failed to register the plugin callback.")
+        try:
+            yield [build.declaration() for _, build in builds]
+        finally:
+            with self._plugins_lock:
+                for _, build in builds:
+                    setup, registered_build, count = self._plugins[build.name]
+                    if count == 1:
+                        del self._plugins[build.name]
+                    else:
+                        self._plugins[build.name] = (setup, registered_build, count - 1)
+
+    def _on_plugin_call(self, call_id, data, length):
+        """Answers a hook call of a Python plugin, on a Go thread."""
+        try:
+            call = json.loads(ctypes.string_at(data, length))
+        finally:
+            self._free(data)
+        try:
+            with self._plugins_lock:
+                _, build, _ = self._plugins[call['plugin']]
+            result = build.call(call)
+        except Exception as e:
+            # The error fails the build rather than being lost on the Go thread.
+            log.debug(f"The {call['hook']} hook of plugin {call['plugin']!r} failed", exc_info=True)
+            result = {'errors': [{'text': f"{type(e).__name__}: {e}"}]}
+        answer = json.dumps(result).encode('utf-8')
+        self._plugin_respond(call_id, answer, len(answer))
+
+    def _build_request(self, **kwargs):
+        """Runs a build with the Go build function."""
         # The kwargs are the build options, which we pass directly as JSON.
-        input = {
-            'EntryPoints': kwargs['entry_points'],
-            'Outfile': kwargs['outfile']
-        }
-        request_json = json.dumps(input)
+        input = request_options(**kwargs)
+        request_bytes = json.dumps(input).encode('utf-8')
 
         result_ptr = None
+        result_length = ctypes.c_size_t()
         try:
             # 1. Call the Go function, which returns a raw pointer to the result JSON.
-            result_ptr = self._build(request_json.encode('utf-8'))
+            result_ptr = self._build(request_bytes, len(request_bytes), ctypes.byref(result_length))
 
             if not result_ptr:
                 raise RuntimeError("esbuild build function returned a NULL pointer.")
 
-            # 2. Cast the raw pointer to a C string pointer and get its value.
-            c_string = ctypes.cast(result_ptr, ctypes.c_char_p).value
+            # 2. Copy exactly `result_length` bytes from the raw pointer.
+            result_bytes = ctypes.string_at(result_ptr, result_length.value)
 
             # 3. Decode the bytes to a Python string.
-            result_json = c_string.decode('utf-8')
+            result_json = result_bytes.decode('utf-8')
             log.info(f"Received raw JSON from native build call: {result_json!r}")
 
             # 4. The result is the JSON itself, containing errors and warnings.
@@ -158,3 +297,57 @@ class NativeBackend:
             if result_ptr:
                 log.debug(f"Freeing memory at address: {result_ptr}")
                 self._free(result_ptr)
+
+    def analyze_metafile(self, metafile, verbose: bool = False, color: bool = False) -> str:
+        """Proxy for the Go analyze_metafile function."""
+        request = {"metafile": metafile, "verbose": verbose, "color": color}
+        response = self._call_request(self._analyze_metafile, request)
+        if response.get('errors'):
+            error_messages = [e.get('text', 'Unknown error') for e in response['errors']]
+            raise RuntimeError(f"esbuild metafile analysis failed: {', '.join(error_messages)}")
+        return response.get('analysis', '')
+
+    def format_messages(self, messages: list, kind: str = "error", color: bool = False, terminal_width: int = 0) -> list:
+        """Proxy for the Go format_messages function."""
+        request = {"messages": messages, "kind": kind, "color": color, "terminalWidth": terminal_width}
+        response = self._call_request(self._format_messages, request)
+        if response.get('errors'):
+            error_messages = [e.get('text', 'Unknown error') for e in response['errors']]
+            raise RuntimeError(f"esbuild message formatting failed: {', '.join(error_messages)}")
+        return response.get('formatted', [])
+
+    def _call_request(self, func, request: dict) -> dict:
+        """Calls a Go function that takes a JSON request and returns JSON."""
+        request_bytes = json.dumps(request).encode('utf-8')
+        result_length = ctypes.c_size_t()
+        result_ptr = func(request_bytes, len(request_bytes), ctypes.byref(result_length))
+        try:
+            return json.loads(ctypes.string_at(result_ptr, result_length.value).decode('utf-8'))
+        finally:
+            self._free(result_ptr)
+
+    def _call_json(self, func) -> dict:
+        """Calls a Go function that takes no request and returns JSON."""
+        result_length = ctypes.c_size_t()
+        result_ptr = func(ctypes.byref(result_length))
+        try:
+            return json.loads(ctypes.string_at(result_ptr, result_length.value).decode('utf-8'))
+        finally:
+            self._free(result_ptr)
+
+    def version(self) -> dict:
+        """Returns the versions of the embedded esbuild library and the bindings."""
+        return self._call_json(self._version)
+
+    def capabilities(self) -> dict:
+        """Returns the commands and option values supported by the library."""
+        return self._call_json(self._capabilities)
+
+    def shutdown(self, drain_timeout_ms: int = -1) -> bool:
+        """
+        Lets the running requests finish for up to drain_timeout_ms
+        milliseconds (indefinitely if negative), cancels the rest and disposes
+        all contexts. Returns whether everything finished in time. The library
+        can't be used afterwards.
+        """
+        return self._shutdown(drain_timeout_ms) == 0
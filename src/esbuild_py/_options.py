@@ -0,0 +1,12 @@
+def _to_camel_case(name: str) -> str:
+    """Converts a snake_case keyword argument name to esbuild's camelCase."""
+    head, *tail = name.split('_')
+    return head + ''.join(part[:1].upper() + part[1:] for part in tail)
+
+
+def request_options(**kwargs) -> dict:
+    """
+    Converts the keyword arguments of `transform()` or `build()` into the JSON
+    options object understood by the Go bindings, e.g. `entry_points` becomes `entryPoints`.
+    """
+    return {_to_camel_case(key): value for key, value in kwargs.items()}
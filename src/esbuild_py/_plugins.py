@@ -0,0 +1,68 @@
+class PluginBuild:
+    """
+    The object passed to the `setup` function of a Python plugin, like the
+    `build` object of esbuild's JavaScript plugins. The hooks registered on it
+    are declared in the build request, and the native library calls them back
+    through the plugin callback.
+    """
+
+    def __init__(self, name: str):
+        self.name = name
+        self._on_resolve = []
+        self._on_load = []
+        self._on_start = []
+        self._on_end = []
+
+    def on_resolve(self, options: dict, callback):
+        """
+        Calls callback(args) for the import paths matching options['filter'],
+        a Go regular expression, in options.get('namespace'). It returns a dict
+        with the `path`, `namespace`, `external`, ... of the module, or None to
+        let the next plugin resolve it.
+        """
+        self._on_resolve.append((options, callback))
+
+    def on_load(self, options: dict, callback):
+        """
+        Calls callback(args) for the modules matching options['filter'] in
+        options.get('namespace'). It returns a dict with the `contents` and
+        `loader` of the module, or None to let the next plugin load it.
+        """
+        self._on_load.append((options, callback))
+
+    def on_start(self, callback):
+        """Calls callback() when each build starts."""
+        self._on_start.append(callback)
+
+    def on_end(self, callback):
+        """Calls callback(result) when each build ends."""
+        self._on_end.append(callback)
+
+    def declaration(self) -> dict:
+        """Returns the declaration of the plugin for the build request."""
+        return {
+            'name': self.name,
+            'onResolve': [options for options, _ in self._on_resolve],
+            'onLoad': [options for options, _ in self._on_load],
+            'onStart': bool(self._on_start),
+            'onEnd': bool(self._on_end),
+        }
+
+    def call(self, call: dict) -> dict:
+        """Runs the hook named by a call of the native library."""
+        hook = call['hook']
+        if hook in ('onResolve', 'onLoad'):
+            hooks = self._on_resolve if hook == 'onResolve' else self._on_load
+            _, callback = hooks[call['index']]
+            return callback(call) or {}
+
+        # A single onStart and onEnd hook is declared per plugin, which runs
+        # the callbacks in turn and gathers their messages.
+        callbacks = self._on_end if hook == 'onEnd' else self._on_start
+        response = {'errors': [], 'warnings': []}
+        for callback in callbacks:
+            result = callback(call['result']) if hook == 'onEnd' else callback()
+            if result:
+                response['errors'] += result.get('errors', [])
+                response['warnings'] += result.get('warnings', [])
+        return response
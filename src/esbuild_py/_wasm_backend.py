@@ -5,6 +5,8 @@ import logging
 import os
 import tempfile
 
+from ._options import request_options
+
 log = logging.getLogger(__name__)
 
 class WasmBackend:
@@ -106,7 +108,7 @@ class WasmBackend:
         files for I/O.
         """
         # 1. Prepare the JSON request payload.
-        options = kwargs.copy()
+        options = request_options(**kwargs)
         if 'loader' not in options:
             options['loader'] = 'jsx'
 
@@ -121,12 +123,42 @@ class WasmBackend:
     def build(self, **kwargs):
         input = {
             "command": "build",
-            "BuildOptions": {
-                'EntryPoints': kwargs['entry_points'],
-                'Outfile': kwargs['outfile']
-            }
+            "BuildOptions": request_options(**kwargs),
         }
         request_json_bytes = json.dumps(input).encode('utf-8')
         files = kwargs['entry_points'] + [kwargs['outfile']]
         return self.send_content(request_json_bytes, files)
 
+    def analyze_metafile(self, metafile, verbose: bool = False, color: bool = False) -> str:
+        """Describes the outputs of a build and the inputs making them up."""
+        input = {
+            "command": "analyze_metafile",
+            "analyze": {"metafile": metafile, "verbose": verbose, "color": color},
+        }
+        response = self.send_content(json.dumps(input).encode('utf-8'))
+        if response.get('errors'):
+            error_messages = [e.get('text', 'Unknown error') for e in response['errors']]
+            raise RuntimeError(f"esbuild metafile analysis failed: {', '.join(error_messages)}")
+        return response.get('analysis', '')
+
+    def format_messages(self, messages: list, kind: str = "error", color: bool = False, terminal_width: int = 0) -> list:
+        """Renders errors or warnings the way esbuild prints them."""
+        input = {
+            "command": "format_messages",
+            "format": {"messages": messages, "kind": kind, "color": color, "terminalWidth": terminal_width},
+        }
+        response = self.send_content(json.dumps(input).encode('utf-8'))
+        if response.get('errors'):
+            error_messages = [e.get('text', 'Unknown error') for e in response['errors']]
+            raise RuntimeError(f"esbuild message formatting failed: {', '.join(error_messages)}")
+        return response.get('formatted', [])
+
+    def version(self) -> dict:
+        """Returns the versions of the embedded esbuild library and the bindings."""
+        request_json_bytes = json.dumps({"command": "version"}).encode('utf-8')
+        return self.send_content(request_json_bytes)
+
+    def capabilities(self) -> dict:
+        """Returns the commands and option values supported by the WASM module."""
+        request_json_bytes = json.dumps({"command": "capabilities"}).encode('utf-8')
+        return self.send_content(request_json_bytes)
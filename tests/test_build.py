@@ -1,14 +1,36 @@
 import unittest
 import importlib
 import tempfile
+import ctypes
+import json
 import os
 import shutil
+import subprocess
+import sys
 import pytest
 import esbuild_py
 from unittest import mock
 
 go_installed = shutil.which("go")
 
+
+def load_native_backend():
+    """
+    Loads the native library directly, since other tests reload esbuild_py
+    with another backend.
+    """
+    from esbuild_py._native_backend import NativeBackend
+    try:
+        return NativeBackend()
+    except (ImportError, FileNotFoundError):
+        return None
+
+
+native_backend = load_native_backend()
+
+# The signature of the callbacks of the native library.
+CALLBACK = ctypes.CFUNCTYPE(None, ctypes.c_ulonglong, ctypes.c_void_p, ctypes.c_size_t)
+
 @pytest.mark.skipif(not go_installed, reason="Go is not installed")
 class TestBuildAPI(unittest.TestCase):
     """
@@ -111,5 +133,384 @@ class TestBuildAPI(unittest.TestCase):
         self.assertIn("lib.js", content)
         self.assertIn("app.js", content)
 
+
+@pytest.mark.skipif(native_backend is None, reason="The native library isn't built")
+class TestBuildOptions(unittest.TestCase):
+    """
+    Tests for the options of `build()`.
+    """
+
+    def setUp(self):
+        self.temp_dir = tempfile.TemporaryDirectory()
+        self.root = self.temp_dir.name
+        os.makedirs(os.path.join(self.root, 'src'))
+        with open(os.path.join(self.root, 'src', 'main.js'), 'w') as f:
+            f.write("import React from 'react';\nexport const greet = (name) => `Hello, ${name}`;\nconsole.log(React);\n")
+
+    def tearDown(self):
+        self.temp_dir.cleanup()
+
+    def build(self, **kwargs):
+        options = dict(entry_points=[os.path.join(self.root, 'src', 'main.js')], bundle=True, outfile=os.path.join(self.root, 'dist', 'main.js'))
+        options.update(kwargs)
+        return native_backend.build(**options)
+
+    def read_output(self, name='main.js'):
+        with open(os.path.join(self.root, 'dist', name)) as f:
+            return f.read()
+
+    def test_packages_external(self):
+        result = self.build()
+        self.assertEqual(len(result['errors']), 1, "react can't be resolved.")
+
+        result = self.build(packages='external')
+        self.assertEqual(result['errors'], [])
+        self.assertIn('require("react")', self.read_output())
+
+    def build_app(self, **kwargs):
+        """Builds src/app.ts, which imports a stylesheet, into dist."""
+        with open(os.path.join(self.root, 'src', 'app.ts'), 'w') as f:
+            f.write("import './style.css';\nexport const greet = (name: string) => `Hello, ${name}`;\n")
+        with open(os.path.join(self.root, 'src', 'style.css'), 'w') as f:
+            f.write("body { color: red }\n")
+        options = dict(entry_points=['src/app.ts'], bundle=True, outdir='dist', abs_working_dir=self.root)
+        options.update(kwargs)
+        return native_backend.build(**options)
+
+    def test_bundles(self):
+        result = self.build_app()
+        self.assertEqual(result['errors'], [])
+        self.assertEqual(result['bundles'], {'src/app.ts': {'js': 'dist/app.js', 'css': 'dist/app.css'}})
+
+    def test_manifest(self):
+        result = self.build_app(manifest='manifest.json', entry_names='[name]-[hash]')
+        self.assertEqual(result['errors'], [])
+        with open(os.path.join(self.root, 'dist', 'manifest.json')) as f:
+            manifest = json.load(f)
+        self.assertEqual(manifest, result['manifest'])
+        self.assertEqual(sorted(manifest), ['app.css', 'app.js'])
+        self.assertRegex(manifest['app.js'], r'^app-\w+\.js$')
+        self.assertTrue(os.path.exists(os.path.join(self.root, 'dist', manifest['app.js'])))
+
+    def test_integrity(self):
+        result = self.build_app(integrity='sha384')
+        self.assertEqual(result['errors'], [])
+        self.assertEqual(sorted(result['integrity']), ['dist/app.css', 'dist/app.js'])
+        self.assertRegex(result['integrity']['dist/app.js'], r'^sha384-[A-Za-z0-9+/]{64}$')
+
+    def test_compressed_sizes(self):
+        result = self.build_app(compressed_sizes=True)
+        self.assertEqual(result['errors'], [])
+        sizes = result['sizes']['dist/app.js']
+        self.assertEqual(sizes['raw'], os.path.getsize(os.path.join(self.root, 'dist', 'app.js')))
+        self.assertGreater(sizes['gzip'], 0)
+        self.assertGreater(sizes['brotli'], 0)
+
+    def test_budgets(self):
+        result = self.build_app(budgets=[{'entry': 'src/app.ts', 'raw': 100000}, {'raw': 10, 'level': 'warning'}])
+        self.assertEqual(result['errors'], [])
+        self.assertEqual([w['id'] for w in result['warnings']], ['size-budget'])
+
+        result = self.build_app(integrity='sha256', budgets=[{'entry': 'src/app.ts', 'gzip': 10}])
+        self.assertEqual([e['id'] for e in result['errors']], ['size-budget'])
+        self.assertIn('dist/app.js', result['integrity'], "A failed budget shouldn't hide the integrity strings.")
+
+    def test_metafile(self):
+        result = self.build_app(write=False, metafile=True)
+        self.assertEqual(result['errors'], [])
+        paths = sorted(os.path.relpath(f['path'], self.root) for f in result['outputFiles'])
+        self.assertEqual(paths, [os.path.join('dist', 'app.css'), os.path.join('dist', 'app.js')])
+        self.assertIn('src/app.ts', json.loads(result['metafile'])['inputs'])
+        self.assertFalse(os.path.exists(os.path.join(self.root, 'dist')))
+
+    def test_invalid_options(self):
+        result = self.build(write=False, platform='nodejs', format='es')
+        self.assertEqual([e['id'] for e in result['errors']], ['invalid-options', 'invalid-options'])
+        self.assertIn('"platform"', result['errors'][0]['text'] + result['errors'][1]['text'])
+
+    def test_log_override(self):
+        with open(os.path.join(self.root, 'src', 'main.js'), 'a') as f:
+            f.write("export const x = eval('1');\n")
+        result = self.build(write=False, packages='external', log_level='warning')
+        self.assertEqual([w['id'] for w in result['warnings']], ['direct-eval'])
+        result = self.build(write=False, packages='external', log_level='error')
+        self.assertEqual(result['warnings'], [])
+        result = self.build(write=False, packages='external', log_override={'direct-eval': 'error'})
+        self.assertEqual([e['id'] for e in result['errors']], ['direct-eval'])
+
+
+def env_plugin(build):
+    """A plugin serving `import value from 'env'` from Python."""
+    build.on_resolve({'filter': '^env$'}, lambda args: {'path': args['path'], 'namespace': 'env'})
+    build.on_load({'filter': '.*', 'namespace': 'env'}, lambda args: {'contents': "export default 'from the plugin';", 'loader': 'js'})
+
+
+@pytest.mark.skipif(native_backend is None, reason="The native library isn't built")
+class TestPlugins(unittest.TestCase):
+    """
+    Tests for the plugins written in Python.
+    """
+
+    def setUp(self):
+        self.temp_dir = tempfile.TemporaryDirectory()
+        self.root = self.temp_dir.name
+        with open(os.path.join(self.root, 'main.js'), 'w') as f:
+            f.write("import value from 'env';\nconsole.log(value);\n")
+
+    def tearDown(self):
+        self.temp_dir.cleanup()
+
+    def build(self, plugins):
+        return native_backend.build(entry_points=['main.js'], bundle=True, write=False, outdir='dist', abs_working_dir=self.root, plugins=plugins)
+
+    def test_resolve_and_load(self):
+        result = self.build([{'name': 'env', 'setup': env_plugin}])
+        self.assertEqual(result['errors'], [])
+        self.assertIn('from the plugin', result['outputFiles'][0]['text'])
+
+    def test_start_and_end(self):
+        events = []
+
+        def setup(build):
+            env_plugin(build)
+            build.on_start(lambda: events.append('start'))
+            build.on_end(lambda result: {'warnings': [{'text': f"{len(result['errors'])} errors"}]})
+
+        result = self.build([{'name': 'env', 'setup': setup}])
+        self.assertEqual(events, ['start'])
+        self.assertEqual([w['text'] for w in result['warnings']], ['0 errors'])
+
+    def test_exception(self):
+        def setup(build):
+            build.on_resolve({'filter': '^env$'}, lambda args: 1 / 0)
+
+        result = self.build([{'name': 'broken', 'setup': setup}])
+        self.assertEqual(len(result['errors']), 1)
+        self.assertIn('ZeroDivisionError', result['errors'][0]['text'])
+
+    def test_name_conflict(self):
+        with native_backend._registered_plugins([{'name': 'env', 'setup': env_plugin}]):
+            # Concurrent builds share a plugin, but two plugins can't share a name.
+            self.assertEqual(self.build([{'name': 'env', 'setup': env_plugin}])['errors'], [])
+            with self.assertRaisesRegex(ValueError, "'env'"):
+                self.build([{'name': 'env', 'setup': lambda build: env_plugin(build)}])
+        self.assertEqual(native_backend._plugins, {})
+
+@pytest.mark.skipif(native_backend is None, reason="The native library isn't built")
+class TestNativeJobs(unittest.TestCase):
+    """
+    Tests for the exports of the native library that esbuild_py doesn't wrap,
+    called with ctypes.
+    """
+
+    def setUp(self):
+        self.temp_dir = tempfile.TemporaryDirectory()
+        self.root = self.temp_dir.name
+        with open(os.path.join(self.root, 'main.js'), 'w') as f:
+            f.write("import { x } from './lib.js';\nconsole.log(x);\n")
+        with open(os.path.join(self.root, 'lib.js'), 'w') as f:
+            f.write("export const x = 'first';\n")
+
+    def tearDown(self):
+        self.temp_dir.cleanup()
+
+    def function(self, name, argtypes, restype):
+        """Returns an export of the native library with its signature."""
+        func = getattr(native_backend.so, name)
+        func.argtypes = argtypes
+        func.restype = restype
+        return func
+
+    def take(self, ptr, length):
+        """Decodes a JSON buffer returned by the library and frees it."""
+        self.assertTrue(ptr, "The library returned NULL.")
+        try:
+            return json.loads(ctypes.string_at(ptr, length.value))
+        finally:
+            native_backend._free(ptr)
+
+    def submit(self, name, request):
+        submit = self.function(name, [ctypes.c_char_p, ctypes.c_size_t], ctypes.c_ulonglong)
+        data = json.dumps(request).encode('utf-8')
+        request_id = submit(data, len(data))
+        self.assertNotEqual(request_id, 0)
+        return request_id
+
+    def wait(self, request_id, timeout_ms=-1):
+        wait_result = self.function('wait_result', [ctypes.c_ulonglong, ctypes.c_longlong, ctypes.POINTER(ctypes.c_size_t)], ctypes.c_void_p)
+        length = ctypes.c_size_t()
+        ptr = wait_result(request_id, timeout_ms, ctypes.byref(length))
+        return self.take(ptr, length) if ptr else None
+
+    def build_request(self, **kwargs):
+        request = {'entryPoints': [os.path.join(self.root, 'main.js')], 'bundle': True, 'outfile': os.path.join(self.root, 'dist', 'main.js')}
+        request.update(kwargs)
+        return request
+
+    def read_output(self):
+        with open(os.path.join(self.root, 'dist', 'main.js')) as f:
+            return f.read()
+
+    def test_submit_and_wait(self):
+        transform_id = self.submit('submit_transform', {'code': 'let x: number = 1', 'options': {'loader': 'ts'}})
+        build_id = self.submit('submit_build', self.build_request())
+        self.assertEqual(self.wait(transform_id)['code'], 'let x = 1;\n')
+        self.assertEqual(self.wait(build_id)['errors'], [])
+        self.assertIn('first', self.read_output())
+
+    def test_poll(self):
+        poll_result = self.function('poll_result', [ctypes.c_ulonglong, ctypes.POINTER(ctypes.c_size_t)], ctypes.c_void_p)
+        request_id = self.submit('submit_transform', {'code': 'let x = 1', 'options': {}})
+        length = ctypes.c_size_t()
+        ptr = None
+        while not ptr:
+            ptr = poll_result(request_id, ctypes.byref(length))
+        self.assertEqual(self.take(ptr, length)['code'], 'let x = 1;\n')
+
+        # A response can only be collected once.
+        response = self.take(poll_result(request_id, ctypes.byref(length)), length)
+        self.assertEqual(len(response['errors']), 1)
+
+    def test_oversized_length(self):
+        # A size_t length that doesn't fit in a Go int is rejected rather
+        # than truncated.
+        submit = self.function('submit_transform', [ctypes.c_char_p, ctypes.c_size_t], ctypes.c_ulonglong)
+        plugin_respond = self.function('plugin_respond', [ctypes.c_ulonglong, ctypes.c_char_p, ctypes.c_size_t], ctypes.c_int)
+        size_max = ctypes.c_size_t(-1).value
+        self.assertEqual(submit(b'{}', size_max), 0)
+        self.assertEqual(plugin_respond(1, b'{}', size_max), -1)
+
+    def test_unknown_encoding(self):
+        transform_encoded = self.function('transform_encoded', [ctypes.c_char_p, ctypes.c_size_t, ctypes.c_int, ctypes.POINTER(ctypes.c_size_t)], ctypes.c_void_p)
+        data = json.dumps({'code': 'let x = 1', 'options': {}}).encode('utf-8')
+        length = ctypes.c_size_t()
+        response = self.take(transform_encoded(data, len(data), 7, ctypes.byref(length)), length)
+        self.assertEqual([e['id'] for e in response['errors']], ['invalid-options'])
+        self.assertIn('Invalid encoding 7', response['errors'][0]['text'])
+
+    def test_cancel(self):
+        cancel = self.function('cancel', [ctypes.c_ulonglong], ctypes.c_int)
+        self.assertEqual(cancel(2**64 - 1), -1, "The request ID is unknown.")
+
+        # A large input, so that the build is likely still running when it's
+        # cancelled.
+        with open(os.path.join(self.root, 'lib.js'), 'w') as f:
+            f.write("export const x = 'first';\n")
+            for i in range(20000):
+                f.write(f"export function f{i}(a, b) {{ return a * {i} + b; }}\n")
+        request_id = self.submit('submit_build', self.build_request(minify=True))
+        self.assertEqual(cancel(request_id), 0)
+        response = self.wait(request_id)
+        if response.get('kind') != 'cancelled':
+            # The build was about to finish anyway.
+            self.assertEqual(response['errors'], [])
+        self.assertEqual(cancel(request_id), -1, "The response was collected.")
+
+    def create_context(self):
+        context_create = self.function('context_create', [ctypes.c_char_p, ctypes.c_size_t, ctypes.POINTER(ctypes.c_size_t)], ctypes.c_void_p)
+        data = json.dumps(self.build_request()).encode('utf-8')
+        length = ctypes.c_size_t()
+        created = self.take(context_create(data, len(data), ctypes.byref(length)), length)
+        self.assertEqual(created['errors'], [])
+        return created['context']
+
+    def rebuild_context(self, handle):
+        context_rebuild = self.function('context_rebuild', [ctypes.c_ulonglong, ctypes.POINTER(ctypes.c_size_t)], ctypes.c_void_p)
+        length = ctypes.c_size_t()
+        return self.take(context_rebuild(handle, ctypes.byref(length)), length)
+
+    def test_context_rebuild(self):
+        handle = self.create_context()
+        self.assertEqual(self.rebuild_context(handle)['errors'], [])
+        self.assertIn('first', self.read_output())
+
+        with open(os.path.join(self.root, 'lib.js'), 'w') as f:
+            f.write("export const x = 'second';\n")
+        self.assertEqual(self.rebuild_context(handle)['errors'], [])
+        self.assertIn('second', self.read_output())
+
+        self.assertEqual(len(self.rebuild_context(2**64 - 1)['errors']), 1, "The handle is unknown.")
+
+    def test_context_dispose(self):
+        context_dispose = self.function('context_dispose', [ctypes.c_ulonglong], ctypes.c_int)
+        handle = self.create_context()
+        self.assertEqual(context_dispose(handle), 0)
+        self.assertEqual(context_dispose(handle), -1, "The context is already disposed.")
+        self.assertEqual(len(self.rebuild_context(handle)['errors']), 1)
+
+    def test_list_contexts(self):
+        list_contexts = self.function('list_contexts', [ctypes.POINTER(ctypes.c_size_t)], ctypes.c_void_p)
+        context_dispose = self.function('context_dispose', [ctypes.c_ulonglong], ctypes.c_int)
+        length = ctypes.c_size_t()
+        handle = self.create_context()
+        contexts = {c['id']: c for c in self.take(list_contexts(ctypes.byref(length)), length)}
+        self.assertEqual(contexts[handle]['state'], 'idle')
+
+        context_dispose(handle)
+        contexts = {c['id']: c for c in self.take(list_contexts(ctypes.byref(length)), length)}
+        self.assertNotIn(handle, contexts)
+
+    def set_plugin_callback(self, handle_call):
+        """
+        Registers a plugin callback that answers each call with the result of
+        handle_call, until the end of the test.
+        """
+        set_plugin_callback = self.function('set_plugin_callback', [CALLBACK], ctypes.c_int)
+        plugin_respond = self.function('plugin_respond', [ctypes.c_ulonglong, ctypes.c_char_p, ctypes.c_size_t], ctypes.c_int)
+
+        @CALLBACK
+        def callback(call_id, data, length):
+            call = json.loads(ctypes.string_at(data, length))
+            native_backend._free(data)
+            result = handle_call(call)
+            if result is not None:
+                answer = json.dumps(result).encode('utf-8')
+                plugin_respond(call_id, answer, len(answer))
+
+        self.assertEqual(set_plugin_callback(callback), 0)
+        self.addCleanup(set_plugin_callback, CALLBACK())
+        # ctypes doesn't keep the callback alive while Go holds it.
+        self.callback = callback
+
+    def test_plugins(self):
+        calls = []
+
+        def handle_call(call):
+            calls.append((call['hook'], call['plugin'], call['path']))
+            if call['hook'] == 'onResolve':
+                return {'path': call['path'], 'namespace': 'env'}
+            return {'contents': "export default 'from the plugin';", 'loader': 'js'}
+
+        self.set_plugin_callback(handle_call)
+        with open(os.path.join(self.root, 'main.js'), 'w') as f:
+            f.write("import value from 'env';\nconsole.log(value);\n")
+        plugin = {'name': 'env', 'onResolve': [{'filter': '^env$'}], 'onLoad': [{'filter': '.*', 'namespace': 'env'}]}
+        response = self.wait(self.submit('submit_build', self.build_request(plugins=[plugin])))
+        self.assertEqual(response['errors'], [])
+        self.assertIn('from the plugin', self.read_output())
+        self.assertEqual(calls, [('onResolve', 'env', 'env'), ('onLoad', 'env', 'env')])
+
+    def test_cancel_unanswered_plugin_call(self):
+        # The plugin never answers, so the build runs until it's cancelled.
+        self.set_plugin_callback(lambda call: None)
+        cancel = self.function('cancel', [ctypes.c_ulonglong], ctypes.c_int)
+        request = self.build_request(plugins=[{'name': 'hang', 'onLoad': [{'filter': 'lib\\.js$'}]}])
+        request_id = self.submit('submit_build', request)
+        self.assertIsNone(self.wait(request_id, 200), "The build should still be running.")
+        self.assertEqual(cancel(request_id), 0)
+        response = self.wait(request_id, 10000)
+        self.assertIsNotNone(response, "The cancelled build should finish.")
+        self.assertEqual(response['kind'], 'cancelled')
+
+    def test_shutdown(self):
+        self.assertIn('esbuild_shutdown', native_backend.capabilities()['commands'])
+        # The library can't be used after shutting down, so it's shut down in
+        # another interpreter.
+        script = "from esbuild_py._native_backend import NativeBackend; print(NativeBackend().shutdown(1000))"
+        env = dict(os.environ, PYTHONPATH=os.pathsep.join(sys.path))
+        process = subprocess.run([sys.executable, '-c', script], capture_output=True, text=True, env=env, timeout=60)
+        self.assertEqual(process.stdout.strip(), 'True', process.stderr)
+
+
 if __name__ == '__main__':
     unittest.main()
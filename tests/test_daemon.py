@@ -0,0 +1,205 @@
+import json
+import os
+import shutil
+import socket
+import struct
+import subprocess
+import sys
+import tempfile
+import threading
+import time
+import unittest
+import urllib.error
+import urllib.request
+
+import pytest
+
+from esbuild_py._daemon_backend import DaemonBackend, SocketBackend, _Connection
+from esbuild_py._native_backend import PROTOCOL_VERSION
+
+go_installed = shutil.which("go")
+repo_root = os.path.dirname(os.path.dirname(os.path.abspath(__file__)))
+
+
+def free_port():
+    """Returns a TCP port that is free on the loopback interface."""
+    with socket.socket() as s:
+        s.bind(('127.0.0.1', 0))
+        return s.getsockname()[1]
+
+
+def wait_for(condition, timeout=10):
+    """Waits until condition() is true."""
+    deadline = time.monotonic() + timeout
+    while not condition():
+        if time.monotonic() > deadline:
+            raise TimeoutError("The daemon didn't start in time.")
+        time.sleep(0.05)
+
+
+class TestConnection(unittest.TestCase):
+    """
+    Tests for the framing of requests and responses, against a fake daemon.
+    """
+
+    def test_unexpected_response(self):
+        # A response that isn't a JSON object stops the reading thread with
+        # an AttributeError, which must still fail the waiting requests.
+        reader_fd, writer_fd = os.pipe()
+        reader = os.fdopen(reader_fd, 'rb')
+        writer = os.fdopen(writer_fd, 'wb')
+        self.addCleanup(reader.close)
+        connection = _Connection(reader, open(os.devnull, 'wb'))
+        self.addCleanup(connection._writer.close)
+
+        _, future = connection.send("version")
+        writer.write(struct.pack('>I', 2) + b'[]')
+        writer.close()
+        with self.assertRaisesRegex(RuntimeError, "exited unexpectedly: 'list' object"):
+            future.result(timeout=10)
+        with self.assertRaisesRegex(RuntimeError, "exited unexpectedly"):
+            connection.send("version")
+
+
+@pytest.mark.skipif(not go_installed, reason="Go is not installed")
+class TestDaemon(unittest.TestCase):
+    """
+    Round trips through the `esbuild-py` daemon, over stdio, a Unix domain
+    socket and HTTP.
+    """
+
+    @classmethod
+    def setUpClass(cls):
+        cls.bin_dir = tempfile.TemporaryDirectory()
+        cls.binary = os.path.join(cls.bin_dir.name, 'esbuild-py' + ('.exe' if sys.platform == 'win32' else ''))
+        subprocess.run(['go', 'build', '-o', cls.binary, './cmd/esbuild-py'], cwd=repo_root, check=True)
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.bin_dir.cleanup()
+
+    def setUp(self):
+        self.temp_dir = tempfile.TemporaryDirectory()
+        self.root = self.temp_dir.name
+        with open(os.path.join(self.root, 'main.js'), 'w') as f:
+            f.write("import { x } from './lib.js';\nconsole.log(x);\n")
+        with open(os.path.join(self.root, 'lib.js'), 'w') as f:
+            f.write("export const x = 'from lib';\n")
+
+    def tearDown(self):
+        self.temp_dir.cleanup()
+
+    def start(self, *args):
+        """Starts the daemon with args, and stops it at the end of the test."""
+        process = subprocess.Popen([self.binary, *args], stderr=subprocess.PIPE)
+
+        def stop():
+            process.terminate()
+            process.wait()
+            process.stderr.close()
+        self.addCleanup(stop)
+        return process
+
+    def check_backend(self, backend):
+        self.assertEqual(backend.transform("let x: number = 1", loader="ts").strip(), "let x = 1;")
+        with self.assertRaisesRegex(RuntimeError, "Invalid loader"):
+            backend.transform("let x = 1", loader="typescript")
+
+        result = backend.build(entry_points=['main.js'], bundle=True, write=False, outdir='dist', abs_working_dir=self.root)
+        self.assertEqual(result['errors'], [])
+        self.assertIn('from lib', result['outputFiles'][0]['text'])
+
+        self.assertEqual(backend.version()['protocol'], PROTOCOL_VERSION)
+        self.assertIn('cancel', backend.capabilities()['commands'])
+
+    def test_stdio(self):
+        backend = DaemonBackend(self.binary)
+        self.addCleanup(backend.close)
+        self.check_backend(backend)
+
+        # Requests sent from several threads are served concurrently.
+        results = {}
+
+        def transform(i):
+            results[i] = backend.transform(f"export const x{i}: number = {i}", loader="ts")
+        threads = [threading.Thread(target=transform, args=(i,)) for i in range(8)]
+        for thread in threads:
+            thread.start()
+        for thread in threads:
+            thread.join()
+        self.assertEqual(sorted(results), list(range(8)))
+        for i, code in results.items():
+            self.assertIn(f"x{i} = {i}", code)
+
+    @pytest.mark.skipif(sys.platform == 'win32', reason="Unix domain sockets")
+    def test_socket(self):
+        path = os.path.join(self.root, 'esbuild-py.sock')
+        self.start('--serve-socket', path)
+        wait_for(lambda: os.path.exists(path))
+
+        first = SocketBackend(path)
+        self.addCleanup(first.close)
+        self.check_backend(first)
+
+        # Another client shares the daemon.
+        second = SocketBackend(path)
+        self.addCleanup(second.close)
+        self.assertEqual(second.transform("let y: string", loader="ts").strip(), "let y;")
+
+        # Closing a client closes its socket, and the files made from it.
+        connection = second._connection()
+        second.close()
+        self.assertTrue(connection._reader.closed)
+        self.assertTrue(connection._writer.closed)
+        self.assertEqual(first.transform("let z: string", loader="ts").strip(), "let z;")
+
+    def post(self, url, request, token=None):
+        headers = {'Content-Type': 'application/json'}
+        if token:
+            headers['Authorization'] = f'Bearer {token}'
+        req = urllib.request.Request(url, data=json.dumps(request).encode('utf-8'), headers=headers)
+        with urllib.request.urlopen(req, timeout=10) as response:
+            return json.load(response)
+
+    def start_http(self, *args):
+        port = free_port()
+        self.start('--serve-http', f'127.0.0.1:{port}', *args)
+
+        def listening():
+            try:
+                socket.create_connection(('127.0.0.1', port), timeout=1).close()
+                return True
+            except OSError:
+                return False
+        wait_for(listening)
+        return f'http://127.0.0.1:{port}'
+
+    def test_http(self):
+        url = self.start_http()
+        with urllib.request.urlopen(url + '/version', timeout=10) as response:
+            self.assertEqual(json.load(response)['protocol'], PROTOCOL_VERSION)
+
+        result = self.post(url + '/transform', {'code': 'let x: number = 1', 'options': {'loader': 'ts'}})
+        self.assertEqual(result['code'], 'let x = 1;\n')
+
+        result = self.post(url + '/build', {'entryPoints': ['main.js'], 'bundle': True, 'write': False, 'outdir': 'dist', 'absWorkingDir': self.root})
+        self.assertEqual(result['errors'], [])
+        self.assertIn('from lib', result['outputFiles'][0]['text'])
+
+    def test_http_token(self):
+        url = self.start_http('--http-token', 'secret')
+        request = {'code': 'let x = 1', 'options': {}}
+        with self.assertRaises(urllib.error.HTTPError) as cm:
+            self.post(url + '/transform', request)
+        self.assertEqual(cm.exception.code, 401)
+        cm.exception.close()
+        self.assertEqual(self.post(url + '/transform', request, token='secret')['errors'], [])
+
+    def test_http_refuses_public_address_without_token(self):
+        process = subprocess.run([self.binary, '--serve-http', f'0.0.0.0:{free_port()}'], capture_output=True, text=True, timeout=10)
+        self.assertEqual(process.returncode, 1)
+        self.assertIn('without a token', process.stderr)
+
+
+if __name__ == '__main__':
+    unittest.main()
@@ -23,4 +23,44 @@ ReactDOM.render(
   document.getElementById("root")
 );
         """
-        assert transform(jsx).strip() == expected.strip()
\ No newline at end of file
+        assert transform(jsx).strip() == expected.strip()
+
+class TestTransformOptions(unittest.TestCase):
+
+    def test_loader(self):
+        self.assertEqual(transform("let x: number = 1", loader="ts").strip(), "let x = 1;")
+
+    def test_format(self):
+        self.assertIn("module.exports", transform("export const x = 1", loader="js", format="cjs"))
+
+    def test_target(self):
+        code = transform("const y = a ?? b", loader="js", target="es2019")
+        self.assertNotIn("??", code)
+        self.assertIn("??", transform("const y = a ?? b", loader="js", target="es2020"))
+
+    def test_log_override_to_error(self):
+        code = "function f() { eval('x') }"
+        transform(code, loader="js")
+        with self.assertRaisesRegex(RuntimeError, "eval"):
+            transform(code, loader="js", log_override={"direct-eval": "error"})
+
+    def test_invalid_values_are_rejected(self):
+        for options, error in [
+            ({"loader": "typescript"}, 'Invalid loader "typescript"'),
+            ({"platform": "nodejs"}, 'Invalid "platform" value "nodejs"'),
+            ({"format": "es"}, 'Invalid "format" value "es"'),
+            ({"log_level": "warn"}, 'Invalid "logLevel" value "warn"'),
+            ({"log_override": {"direct-eval": "loud"}}, 'Invalid "logOverride" value "loud"'),
+        ]:
+            with self.subTest(options=options):
+                with self.assertRaisesRegex(RuntimeError, error):
+                    transform("let x = 1", **options)
+
+    def test_syntax_error(self):
+        with self.assertRaisesRegex(RuntimeError, "esbuild transformation failed"):
+            transform("let x =", loader="js")
+
+    def test_legal_comments(self):
+        code = "/*! MIT License */\nexport const x = 1;"
+        self.assertIn("MIT License", transform(code, loader="js"))
+        self.assertNotIn("MIT License", transform(code, loader="js", legal_comments="none"))